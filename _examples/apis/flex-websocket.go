@@ -17,6 +17,7 @@ import (
 	"go.drunkce.com/dce/converter"
 	"go.drunkce.com/dce/proto"
 	"go.drunkce.com/dce/proto/flex"
+	"go.drunkce.com/dce/router"
 	"go.drunkce.com/dce/session"
 	"go.drunkce.com/dce/util"
 )
@@ -74,7 +75,7 @@ func flexWebsocketBind(port string) {
 			go syncUserList(shadowSess, h, user)
 		}
 		for {
-			ctxData := map[string]any{"$shadowSession": shadowSess}
+			ctxData := map[string]any{router.ShadowSessionKey: shadowSess}
 			if !flex.WebsocketRouter.Route(c, h.Rp.Req, ctxData) {
 				break
 			}
@@ -109,21 +110,17 @@ func flexWebsocketBind(port string) {
 		_, _ = w.Write([]byte{'1'})
 	})
 
+	sessions := router.NewSessionMiddleware[*flex.WebsocketProtocol](func(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[*session.SimpleUser], error) {
+		return session.NewShmSession[*session.SimpleUser](sidPool, ttlMinutes)
+	}).AutoRenew(0, 0, 0)
 	flex.WebsocketRouter.SetBefore("*", func(ctx *flex.Websocket) error {
-		shadowSession, _ := ctx.Rp.CtxData("$shadowSession")
-		rs := shadowSession.(*session.ShmSession[*session.SimpleUser])
-		cloned, _ := rs.CloneForRequest(ctx.Rp.Sid())
-		sess := cloned.(*session.ShmSession[*session.SimpleUser])
-		if _, ok := sess.User(); !ok {
+		if _, ok := ctx.Rp.Session().(*session.ShmSession[*session.SimpleUser]).User(); !ok {
 			return util.Openly(401, "Unauthorized")
 		}
-		ctx.Rp.SetSession(sess)
-		auto := session.NewAutoRenew(sess)
-		if gotNew, err := auto.TryRenew(); err == nil && gotNew {
-			ctx.Rp.SetRespSid(sess.Id())
-		}
 		return nil
 	})
+	// the session is loaded before the authorization hook above
+	sessions.Bind(flex.WebsocketRouter.Router, "*")
 }
 
 func syncUserList(sess *session.ShmSession[*session.SimpleUser], h *proto.Http, user *session.SimpleUser) {
@@ -3,7 +3,6 @@ package apis
 import (
 	"fmt"
 	"net/http"
-	"slices"
 	"strings"
 
 	"github.com/redis/go-redis/v9"
@@ -69,7 +68,7 @@ func bind() {
 	// curl http://127.0.0.1:2050/manage/profile -H "X-Session-Id: $session_id" //  pass sid on header, can access if sid is valid
 	// curl http://127.0.0.1:2050/manage/profile -b "session_id=$session_id" //  pass sid in cookies, can access if sid is valid
 	// curl http://127.0.0.1:2050/manage/profile?autologin=1 -H "X-Session-Id: $session_id" //  use long life sid to do auto login, will get new sid and the old will destroy
-	proto.HttpRouter.PushApi(router.Path("manage/profile").ByMethod(proto.HttpGet).Append("roles", 1, 2).BindHosts("2050"), func(h *proto.Http) {
+	proto.HttpRouter.PushApi(router.Path("manage/profile").ByMethod(proto.HttpGet).RequireRoles("member").BindHosts("2050"), func(h *proto.Http) {
 		se := h.Rp.Session()
 		if se == nil && h.SetError(util.Openly0("Invalid session")) {
 			return
@@ -81,7 +80,7 @@ func bind() {
 
 	// curl -X PATCH http://127.0.0.1:2050/manage/profile -H "X-Session-Id: $session_id" -d "{}" // none required fields, got openly err response
 	// curl -X PATCH http://127.0.0.1:2050/manage/profile -H "X-Session-Id: $session_id" -d "{""name"":""Foo"",""role_id"":2}" // with required, curren session user will update to role 2
-	proto.HttpRouter.PushApi(router.Path("manage/profile").ByMethod(proto.HttpPatch).Append("roles", 1), func(h *proto.Http) {
+	proto.HttpRouter.PushApi(router.Path("manage/profile").ByMethod(proto.HttpPatch).RequireRoles("member"), func(h *proto.Http) {
 		jc := converter.JsonMapResponser(h)
 		u, ok := converter.JsonMapRequester(h).Parse()
 		if !ok {
@@ -116,7 +115,7 @@ func bind() {
 	// curl -I http://127.0.0.1:2050/manage/user -H "X-Session-Id: $session_id" // got 403 if the session user role is 1, you can use role 2 user login to access
 	// curl http://127.0.0.1:2050/manage/user -H "X-Session-Id: $session_id"
 	proto.HttpRouter.PushApi(
-		router.Path("manage/user").ByMethod(proto.HttpGet|proto.HttpHead).Append("roles", 2),
+		router.Path("manage/user").ByMethod(proto.HttpGet|proto.HttpHead).RequireRoles("manager"),
 		func(h *proto.Http) {
 			se := h.Rp.Session()
 			if se == nil && h.SetError(util.Openly0("Invalid session")) {
@@ -128,87 +127,32 @@ func bind() {
 		},
 	)
 
+	sessions := router.NewSessionMiddleware[*proto.HttpProtocol](func(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[*Member], error) {
+		return redises.NewSession[*Member](Rdb, sidPool, ttlMinutes)
+	}).AutoRenew(240, 0, 0)
 	proto.HttpRouter.Raw().
-	SetBefore("*", func(ctx *router.Context[*proto.HttpProtocol]) error {
-		sess, err := redises.NewSession[*Member](Rdb, []string{ctx.Rp.Sid()}, session.DefaultTtlMinutes)
-		if err != nil {
-			return err
-		}
-		auto := session.NewAutoRenew(sess).Config(240, 0, 0)
-		auth := NewAppAuth(ctx, auto)
-		if err = auth.valid(); err != nil {
-			return err
-		} else if strings.Contains(ctx.Rp.Req.URL.RequestURI(), "autologin") {
-			if err = auth.autoLogin(); err != nil {
-				return err
+		SetBefore("*", func(ctx *router.Context[*proto.HttpProtocol]) error {
+			if strings.Contains(ctx.Rp.Req.URL.RequestURI(), "autologin") {
+				// the new sid will be responded by the session middleware
+				if err := ctx.Rp.Session().(*redises.Session[*Member]).AutoLogin(); err != nil {
+					return err
+				}
 			}
-		} else if !auth.isLogin() {
-			if err = auth.tryRenew(); err != nil {
-				return err
+			return authorizer.Check(ctx)
+		}).
+		SetAfter("*", func(ctx *router.Context[*proto.HttpProtocol]) error {
+			if newSid := ctx.Rp.RespSid(); newSid != "" {
+				_, _ = ctx.Rp.WriteString(fmt.Sprintf("\n\nGot new sid, you can use it to access private page:\n%s", newSid))
 			}
-		}
-		ctx.Rp.SetSession(sess)
-		return nil
-	}).
-	SetAfter("*", func(ctx *router.Context[*proto.HttpProtocol]) error {
-		if newSid := ctx.Rp.RespSid(); newSid != "" {
-			_, _ = ctx.Rp.WriteString(fmt.Sprintf("\n\nGot new sid, you can use it to access private page:\n%s", newSid))
-		}
-		return nil
-	})
-}
-
-type AppAuth[Rp router.RoutableProtocol] struct {
-	ctx        *router.Context[Rp]
-	session    *session.AutoRenew[*redises.Session[*Member]]
-	rolesNeeds []uint16
-}
-
-func NewAppAuth[Rp router.RoutableProtocol](ctx *router.Context[Rp], session *session.AutoRenew[*redises.Session[*Member]]) *AppAuth[Rp] {
-	var roles []uint16
-	if rls := ctx.Api.ExtrasBy("roles"); rls != nil {
-		roles = util.MapSeqFrom[any, uint16](rls).Map(func(a any) uint16 {
-			return uint16(a.(int))
-		}).Collect()
-	}
-	return &AppAuth[Rp]{ctx, session, roles}
-}
-
-func (a *AppAuth[Rp]) isPrivate() bool {
-	return len(a.rolesNeeds) > 0
-}
-
-func (a *AppAuth[Rp]) isLogin() bool {
-	return strings.HasSuffix(a.ctx.Api.Path, "login")
+			return nil
+		})
+	// the session hooks are composed with the hooks above, the session is loaded before the authorization, and the new
+	// sid is set before the after hook
+	sessions.Bind(proto.HttpRouter.Raw(), "*")
 }
 
-func (a *AppAuth[Rp]) autoLogin() error {
-	if err := a.session.S.AutoLogin(); err != nil {
-		return err
-	}
-	a.ctx.Rp.SetRespSid(a.session.S.Id())
-	return nil
-}
-
-func (a *AppAuth[Rp]) tryRenew() error {
-	if ok, err := a.session.TryRenew(); err != nil {
-		return err
-	} else if ok {
-		a.ctx.Rp.SetRespSid(a.session.S.Id())
-	}
-	return nil
-}
-
-func (a *AppAuth[Rp]) valid() error {
-	if a.isPrivate() {
-		if user, ok := a.session.S.User(); !ok {
-			return util.Openly(401, "Unauthorized")
-		} else if !slices.Contains(a.rolesNeeds, user.RoleId) {
-			return util.Openly(403, "Forbidden")
-		}
-	}
-	return nil
-}
+// authorizer checks the roles required by the apis, the "manager" could access all the apis of the "member"
+var authorizer = router.NewAuthorizer[*proto.HttpProtocol, *Member]().Inherit("manager", "member")
 
 func members() []Member {
 	return []Member{
@@ -228,6 +172,12 @@ func (m Member) Uid() uint64 {
 	return m.Id
 }
 
+var roleNames = map[uint16]string{1: "member", 2: "manager"}
+
+func (m Member) Roles() []string {
+	return []string{roleNames[m.RoleId]}
+}
+
 var Rdb *redis.Client
 
 func PrepareRedis(addr string) *redis.Client {
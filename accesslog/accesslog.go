@@ -0,0 +1,222 @@
+// Package accesslog emits a structured access log line for every routed request of any protocol via `slog`, the
+// lines could be formatted as json, logfmt, or the Apache combined log format for HTTP.
+//
+//	logger := accesslog.New(os.Stdout, accesslog.FormatJson).SetSampleRatio(0.1)
+//	accesslog.Instrument(logger, proto.HttpRouter.Raw(), "http")
+//	accesslog.Instrument(logger, flex.TcpRouter.Router, flex.TcpRouter.Id())
+package accesslog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+)
+
+// Format is the output format of the access log lines.
+type Format uint8
+
+const (
+	// FormatJson formats the lines as json objects via the `slog.JSONHandler`.
+	FormatJson Format = iota
+	// FormatLogfmt formats the lines as key=value pairs via the `slog.TextHandler`.
+	FormatLogfmt
+	// FormatCombined formats the lines as the Apache combined log format, the non-HTTP requests are formatted with the
+	// router name as the method and the response code as the status.
+	FormatCombined
+)
+
+// HeaderRequestId is the header to take the request id from, if the protocol has no package id, such as HTTP.
+const HeaderRequestId = "X-Request-Id"
+
+// Message is the message of the access log records.
+const Message = "access"
+
+// Logger emits the access log records.
+type Logger struct {
+	logger      *slog.Logger
+	sampleRatio float64
+}
+
+// New creates a Logger writing the lines in the format to the writer.
+func New(w io.Writer, format Format) *Logger {
+	var handler slog.Handler
+	switch format {
+	case FormatLogfmt:
+		handler = slog.NewTextHandler(w, nil)
+	case FormatCombined:
+		handler = NewCombinedHandler(w)
+	default:
+		handler = slog.NewJSONHandler(w, nil)
+	}
+	return NewWithLogger(slog.New(handler))
+}
+
+// NewWithLogger creates a Logger emitting the records via the logger, such as the `slog.Default()`.
+func NewWithLogger(logger *slog.Logger) *Logger {
+	return &Logger{logger: logger, sampleRatio: 1}
+}
+
+// SetSampleRatio specifies the ratio of the succeeded requests to log, the failed requests are always logged.
+func (l *Logger) SetSampleRatio(ratio float64) *Logger {
+	l.sampleRatio = ratio
+	return l
+}
+
+func (l *Logger) sampled() bool {
+	return l.sampleRatio >= 1 || rand.Float64() < l.sampleRatio
+}
+
+// Instrument logs every request of the router, including those not located any api, the api is "-" for them.
+//
+// The record attributes:
+//   - protocol: The router name.
+//   - remote: The remote address of the client.
+//   - path: The request path.
+//   - api: The matched api pattern.
+//   - params: The path params group.
+//   - request_id: The package id, or the X-Request-Id header.
+//   - sid: The hash of the session id, the raw sid is never logged.
+//   - uid: The uid of the logged-in user.
+//   - status: The HTTP status, only for HTTP.
+//   - code: The response code, 0 for the succeeded requests.
+//   - bytes_in: The length of the request body, -1 if unknown.
+//   - method, uri, proto, referer, user_agent: The request line and headers, only for HTTP.
+//   - bytes_out: The bytes written to the client, including the error message of the package protocols.
+//   - latency: The duration of handling and responding.
+//
+// The record is emitted after the response written if the protocol embeds the `router.RespondedNotifier`, so that the
+// bytes are measured at the writer, or else the buffered and streamed bytes are logged as the response bytes.
+func Instrument[Rp router.RoutableProtocol](l *Logger, r *router.Router[Rp], name string) {
+	r.Intercept(func(ctx *router.Context[Rp]) func() {
+		start := time.Now()
+		return func() {
+			api := "-"
+			if ctx.Api != nil {
+				api = ctx.Api.Path
+			}
+			// the package protocols clear the request package on responding, so the attributes are collected before
+			rec, ok := l.record(ctx.Rp, api, ctx.PathParams(), name)
+			if !ok {
+				return
+			}
+			if !router.OnResponded(ctx.Rp, func(n int) { l.emit(ctx.Rp, rec, n, start) }) {
+				l.emit(ctx.Rp, rec, bytesOut(ctx.Rp), start)
+			}
+		}
+	})
+}
+
+type record struct {
+	level slog.Level
+	attrs []slog.Attr
+}
+
+// record collects the attributes of the request and the response code, it returns false if sampled out.
+func (l *Logger) record(rp router.RoutableProtocol, api string, params map[string]router.Param, name string) (record, bool) {
+	code, status, level := responseCode(rp)
+	if level == slog.LevelInfo && !l.sampled() {
+		return record{}, false
+	}
+	attrs := make([]slog.Attr, 0, 20)
+	attrs = append(attrs,
+		slog.String("protocol", name),
+		slog.String("remote", router.RemoteAddr(rp)),
+		slog.String("path", rp.Path()),
+		slog.String("api", api))
+	if len(params) > 0 {
+		pas := make([]any, 0, len(params))
+		for k, p := range params {
+			pas = append(pas, slog.String(k, util.Iif(p.Values() != nil, strings.Join(p.Values(), ","), p.Value())))
+		}
+		attrs = append(attrs, slog.Group("params", pas...))
+	}
+	attrs = append(attrs, slog.String("request_id", requestId(rp)))
+	if sid := util.Iif(rp.Sid() != "", rp.Sid(), rp.RespSid()); sid != "" {
+		attrs = append(attrs, slog.String("sid", HashSid(sid)))
+	}
+	if us, ok := rp.Session().(interface{ Uid() (uint64, error) }); ok {
+		if uid, err := us.Uid(); err == nil {
+			attrs = append(attrs, slog.Uint64("uid", uid))
+		}
+	}
+	if status > 0 {
+		attrs = append(attrs, slog.Int("status", status))
+	}
+	attrs = append(attrs, slog.Int("code", code), slog.Int64("bytes_in", bytesIn(rp)))
+	if hr, ok := rp.(interface{ Request() *http.Request }); ok {
+		req := hr.Request()
+		attrs = append(attrs,
+			slog.String("method", req.Method),
+			slog.String("uri", req.RequestURI),
+			slog.String("proto", req.Proto),
+			slog.String("referer", req.Referer()),
+			slog.String("user_agent", req.UserAgent()))
+	}
+	return record{level: level, attrs: attrs}, true
+}
+
+func (l *Logger) emit(rp router.RoutableProtocol, rec record, bytesOut int, start time.Time) {
+	attrs := append(rec.attrs, slog.Int("bytes_out", bytesOut), slog.Duration("latency", time.Since(start)))
+	l.logger.LogAttrs(rp, rec.level, Message, attrs...)
+}
+
+// HashSid hashes the session id to correlate the requests of a session without leaking the sid.
+func HashSid(sid string) string {
+	sum := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(sum[:8])
+}
+
+func requestId(rp router.RoutableProtocol) string {
+	if id := rp.Id(); id > 0 {
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	return router.RequestHeader(rp, HeaderRequestId)
+}
+
+// responseCode returns the response code and the HTTP status of the request, and the level to log, the closed errors
+// and the 5xx statuses are logged as errors, the openly errors and the 4xx statuses as warnings.
+func responseCode(rp router.RoutableProtocol) (code int, status int, level slog.Level) {
+	level = slog.LevelInfo
+	if sg, ok := rp.(interface{ ResponseStatus() int }); ok {
+		status = sg.ResponseStatus()
+	}
+	if err := rp.Error(); err != nil {
+		code, _ = util.ResponseUnits(err)
+		var e util.Error
+		level = util.Iif(errors.As(err, &e) && e.IsOpenly(), slog.LevelWarn, slog.LevelError)
+	}
+	if status >= 500 {
+		level = slog.LevelError
+	} else if status >= 400 && level < slog.LevelWarn {
+		level = slog.LevelWarn
+	}
+	return
+}
+
+func bytesIn(rp router.RoutableProtocol) int64 {
+	if cl, ok := rp.(interface{ ContentLength() int64 }); ok {
+		return cl.ContentLength()
+	}
+	return -1
+}
+
+func bytesOut(rp router.RoutableProtocol) int {
+	var n int
+	if bl, ok := rp.(interface{ BufferedLen() int }); ok {
+		n = bl.BufferedLen()
+	}
+	if sb, ok := rp.(interface{ StreamedBytes() int }); ok {
+		n += sb.StreamedBytes()
+	}
+	return n
+}
@@ -0,0 +1,161 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.drunkce.com/dce/accesslog"
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/proto/flex"
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+)
+
+func newRouter(l *accesslog.Logger) *proto.WrappedHttpRouter {
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	r.Get("goods/{id}", func(h *proto.Http) {
+		_, _ = h.WriteString("goods")
+	}).Post("fail", func(h *proto.Http) {
+		h.SetError(util.Openly(422, "failed"))
+	})
+	accesslog.Instrument(l, r.Raw(), "http")
+	return r
+}
+
+func TestJson(t *testing.T) {
+	var buf bytes.Buffer
+	r := newRouter(accesslog.New(&buf, accesslog.FormatJson))
+	req := httptest.NewRequest(http.MethodGet, "/goods/1", nil)
+	req.Header.Set(accesslog.HeaderRequestId, "req-1")
+	req.Header.Set(proto.HeaderSidKey, "secret-sid")
+	r.Route(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid json line %q: %s", buf.String(), err)
+	}
+	for key, expected := range map[string]any{
+		"msg":        accesslog.Message,
+		"level":      "INFO",
+		"protocol":   "http",
+		"remote":     "192.0.2.1:1234",
+		"path":       "goods/1",
+		"api":        "goods/{id}",
+		"params":     map[string]any{"id": "1"},
+		"request_id": "req-1",
+		"sid":        accesslog.HashSid("secret-sid"),
+		"status":     float64(200),
+		"code":       float64(0),
+		"bytes_out":  float64(5),
+		"method":     http.MethodGet,
+		"uri":        "/goods/1",
+	} {
+		if actual, ok := entry[key]; !ok || !equal(actual, expected) {
+			t.Errorf("expected %s=%v, got %v", key, expected, actual)
+		}
+	}
+	if strings.Contains(buf.String(), "secret-sid") {
+		t.Fatalf("the raw sid leaked: %s", buf.String())
+	}
+}
+
+func equal(a, b any) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+func TestLogfmtAndSampling(t *testing.T) {
+	var buf bytes.Buffer
+	r := newRouter(accesslog.New(&buf, accesslog.FormatLogfmt).SetSampleRatio(0))
+	r.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/goods/1", nil))
+	if buf.Len() > 0 {
+		t.Fatalf("the succeeded request should be sampled out: %s", buf.String())
+	}
+	r.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/fail", strings.NewReader("body")))
+	line := buf.String()
+	for _, expected := range []string{"level=WARN", "msg=access", "api=fail", "status=422", "code=422", "bytes_in=4"} {
+		if !strings.Contains(line, expected) {
+			t.Errorf("expected %q in the line %q", expected, line)
+		}
+	}
+}
+
+func TestCombined(t *testing.T) {
+	var buf bytes.Buffer
+	r := newRouter(accesslog.New(&buf, accesslog.FormatCombined))
+	req := httptest.NewRequest(http.MethodGet, "/goods/1?page=2", nil)
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", "curl/8.0")
+	r.Route(httptest.NewRecorder(), req)
+	r.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "192.0.2.1 - - [") ||
+		!strings.HasSuffix(lines[0], `] "GET /goods/1?page=2 HTTP/1.1" 200 5 "https://example.com/" "curl/8.0"`) {
+		t.Errorf("unexpected line %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], `] "GET /missing HTTP/1.1" 404 - "-" "-"`) {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+}
+
+func lastEntry(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	var entry map[string]any
+	if err := json.Unmarshal(lines[len(lines)-1], &entry); err != nil {
+		t.Fatalf("invalid json line %q: %s", buf.String(), err)
+	}
+	return entry
+}
+
+func TestBytesOutAtWriter(t *testing.T) {
+	var buf bytes.Buffer
+	l := accesslog.New(&buf, accesslog.FormatJson)
+
+	// the error message is serialized into the response package
+	tr := &flex.WrappedTcpRouter{ConnectorMappingManager: proto.NewConnectorMappingManager[*flex.TcpProtocol, net.Conn]("accesslog-flex-tcp")}
+	tr.Push("fail", func(c *flex.Tcp) {
+		c.SetError(util.Openly(422, "the message of the failure"))
+	})
+	accesslog.Instrument(l, tr.Router, "flex-tcp")
+	client, server := net.Pipe()
+	received := make(chan []byte)
+	go func() {
+		_, _ = client.Write(flex.NewPackage("fail", []byte("body"), "", 1).Serialize())
+		resp, _ := io.ReadAll(client)
+		received <- resp
+	}()
+	tr.Route(server, nil)
+	_ = server.Close()
+	resp := <-received
+	entry := lastEntry(t, &buf)
+	if entry["code"] != float64(422) || entry["bytes_in"] != float64(4) {
+		t.Fatalf("unexpected entry %v", entry)
+	} else if len(resp) == 0 || entry["bytes_out"] != float64(len(resp)) {
+		t.Fatalf("expected bytes_out=%d, got %v", len(resp), entry["bytes_out"])
+	}
+
+	// both the streamed and the buffered bytes are counted
+	hr := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	hr.Get("stream", func(h *proto.Http) {
+		_, _ = h.Rp.Stream().WriteString("chunk")
+		_, _ = h.WriteString(" end")
+	})
+	accesslog.Instrument(l, hr.Raw(), "http")
+	w := httptest.NewRecorder()
+	hr.Route(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if entry = lastEntry(t, &buf); entry["bytes_out"] != float64(w.Body.Len()) || w.Body.Len() != 9 {
+		t.Fatalf("expected bytes_out=%d, got %v", w.Body.Len(), entry["bytes_out"])
+	}
+}
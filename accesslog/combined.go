@@ -0,0 +1,94 @@
+package accesslog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CombinedTimeLayout is the time layout of the Apache combined log format.
+const CombinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// CombinedHandler is a `slog.Handler` formatting the access log records as the Apache combined log format:
+//
+//	127.0.0.1 - 1001 [10/Oct/2000:13:55:36 -0700] "GET /goods/1 HTTP/1.1" 200 2326 "-" "curl/8.0"
+//
+// The records of the other messages are ignored.
+type CombinedHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	attrs []slog.Attr
+}
+
+func NewCombinedHandler(w io.Writer) *CombinedHandler {
+	return &CombinedHandler{mu: &sync.Mutex{}, w: w}
+}
+
+func (h *CombinedHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h *CombinedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &CombinedHandler{mu: h.mu, w: h.w, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+// WithGroup returns the handler itself, as the combined format has a fixed set of fields.
+func (h *CombinedHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
+
+func (h *CombinedHandler) Handle(_ context.Context, record slog.Record) error {
+	if record.Message != Message {
+		return nil
+	}
+	values := make(map[string]slog.Value, record.NumAttrs()+len(h.attrs))
+	for _, attr := range h.attrs {
+		values[attr.Key] = attr.Value
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		values[attr.Key] = attr.Value
+		return true
+	})
+	str := func(key string) string {
+		if v, ok := values[key]; ok && v.String() != "" {
+			return v.String()
+		}
+		return "-"
+	}
+
+	host := str("remote")
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	method, uri, protocol, status := str("method"), str("uri"), str("proto"), str("status")
+	if _, ok := values["method"]; !ok {
+		// non-HTTP requests
+		method, uri, protocol, status = str("protocol"), "/"+strings.TrimPrefix(str("path"), "/"), "-", str("code")
+	}
+	size := "-"
+	if v, ok := values["bytes_out"]; ok && v.Kind() == slog.KindInt64 && v.Int64() > 0 {
+		size = strconv.FormatInt(v.Int64(), 10)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(host)
+	sb.WriteString(" - ")
+	sb.WriteString(str("uid"))
+	sb.WriteString(" [")
+	sb.WriteString(record.Time.Format(CombinedTimeLayout))
+	sb.WriteString(`] "`)
+	sb.WriteString(method + " " + uri + " " + protocol)
+	sb.WriteString(`" `)
+	sb.WriteString(status + " " + size + " ")
+	sb.WriteString(strconv.Quote(str("referer")) + " " + strconv.Quote(str("user_agent")))
+	sb.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, sb.String())
+	return err
+}
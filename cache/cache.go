@@ -0,0 +1,310 @@
+// Package cache caches the responses of the read-heavy apis, the responses are keyed by the request path, which
+// contains the path params and suffix, the query, the selected headers, and optionally the session user, they could be
+// kept in an in-process LRU or shared across the nodes via Redis, and invalidated by tags. For HTTP, the ETag and the
+// Cache-Control headers are responded, and the conditional requests with a matched `If-None-Match` get 304.
+//
+//	responses := cache.New[*proto.HttpProtocol](cache.NewLruStore(10000))
+//	proto.HttpRouter.PushApi(cache.Enable(router.Path("goods/{id}").ByMethod(proto.HttpGet), &cache.Policy{Ttl: time.Minute, Tags: []string{"goods"}}), controller)
+//	proto.HttpRouter.Raw().SetBefore("*", router.Chain(sessions.Before, responses.Before)).
+//		SetAfter("*", router.Chain(sessions.After, responses.After))
+//
+//	// in the controller which modifies the goods
+//	cache.Invalidate(c.Rp, "goods")
+//
+// The request bodies are not a part of the keys, so the apis whose responses depend on the request bodies should not
+// be cached.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.drunkce.com/dce/router"
+)
+
+const (
+	HeaderETag         = "ETag"
+	HeaderIfNoneMatch  = "If-None-Match"
+	HeaderCacheControl = "Cache-Control"
+	// HeaderCache tells whether the response hit the cache, it is "HIT" or "MISS".
+	HeaderCache = "X-Cache"
+)
+
+const StatusNotModified = 304
+
+const (
+	extraPolicyKey = "$#CACHE#"
+	ctxKey         = "$cacheKey"
+	ctxTagsKey     = "$cacheTags"
+	ctxPurgeKey    = "$cachePurgeTags"
+)
+
+// Entry is a cached response.
+//
+// Fields:
+//   - Body: The response body.
+//   - Status: The explicitly specified HTTP status code.
+//   - ContentType: The content type of the response.
+//   - ETag: The entity tag calculated from the body.
+//   - Tags: The tags to invalidate the entry.
+type Entry struct {
+	Body        []byte   `json:"body,omitempty"`
+	Status      int      `json:"status,omitempty"`
+	ContentType string   `json:"ct,omitempty"`
+	ETag        string   `json:"etag,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// Store keeps the cached entries, the LruStore keeps them in the process, and the `redises.Store` shares them across
+// the nodes.
+type Store interface {
+	// Get returns the entry of the key, or nil if not cached or expired.
+	Get(key string) (*Entry, error)
+	// Set caches the entry until the ttl expired, and indexes it by its tags.
+	Set(key string, entry *Entry, ttl time.Duration) error
+	// Invalidate deletes the entries tagged by any of the tags.
+	Invalidate(tags ...string) error
+}
+
+// Policy is the cache policy of an api.
+//
+// Fields:
+//   - Ttl: The duration to cache the responses.
+//   - Tags: The static tags of the responses, the dynamic tags could be added via `Tag` in the controller.
+//   - Vary: The request headers to distinguish the responses, such as "Accept-Language".
+//   - PerUser: Whether to cache the responses per session user, the anonymous requests are distinguished by the sid.
+//   - CacheControl: The Cache-Control header of HTTP, it is "max-age=<Ttl seconds>" by default, and "private" will be
+//     appended if PerUser.
+//   - HonorNoCache: Whether the request with the `Cache-Control: no-cache` header skips the cached entry and refreshes
+//     it, it is disabled by default, since the entries are shared and any client could force the refreshing.
+type Policy struct {
+	Ttl          time.Duration
+	Tags         []string
+	Vary         []string
+	PerUser      bool
+	CacheControl string
+	HonorNoCache bool
+}
+
+func (p *Policy) cacheControl() string {
+	if p.CacheControl != "" {
+		return p.CacheControl
+	} else if p.PerUser {
+		return "private, max-age=" + strconv.Itoa(int(p.Ttl.Seconds()))
+	}
+	return "max-age=" + strconv.Itoa(int(p.Ttl.Seconds()))
+}
+
+// Enable enables the response cache of the api with the policy, only the GET and HEAD requests are cached for HTTP.
+//
+//	proto.HttpRouter.PushApi(cache.Enable(router.Path("goods").ByMethod(proto.HttpGet), &cache.Policy{Ttl: time.Minute}), controller)
+func Enable(api router.Api, policy *Policy) router.Api {
+	return api.With(extraPolicyKey, policy)
+}
+
+// Tag adds the dynamic tags to the response of the current request, such as "goods:1".
+func Tag(rp router.RoutableProtocol, tags ...string) {
+	appendCtxTags(rp, ctxTagsKey, tags)
+}
+
+// Invalidate invalidates the entries of the tags after the current request, it could be called in any controller
+// covered by the `After` hook.
+func Invalidate(rp router.RoutableProtocol, tags ...string) {
+	appendCtxTags(rp, ctxPurgeKey, tags)
+}
+
+func appendCtxTags(rp router.RoutableProtocol, key string, tags []string) {
+	var exists []string
+	if v, ok := rp.CtxData(key); ok {
+		exists = v.([]string)
+	}
+	rp.SetCtxData(key, append(exists, tags...))
+}
+
+func ctxTags(rp router.RoutableProtocol, key string) []string {
+	if v, ok := rp.CtxData(key); ok {
+		return v.([]string)
+	}
+	return nil
+}
+
+// Cache serves the cached responses before the controllers, and caches the responses after them. Only the succeeded
+// and buffered responses are cached. The requests will be served by the controllers if the store failed.
+type Cache[Rp router.RoutableProtocol] struct {
+	store Store
+}
+
+func New[Rp router.RoutableProtocol](store Store) *Cache[Rp] {
+	return &Cache[Rp]{store: store}
+}
+
+// Invalidate deletes the entries of the tags immediately.
+func (c *Cache[Rp]) Invalidate(tags ...string) error {
+	return c.store.Invalidate(tags...)
+}
+
+func policyOf[Rp router.RoutableProtocol](ctx *router.Context[Rp]) *Policy {
+	if ctx.Api == nil {
+		return nil
+	}
+	policy, _ := ctx.Api.ExtraBy(extraPolicyKey).(*Policy)
+	return policy
+}
+
+func (c *Cache[Rp]) key(ctx *router.Context[Rp], policy *Policy) string {
+	parts := []string{ctx.Api.Path, ctx.Rp.Path()}
+	if qg, ok := any(ctx.Rp).(interface{ RawQuery() string }); ok {
+		// the query is normalized, so that the same params in different orders hit the same entry
+		if query, err := url.ParseQuery(qg.RawQuery()); err == nil {
+			parts = append(parts, query.Encode())
+		}
+	}
+	for _, header := range policy.Vary {
+		parts = append(parts, header+"="+router.RequestHeader(ctx.Rp, header))
+	}
+	if policy.PerUser {
+		user := "sid=" + ctx.Rp.Sid()
+		if us, ok := ctx.Rp.Session().(interface{ Uid() (uint64, error) }); ok {
+			if uid, err := us.Uid(); err == nil {
+				user = "uid=" + strconv.FormatUint(uid, 10)
+			}
+		}
+		parts = append(parts, user)
+	}
+	hash := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(hash[:])
+}
+
+// safeMethod reports whether the request could be served from the cache and whether its response could be stored, only
+// the GET and HEAD requests are served and only the GET responses are stored for HTTP, the protocols without methods
+// are always served and stored.
+func safeMethod(rp router.RoutableProtocol) (serve bool, store bool) {
+	if hr, ok := rp.(interface{ Request() *http.Request }); ok {
+		method := hr.Request().Method
+		return method == http.MethodGet || method == http.MethodHead, method == http.MethodGet
+	}
+	return true, true
+}
+
+// Before responds the cached entry of the request if exists, the request with the `Cache-Control: no-cache` header
+// will skip the cached entry and refresh it if the policy HonorNoCache. The unsafe HTTP requests, such as POST, are
+// always passed to the controller, even if the api accepts GET too.
+func (c *Cache[Rp]) Before(ctx *router.Context[Rp]) error {
+	policy := policyOf(ctx)
+	if policy == nil {
+		return nil
+	}
+	serve, store := safeMethod(ctx.Rp)
+	if !serve {
+		return nil
+	}
+	key := c.key(ctx, policy)
+	if store {
+		ctx.Rp.SetCtxData(ctxKey, key)
+	}
+	if policy.HonorNoCache && strings.Contains(router.RequestHeader(ctx.Rp, HeaderCacheControl), "no-cache") {
+		return nil
+	}
+	entry, err := c.store.Get(key)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Cache store failed, the request is served by the controller: %s", err.Error()))
+		return nil
+	} else if entry == nil {
+		return nil
+	}
+	// the hit request will not be cached again
+	ctx.Rp.SetCtxData(ctxKey, "")
+	setHeader(ctx.Rp, HeaderCache, "HIT")
+	if respondNotModified(ctx.Rp, entry.ETag, policy) {
+		return router.ErrHandled
+	}
+	_, _ = ctx.Rp.Write(entry.Body)
+	if entry.ContentType != "" {
+		ctx.Rp.SetCtxData(router.HttpContentTypeKey, entry.ContentType)
+	}
+	if ss, ok := any(ctx.Rp).(interface{ SetStatus(code int) }); ok && entry.Status > 0 {
+		ss.SetStatus(entry.Status)
+	}
+	return router.ErrHandled
+}
+
+// After invalidates the tags marked by the controller, and caches the response of the missed request.
+func (c *Cache[Rp]) After(ctx *router.Context[Rp]) error {
+	if tags := ctxTags(ctx.Rp, ctxPurgeKey); len(tags) > 0 {
+		if err := c.store.Invalidate(tags...); err != nil {
+			slog.Warn(fmt.Sprintf("Cache invalidation failed: %s", err.Error()))
+		}
+	}
+	k, _ := ctx.Rp.CtxData(ctxKey)
+	key, _ := k.(string)
+	if key == "" || ctx.Rp.Error() != nil {
+		return nil
+	} else if st, ok := any(ctx.Rp).(interface{ Streaming() bool }); ok && st.Streaming() {
+		return nil
+	}
+	policy := policyOf(ctx)
+	entry := &Entry{Tags: slices.Concat(policy.Tags, ctxTags(ctx.Rp, ctxTagsKey))}
+	if bg, ok := any(ctx.Rp).(interface{ Buffered() []byte }); ok {
+		entry.Body = bg.Buffered()
+	}
+	if sg, ok := any(ctx.Rp).(interface{ Status() int }); ok {
+		entry.Status = sg.Status()
+	}
+	if ct, ok := ctx.Rp.CtxData(router.HttpContentTypeKey); ok {
+		entry.ContentType, _ = ct.(string)
+	}
+	hash := sha256.Sum256(entry.Body)
+	entry.ETag = `"` + hex.EncodeToString(hash[:16]) + `"`
+	if err := c.store.Set(key, entry, policy.Ttl); err != nil {
+		slog.Warn(fmt.Sprintf("Cache store failed: %s", err.Error()))
+	}
+	setHeader(ctx.Rp, HeaderCache, "MISS")
+	if respondNotModified(ctx.Rp, entry.ETag, policy) {
+		if cb, ok := any(ctx.Rp).(interface{ ClearBuffer() []byte }); ok {
+			cb.ClearBuffer()
+		}
+	}
+	return nil
+}
+
+// respondNotModified sets the validator headers of HTTP, and responds 304 if the `If-None-Match` matched the etag.
+func respondNotModified(rp router.RoutableProtocol, etag string, policy *Policy) bool {
+	ss, ok := rp.(interface{ SetStatus(code int) })
+	if !ok {
+		return false
+	}
+	setHeader(rp, HeaderETag, etag)
+	setHeader(rp, HeaderCacheControl, policy.cacheControl())
+	if !etagMatched(router.RequestHeader(rp, HeaderIfNoneMatch), etag) {
+		return false
+	}
+	ss.SetStatus(StatusNotModified)
+	return true
+}
+
+func etagMatched(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		// the weak comparison is used, as the body could be compressed by a proxy which weakens the etag
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func setHeader(rp router.RoutableProtocol, key string, value string) {
+	if hs, ok := rp.(interface {
+		SetHeader(key string, value string)
+	}); ok {
+		hs.SetHeader(key, value)
+	}
+}
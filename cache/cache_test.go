@@ -0,0 +1,137 @@
+package cache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/cache"
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/router"
+)
+
+func TestCache(t *testing.T) {
+	responses := cache.New[*proto.HttpProtocol](cache.NewLruStore(100))
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	executed := 0
+	r.PushApi(cache.Enable(router.Path("goods/{id}").ByMethod(proto.HttpGet), &cache.Policy{Ttl: time.Minute, Tags: []string{"goods"}}), func(h *proto.Http) {
+		executed++
+		cache.Tag(h.Rp, "goods:"+h.Param("id"))
+		_, _ = h.WriteString(h.Param("id") + "@" + strconv.Itoa(executed))
+	}).Post("goods/{id}", func(h *proto.Http) {
+		cache.Invalidate(h.Rp, "goods:"+h.Param("id"))
+	})
+	r.Raw().SetBefore("*", responses.Before).SetAfter("*", responses.After)
+
+	do := func(method string, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/"+path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.Route(w, req)
+		return w
+	}
+
+	first := do(http.MethodGet, "goods/1?b=2&a=1", nil)
+	second := do(http.MethodGet, "goods/1?a=1&b=2", nil)
+	if executed != 1 || second.Body.String() != "1@1" || second.Header().Get(cache.HeaderCache) != "HIT" {
+		t.Fatalf("expected the response cached, executed %d, got %q", executed, second.Body.String())
+	}
+	etag := first.Header().Get(cache.HeaderETag)
+	if etag == "" || second.Header().Get(cache.HeaderETag) != etag || first.Header().Get(cache.HeaderCacheControl) != "max-age=60" {
+		t.Fatalf("expected the validator headers, got %v", first.Header())
+	}
+	if w := do(http.MethodGet, "goods/1?a=1&b=2", map[string]string{cache.HeaderIfNoneMatch: etag}); w.Code != cache.StatusNotModified || w.Body.Len() > 0 {
+		t.Fatalf("expected not modified, got %d %q", w.Code, w.Body.String())
+	}
+	if do(http.MethodGet, "goods/2", nil); executed != 2 {
+		t.Fatalf("expected another path executed, executed %d", executed)
+	}
+	if w := do(http.MethodGet, "goods/2", map[string]string{cache.HeaderCacheControl: "no-cache"}); executed != 2 || w.Body.String() != "2@2" {
+		t.Fatalf("expected the client no-cache ignored by default, executed %d, got %q", executed, w.Body.String())
+	}
+
+	do(http.MethodPost, "goods/1", nil)
+	if w := do(http.MethodGet, "goods/1?a=1&b=2", nil); executed != 3 || w.Body.String() != "1@3" {
+		t.Fatalf("expected the dynamic tag invalidated, executed %d, got %q", executed, w.Body.String())
+	}
+	if do(http.MethodGet, "goods/2", nil); executed != 3 {
+		t.Fatalf("expected other entries kept, executed %d", executed)
+	}
+	if err := responses.Invalidate("goods"); err != nil {
+		t.Fatal(err)
+	}
+	if do(http.MethodGet, "goods/2", nil); executed != 4 {
+		t.Fatalf("expected the static tag invalidated, executed %d", executed)
+	}
+}
+
+func TestUnsafeMethod(t *testing.T) {
+	responses := cache.New[*proto.HttpProtocol](cache.NewLruStore(100))
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	executed := 0
+	r.PushApi(cache.Enable(router.Path("stock").ByMethod(proto.HttpGet|proto.HttpHead|proto.HttpPost), &cache.Policy{Ttl: time.Minute}), func(h *proto.Http) {
+		executed++
+		_, _ = h.WriteString(h.Rp.Req.Method + strconv.Itoa(executed))
+	})
+	r.Raw().SetBefore("*", responses.Before).SetAfter("*", responses.After)
+	do := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.Route(w, httptest.NewRequest(method, "/stock", nil))
+		return w
+	}
+
+	if do(http.MethodPost); executed != 1 {
+		t.Fatalf("expected the post executed, executed %d", executed)
+	} else if w := do(http.MethodHead); executed != 2 || w.Header().Get(cache.HeaderCache) == "MISS" {
+		t.Fatalf("expected the post and the head responses not cached, executed %d", executed)
+	}
+	do(http.MethodGet)
+	if w := do(http.MethodPost); executed != 4 || w.Body.String() != "POST4" {
+		t.Fatalf("expected the post not served from the cache, executed %d, got %q", executed, w.Body.String())
+	} else if w = do(http.MethodHead); executed != 4 || w.Header().Get(cache.HeaderCache) != "HIT" {
+		t.Fatalf("expected the head served from the cache, executed %d", executed)
+	}
+}
+
+func TestHonorNoCache(t *testing.T) {
+	responses := cache.New[*proto.HttpProtocol](cache.NewLruStore(100))
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	executed := 0
+	r.PushApi(cache.Enable(router.Path("news").ByMethod(proto.HttpGet), &cache.Policy{Ttl: time.Minute, HonorNoCache: true}), func(h *proto.Http) {
+		executed++
+		_, _ = h.WriteString(strconv.Itoa(executed))
+	})
+	r.Raw().SetBefore("*", responses.Before).SetAfter("*", responses.After)
+	r.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/news", nil))
+	req := httptest.NewRequest(http.MethodGet, "/news", nil)
+	req.Header.Set(cache.HeaderCacheControl, "no-cache")
+	r.Route(httptest.NewRecorder(), req)
+	w := httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodGet, "/news", nil))
+	if executed != 2 || w.Body.String() != "2" {
+		t.Fatalf("expected the entry refreshed by the no-cache request, executed %d, got %q", executed, w.Body.String())
+	}
+}
+
+func TestLruStore(t *testing.T) {
+	now := time.Now()
+	store := cache.NewLruStore(2).SetClock(func() time.Time { return now })
+	_ = store.Set("a", &cache.Entry{Body: []byte("a")}, time.Minute)
+	_ = store.Set("b", &cache.Entry{Body: []byte("b")}, time.Minute)
+	_, _ = store.Get("a")
+	_ = store.Set("c", &cache.Entry{Body: []byte("c")}, time.Minute)
+	if entry, _ := store.Get("b"); entry != nil {
+		t.Fatal("expected the least recently used entry evicted")
+	}
+	if entry, _ := store.Get("a"); entry == nil {
+		t.Fatal("expected the recently used entry kept")
+	}
+	now = now.Add(time.Minute)
+	if entry, _ := store.Get("a"); entry != nil || store.Len() != 1 {
+		t.Fatalf("expected the expired entry removed, len %d", store.Len())
+	}
+}
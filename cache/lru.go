@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key      string
+	entry    *Entry
+	expireAt time.Time
+}
+
+// LruStore keeps the entries in the process, the least recently used entries will be evicted when the capacity
+// exceeded, it is suitable for the single-node deployments.
+type LruStore struct {
+	mu       sync.Mutex
+	capacity int
+	list     *list.List
+	elements map[string]*list.Element
+	tags     map[string]map[string]struct{}
+	now      func() time.Time
+}
+
+// NewLruStore creates a store with the max count of the entries.
+func NewLruStore(capacity int) *LruStore {
+	return &LruStore{
+		capacity: max(capacity, 1),
+		list:     list.New(),
+		elements: make(map[string]*list.Element),
+		tags:     make(map[string]map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+// SetClock replaces the clock, it is used to simulate the time passing in tests.
+func (l *LruStore) SetClock(now func() time.Time) *LruStore {
+	l.now = now
+	return l
+}
+
+// Len returns the count of the entries, including the expired but not evicted ones.
+func (l *LruStore) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.list.Len()
+}
+
+func (l *LruStore) Get(key string) (*Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.elements[key]
+	if !ok {
+		return nil, nil
+	}
+	le := elem.Value.(*lruEntry)
+	if !le.expireAt.After(l.now()) {
+		l.remove(elem)
+		return nil, nil
+	}
+	l.list.MoveToFront(elem)
+	return le.entry, nil
+}
+
+func (l *LruStore) Set(key string, entry *Entry, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.elements[key]; ok {
+		l.remove(elem)
+	}
+	l.elements[key] = l.list.PushFront(&lruEntry{key: key, entry: entry, expireAt: l.now().Add(ttl)})
+	for _, tag := range entry.Tags {
+		if _, ok := l.tags[tag]; !ok {
+			l.tags[tag] = make(map[string]struct{})
+		}
+		l.tags[tag][key] = struct{}{}
+	}
+	for l.list.Len() > l.capacity {
+		l.remove(l.list.Back())
+	}
+	return nil
+}
+
+func (l *LruStore) Invalidate(tags ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, tag := range tags {
+		for key := range l.tags[tag] {
+			if elem, ok := l.elements[key]; ok {
+				l.remove(elem)
+			}
+		}
+		delete(l.tags, tag)
+	}
+	return nil
+}
+
+// remove removes the element from the list and the indexes, the lock should be held.
+func (l *LruStore) remove(elem *list.Element) {
+	le := l.list.Remove(elem).(*lruEntry)
+	delete(l.elements, le.key)
+	for _, tag := range le.entry.Tags {
+		if keys, ok := l.tags[tag]; ok {
+			if delete(keys, le.key); len(keys) == 0 {
+				delete(l.tags, tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package redises
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.drunkce.com/dce/cache"
+)
+
+// DefaultKeyPrefix is hash-tagged, so that the entries and the tag sets are in the same slot on Redis Cluster, which is
+// required by the scripts accessing them together.
+const DefaultKeyPrefix = "{dcecache}"
+
+// The multistep operations are executed as server-side scripts, so that they are atomic. All the accessed keys are
+// passed via KEYS, they require the keys in the same slot on Redis Cluster, see `SetKeyPrefix`.
+
+// setScript sets the entry and adds its key to the tag sets, and extends the ttl of the sets to cover the entry.
+//
+//	KEYS: entry key, tag set keys...
+//	ARGV: entry, ttl milliseconds, key
+var setScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+for i = 2, #KEYS do
+	redis.call('SADD', KEYS[i], ARGV[3])
+	if redis.call('PTTL', KEYS[i]) < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', KEYS[i], ARGV[2])
+	end
+end
+return 1
+`)
+
+// invalidateScript deletes the entries and removes them from the tag set, the entries tagged after the members read
+// are kept in the set.
+//
+//	KEYS: tag set key, entry keys...
+//	ARGV: keys... (in the same order of the entry keys)
+var invalidateScript = redis.NewScript(`
+for i = 2, #KEYS do
+	redis.call('DEL', KEYS[i])
+	redis.call('SREM', KEYS[1], ARGV[i - 1])
+end
+return #KEYS - 1
+`)
+
+// Store shares the entries across the nodes via Redis, the entries are encoded as json, and every tag is indexed by a
+// set of the entry keys.
+type Store struct {
+	redis  redis.UniversalClient
+	ctx    context.Context
+	prefix string
+}
+
+func NewStore(rdb redis.UniversalClient) *Store {
+	return &Store{redis: rdb, ctx: context.Background(), prefix: DefaultKeyPrefix}
+}
+
+// SetKeyPrefix specifies the prefix of the keys, it should contain a hash tag on Redis Cluster, such as "{myapp:cache}",
+// so that the entries could be tagged and invalidated atomically. The entries could not be sharded across the nodes
+// then, so it is better to use a dedicated cluster for a large cache.
+func (s *Store) SetKeyPrefix(prefix string) *Store {
+	s.prefix = prefix
+	return s
+}
+
+func (s *Store) entryKey(key string) string {
+	return s.prefix + ":e:" + key
+}
+
+func (s *Store) tagKey(tag string) string {
+	return s.prefix + ":t:" + tag
+}
+
+func (s *Store) Get(key string) (*cache.Entry, error) {
+	seq, err := s.redis.Get(s.ctx, s.entryKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entry cache.Entry
+	if err = json.Unmarshal(seq, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *Store) Set(key string, entry *cache.Entry, ttl time.Duration) error {
+	seq, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	keys := []string{s.entryKey(key)}
+	for _, tag := range entry.Tags {
+		keys = append(keys, s.tagKey(tag))
+	}
+	return setScript.Run(s.ctx, s.redis, keys, seq, max(ttl.Milliseconds(), 1), key).Err()
+}
+
+func (s *Store) Invalidate(tags ...string) error {
+	for _, tag := range tags {
+		members, err := s.redis.SMembers(s.ctx, s.tagKey(tag)).Result()
+		if err != nil {
+			return err
+		} else if len(members) == 0 {
+			continue
+		}
+		keys := []string{s.tagKey(tag)}
+		args := make([]any, 0, len(members))
+		for _, member := range members {
+			keys = append(keys, s.entryKey(member))
+			args = append(args, member)
+		}
+		if err = invalidateScript.Run(s.ctx, s.redis, keys, args...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package redises_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.drunkce.com/dce/cache"
+	"go.drunkce.com/dce/cache/redises"
+)
+
+func TestStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	rdb.AddHook(keysHook{t})
+	store := redises.NewStore(rdb)
+	if entry, err := store.Get("a"); err != nil || entry != nil {
+		t.Fatalf("expected no entry, got %v, %v", entry, err)
+	}
+	_ = store.Set("a", &cache.Entry{Body: []byte("a"), Tags: []string{"x"}}, time.Minute)
+	_ = store.Set("b", &cache.Entry{Body: []byte("b"), Tags: []string{"x", "y"}}, time.Hour)
+	_ = store.Set("c", &cache.Entry{Body: []byte("c")}, time.Minute)
+	if entry, err := store.Get("a"); err != nil || string(entry.Body) != "a" {
+		t.Fatalf("expected the entry cached, got %v, %v", entry, err)
+	}
+	if ttl := mr.TTL(redises.DefaultKeyPrefix + ":t:x"); ttl != time.Hour {
+		t.Fatalf("expected the tag ttl covered the entries, got %v", ttl)
+	}
+	if err := store.Invalidate("x"); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := store.Get("a")
+	b, _ := store.Get("b")
+	c, _ := store.Get("c")
+	if a != nil || b != nil || c == nil {
+		t.Fatalf("expected the tagged entries invalidated, got %v, %v, %v", a, b, c)
+	} else if mr.Exists(redises.DefaultKeyPrefix + ":t:x") {
+		t.Fatal("expected the tag set deleted")
+	}
+}
+
+// keysHook asserts the keys accessed by the scripts are declared in KEYS.
+type keysHook struct {
+	t *testing.T
+}
+
+func (h keysHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h keysHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if name := cmd.Name(); name == "evalsha" || name == "eval" {
+			args := cmd.Args()
+			numKeys, _ := args[2].(int)
+			for _, arg := range args[3+numKeys:] {
+				if str := fmt.Sprint(arg); strings.HasPrefix(str, redises.DefaultKeyPrefix) {
+					h.t.Errorf("script accesses the undeclared key %s", str)
+				}
+			}
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h keysHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
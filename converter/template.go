@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
 	"text/template"
 
 	"go.drunkce.com/dce/router"
@@ -14,7 +15,59 @@ import (
 )
 
 func TemplateResponser[Rp router.RoutableProtocol, D any](ctx *router.Context[Rp], tmpl *template.Template) *router.Responser[Rp, D, D] {
-	return &router.Responser[Rp, D, D]{ Context: ctx, Serializer: TemplateEngine[D]{tmpl}}
+	engine := TemplateEngine[D]{Template: tmpl}
+	if getter, ok := ctx.Rp.CtxData(router.ContextKeyCsrfToken); ok {
+		engine.token, _ = getter.(func() string)
+	}
+	return &router.Responser[Rp, D, D]{ Context: ctx, Serializer: engine}
+}
+
+// contextFuncs are the placeholders of the request scoped template functions, so that the templates referenced them
+// could be parsed, they will be bound to the request by the TemplateResponser:
+//   - csrfToken: Renders the csrf token, such as `<meta name="csrf-token" content="{{csrfToken}}">`.
+//   - csrfField: Renders a hidden input of the csrf token for the forms.
+var contextFuncs = template.FuncMap{
+	"csrfToken": func() string { return "" },
+	"csrfField": func() string { return "" },
+}
+
+// contextTemplate is a clone of the cached template bound with the request scoped functions, the functions call the
+// token getter of the request executing it, so that the clone could be reused by the requests one at a time.
+type contextTemplate struct {
+	*template.Template
+	token func() string
+}
+
+// contextPools map[*template.Template]*sync.Pool, the pools of the contextTemplate clones of the cached templates
+var contextPools sync.Map
+
+func acquireContextTemplate(tmpl *template.Template) (*contextTemplate, error) {
+	pool, _ := contextPools.LoadOrStore(tmpl, &sync.Pool{})
+	if ct, ok := pool.(*sync.Pool).Get().(*contextTemplate); ok {
+		return ct, nil
+	}
+	// clone to prevent binding the request scoped functions to the cached template
+	cloned, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	ct := &contextTemplate{}
+	ct.Template = cloned.Funcs(template.FuncMap{
+		"csrfToken": func() string {
+			return ct.token()
+		},
+		"csrfField": func() string {
+			return fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, router.CsrfFormField, ct.token())
+		},
+	})
+	return ct, nil
+}
+
+func releaseContextTemplate(tmpl *template.Template, ct *contextTemplate) {
+	ct.token = nil
+	if pool, ok := contextPools.Load(tmpl); ok {
+		pool.(*sync.Pool).Put(ct)
+	}
 }
 
 func FileTemplate[Rp router.RoutableProtocol, D any](c *router.Context[Rp], tplPath string) *router.Responser[Rp, D, D] {
@@ -38,7 +91,7 @@ func fileTemplate(tplPath string, key string) *template.Template {
 		if !fs.ValidPath(tplPath) {
 			panic("invalid template path: " + tplPath)
 		}
-		return template.Must(template.ParseFiles(tplPath))
+		return template.Must(template.New(filepath.Base(tplPath)).Funcs(contextFuncs).ParseFiles(tplPath))
 	})
 }
 
@@ -53,7 +106,7 @@ func textTemplate(text string, key string) *template.Template {
 		key = textMd5(text)
 	}
 	return TplConfig.templateOrGen(key, func() *template.Template {
-		tpl, err := template.New(key).Parse(text)
+		tpl, err := template.New(key).Funcs(contextFuncs).Parse(text)
 		if err != nil {
 			panic(err.Error())
 		}
@@ -63,6 +116,8 @@ func textTemplate(text string, key string) *template.Template {
 
 type TemplateEngine[D any] struct {
 	*template.Template
+	// token is the csrf token getter of the request, the template will be executed with the context functions if set
+	token func() string
 }
 
 func (t TemplateEngine[D]) Serialize(resp D) ([]byte, error) {
@@ -78,6 +133,15 @@ func (t TemplateEngine[D]) Serialize(resp D) ([]byte, error) {
 		}
 	}
 	buff := new(bytes.Buffer)
+	if t.token != nil {
+		ct, err := acquireContextTemplate(tpl)
+		if err != nil {
+			return nil, err
+		}
+		defer releaseContextTemplate(tpl, ct)
+		ct.token = t.token
+		tpl = ct.Template
+	}
 	if err := tpl.Execute(buff, resp); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,253 @@
+// Package idempotency makes the retried unsafe requests execute only once, the completed response of a request with
+// an idempotency key is stored, and replayed to the later requests with the same key, the concurrent duplicates get the
+// conflict error. The key is taken from the `Idempotency-Key` header of HTTP, or the headers field of the flex, json
+// and pb packages, and it is scoped by the session user and the api.
+//
+//	idem := idempotency.New[*proto.HttpProtocol](idempotency.NewMemoryStore())
+//	proto.HttpRouter.PushApi(idempotency.Enable(router.Path("order").ByMethod(proto.HttpPost), 0), controller)
+//	proto.HttpRouter.Raw().SetBefore("*", router.Chain(sessions.Before, idem.Before)).
+//		SetAfter("*", router.Chain(sessions.After, idem.After))
+//
+// The `Before` should be the last before hook and the `After` should be the last after hook, so that the key will not
+// be left reserved by an interrupted request, and the response sid set by other hooks could be stored.
+package idempotency
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+)
+
+const (
+	CodeInvalidKey = 400
+	CodeConflict   = 409
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderReplayed       = "Idempotent-Replayed"
+)
+
+const (
+	// MaxKeyLength is the max length of the idempotency key, a uuid is recommended.
+	MaxKeyLength = 255
+	// DefaultTtl is the default duration to keep the completed responses.
+	DefaultTtl = 24 * time.Hour
+	// DefaultLockTtl is the default duration to reserve a key for a running request, it should be longer than the
+	// longest request, or else the duplicates could execute again after it expired.
+	DefaultLockTtl = time.Minute
+)
+
+const (
+	extraTtlKey = "$#IDEMPOTENCY#"
+	ctxKey      = "$idempotencyKey"
+)
+
+// ErrReservationLost is returned by the stores on completing if the key is no longer reserved by the token, such as the
+// reservation expired and the key was reserved by a duplicate.
+var ErrReservationLost = errors.New("idempotency reservation lost")
+
+// Record is the stored result of a request.
+//
+// Fields:
+//   - Done: Whether the request has completed, the key is reserved by a running request if not.
+//   - Code: The error code of the response.
+//   - Message: The error message of the response.
+//   - Status: The explicitly specified HTTP status code.
+//   - ContentType: The content type of the response.
+//   - RespSid: The response sid, such as a new sid of the login response.
+//   - Body: The response body.
+type Record struct {
+	Done        bool   `json:"done"`
+	Code        int    `json:"code,omitempty"`
+	Message     string `json:"msg,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"ct,omitempty"`
+	RespSid     string `json:"sid,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Store keeps the records, the MemoryStore keeps them in the process, and the `redises.Store` shares them across the
+// nodes.
+type Store interface {
+	// Reserve reserves the key with the token for a running request until the ttl expired, it returns the existing
+	// record if the key has been reserved or completed, or nil if reserved successfully.
+	Reserve(key string, token string, ttl time.Duration) (*Record, error)
+	// Complete stores the completed record of the key if it is still reserved by the token, it will be kept until the
+	// ttl expired, or else the ErrReservationLost is returned.
+	Complete(key string, token string, record *Record, ttl time.Duration) error
+	// Release deletes the key if it is still reserved by the token, so that the request could be retried.
+	Release(key string, token string) error
+}
+
+// Enable enables the idempotency of the api, the completed responses will be kept for the ttl, or the default ttl of
+// the middleware if the ttl is zero.
+//
+//	proto.HttpRouter.PushApi(idempotency.Enable(router.Path("order").ByMethod(proto.HttpPost), 0), controller)
+func Enable(api router.Api, ttl time.Duration) router.Api {
+	return api.With(extraTtlKey, ttl)
+}
+
+// Middleware reserves the idempotency keys before the controllers, and stores the responses after them. Only the
+// responses of the succeeded requests and the openly errors are stored, the keys of other failed requests will be
+// released, so that they could be retried. The requests will be executed without the idempotency if the store failed.
+type Middleware[Rp router.RoutableProtocol] struct {
+	store   Store
+	ttl     time.Duration
+	lockTtl time.Duration
+}
+
+func New[Rp router.RoutableProtocol](store Store) *Middleware[Rp] {
+	return &Middleware[Rp]{store: store, ttl: DefaultTtl, lockTtl: DefaultLockTtl}
+}
+
+// SetTtl specifies the default duration to keep the completed responses.
+func (m *Middleware[Rp]) SetTtl(ttl time.Duration) *Middleware[Rp] {
+	m.ttl = ttl
+	return m
+}
+
+// SetLockTtl specifies the duration to reserve a key for a running request.
+func (m *Middleware[Rp]) SetLockTtl(ttl time.Duration) *Middleware[Rp] {
+	m.lockTtl = ttl
+	return m
+}
+
+// key scopes the idempotency key by the uid of the session user, or the sid, or the client host, and the api, so that
+// a client could not replay the response of others.
+func (m *Middleware[Rp]) key(ctx *router.Context[Rp], idemKey string) string {
+	scope := ""
+	if us, ok := ctx.Rp.Session().(interface{ Uid() (uint64, error) }); ok {
+		if uid, err := us.Uid(); err == nil {
+			scope = "uid=" + strconv.FormatUint(uid, 10)
+		}
+	}
+	if scope == "" {
+		if sid := ctx.Rp.Sid(); sid != "" {
+			scope = "sid=" + sid
+		} else if addr := router.RemoteAddr(ctx.Rp); addr != "" {
+			host, _, err := net.SplitHostPort(addr)
+			scope = "addr=" + util.Iif(err == nil, host, addr)
+		}
+	}
+	hash := sha256.Sum256([]byte(scope + "|" + ctx.Api.Path + "|" + idemKey))
+	return hex.EncodeToString(hash[:])
+}
+
+// reservation is the reserved key of the running request, the token tells it from the reservations of the duplicates
+// after it expired.
+type reservation struct {
+	key   string
+	token string
+}
+
+// newToken generates a random token to identify the reservation.
+func newToken() string {
+	bts := make([]byte, 16)
+	_, _ = rand.Read(bts)
+	return hex.EncodeToString(bts)
+}
+
+// Before reserves the idempotency key of the request, replays the stored response if completed, or rejects the
+// request if the key is reserved by a running one.
+func (m *Middleware[Rp]) Before(ctx *router.Context[Rp]) error {
+	if ctx.Api == nil || ctx.Api.ExtraBy(extraTtlKey) == nil {
+		return nil
+	}
+	idemKey := router.RequestHeader(ctx.Rp, HeaderIdempotencyKey)
+	if idemKey == "" {
+		return nil
+	} else if len(idemKey) > MaxKeyLength {
+		return util.Openly(CodeInvalidKey, "Idempotency key is too long, max %d characters", MaxKeyLength)
+	}
+	res := reservation{key: m.key(ctx, idemKey), token: newToken()}
+	record, err := m.store.Reserve(res.key, res.token, m.lockTtl)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Idempotency store failed, the request is executed directly: %s", err.Error()))
+		return nil
+	} else if record == nil {
+		ctx.Rp.SetCtxData(ctxKey, res)
+		return nil
+	} else if !record.Done {
+		return util.Openly(CodeConflict, "A request with the same idempotency key is in progress")
+	}
+	replay(ctx.Rp, record)
+	return router.ErrHandled
+}
+
+// After stores the response of the reserved request, or releases the key if the request failed unexpectedly.
+func (m *Middleware[Rp]) After(ctx *router.Context[Rp]) error {
+	r, ok := ctx.Rp.CtxData(ctxKey)
+	if !ok {
+		return nil
+	}
+	res := r.(reservation)
+	record, ok := m.record(ctx.Rp)
+	if !ok {
+		if err := m.store.Release(res.key, res.token); err != nil {
+			slog.Warn(fmt.Sprintf("Idempotency key release failed: %s", err.Error()))
+		}
+		return nil
+	}
+	ttl, _ := ctx.Api.ExtraBy(extraTtlKey).(time.Duration)
+	if err := m.store.Complete(res.key, res.token, record, util.Iif(ttl > 0, ttl, m.ttl)); err != nil {
+		slog.Warn(fmt.Sprintf("Idempotency record store failed: %s", err.Error()))
+	}
+	return nil
+}
+
+// record builds the record of the response, it returns false if the response should not be stored, such as the
+// unexpected errors which could be transient, or the streaming responses which were not buffered.
+func (m *Middleware[Rp]) record(rp Rp) (*Record, bool) {
+	record := &Record{Done: true, RespSid: rp.RespSid()}
+	if err := rp.Error(); err != nil {
+		var e util.Error
+		if !errors.As(err, &e) || !e.IsOpenly() {
+			return nil, false
+		}
+		record.Code, record.Message = e.Code, e.Message
+	}
+	if st, ok := any(rp).(interface{ Streaming() bool }); ok && st.Streaming() {
+		return nil, false
+	}
+	if bg, ok := any(rp).(interface{ Buffered() []byte }); ok {
+		record.Body = bg.Buffered()
+	}
+	if sg, ok := any(rp).(interface{ Status() int }); ok {
+		record.Status = sg.Status()
+	}
+	if ct, ok := rp.CtxData(router.HttpContentTypeKey); ok {
+		record.ContentType, _ = ct.(string)
+	}
+	return record, true
+}
+
+func replay(rp router.RoutableProtocol, record *Record) {
+	_, _ = rp.Write(record.Body)
+	if record.RespSid != "" {
+		rp.SetRespSid(record.RespSid)
+	}
+	if record.ContentType != "" {
+		rp.SetCtxData(router.HttpContentTypeKey, record.ContentType)
+	}
+	if ss, ok := rp.(interface{ SetStatus(code int) }); ok && record.Status > 0 {
+		ss.SetStatus(record.Status)
+	}
+	if hs, ok := rp.(interface {
+		SetHeader(key string, value string)
+	}); ok {
+		hs.SetHeader(HeaderReplayed, "true")
+	}
+	if record.Code != 0 || record.Message != "" {
+		rp.SetError(util.Openly(record.Code, "%s", record.Message))
+	}
+}
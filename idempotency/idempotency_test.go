@@ -0,0 +1,104 @@
+package idempotency_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/idempotency"
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+)
+
+func TestMiddleware(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+	idem := idempotency.New[*proto.HttpProtocol](store)
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	executed := 0
+	r.PushApi(idempotency.Enable(router.Path("order").ByMethod(proto.HttpPost), 0), func(h *proto.Http) {
+		executed++
+		h.Rp.SetStatus(http.StatusCreated)
+		_, _ = h.WriteString("order " + strconv.Itoa(executed))
+	}).PushApi(idempotency.Enable(router.Path("refund").ByMethod(proto.HttpPost), time.Minute), func(h *proto.Http) {
+		executed++
+		h.SetError(util.Openly(422, "refund rejected"))
+	}).PushApi(idempotency.Enable(router.Path("pay").ByMethod(proto.HttpPost), 0), func(h *proto.Http) {
+		executed++
+		h.SetError(util.Closed0("gateway timeout"))
+	}).Post("plain", func(h *proto.Http) {
+		executed++
+	})
+	entered, release := make(chan struct{}), make(chan struct{})
+	r.PushApi(idempotency.Enable(router.Path("slow").ByMethod(proto.HttpPost), 0), func(h *proto.Http) {
+		entered <- struct{}{}
+		<-release
+	})
+	r.Raw().SetBefore("*", idem.Before).SetAfter("*", idem.After)
+
+	do := func(path string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+path, nil)
+		req.Header.Set(proto.HeaderSidKey, "sid")
+		if key != "" {
+			req.Header.Set(idempotency.HeaderIdempotencyKey, key)
+		}
+		w := httptest.NewRecorder()
+		r.Route(w, req)
+		return w
+	}
+
+	first, second := do("order", "k1"), do("order", "k1")
+	if executed != 1 || second.Code != http.StatusCreated || second.Body.String() != first.Body.String() || second.Header().Get(idempotency.HeaderReplayed) != "true" {
+		t.Fatalf("expected the order replayed, executed %d, got %d %q", executed, second.Code, second.Body.String())
+	}
+	if do("order", "k2"); executed != 2 {
+		t.Fatalf("expected a new key executed, executed %d", executed)
+	}
+	do("refund", "k1")
+	if w := do("refund", "k1"); w.Code != 422 || executed != 3 {
+		t.Fatalf("expected the openly error replayed, executed %d", executed)
+	}
+	do("pay", "k1")
+	if do("pay", "k1"); executed != 5 {
+		t.Fatalf("expected the unexpected error retried, executed %d", executed)
+	}
+	do("plain", "k1")
+	if do("plain", "k1"); executed != 7 {
+		t.Fatalf("expected the api without idempotency executed, executed %d", executed)
+	}
+
+	// a duplicate of the running request gets the conflict error
+	go func() { do("slow", "k1") }()
+	<-entered
+	if w := do("slow", "k1"); w.Code != idempotency.CodeConflict {
+		t.Fatalf("expected the concurrent duplicate rejected, got %d", w.Code)
+	}
+	release <- struct{}{}
+}
+
+func TestMemoryStoreReservationLost(t *testing.T) {
+	now := time.Now()
+	store := idempotency.NewMemoryStore().SetClock(func() time.Time { return now })
+	_, _ = store.Reserve("key", "t1", time.Minute)
+	// the reservation expired, and the key was reserved by a duplicate
+	now = now.Add(time.Minute)
+	if record, _ := store.Reserve("key", "t2", time.Minute); record != nil {
+		t.Fatalf("expected the key reserved by the duplicate, got %v", record)
+	}
+	if err := store.Complete("key", "t1", &idempotency.Record{Done: true}, time.Hour); !errors.Is(err, idempotency.ErrReservationLost) {
+		t.Fatalf("expected the reservation lost, got %v", err)
+	}
+	_ = store.Release("key", "t1")
+	if record, _ := store.Reserve("key", "t3", time.Minute); record == nil || record.Done {
+		t.Fatalf("expected the duplicate still running, got %v", record)
+	}
+	if err := store.Complete("key", "t2", &idempotency.Record{Done: true}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ := store.Reserve("key", "t3", time.Minute); record == nil || !record.Done {
+		t.Fatalf("expected the completed record, got %v", record)
+	}
+}
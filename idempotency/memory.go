@@ -0,0 +1,97 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	record   *Record
+	token    string
+	expireAt time.Time
+}
+
+// MemoryStore keeps the records in the process, it is suitable for the single-node deployments.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry), now: time.Now}
+}
+
+// SetClock replaces the clock, it is used to simulate the time passing in tests.
+func (m *MemoryStore) SetClock(now func() time.Time) *MemoryStore {
+	m.now = now
+	return m
+}
+
+func (m *MemoryStore) Reserve(key string, token string, ttl time.Duration) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if entry, ok := m.entries[key]; ok && entry.expireAt.After(now) {
+		return entry.record, nil
+	}
+	m.entries[key] = &memoryEntry{record: &Record{}, token: token, expireAt: now.Add(ttl)}
+	return nil, nil
+}
+
+// reserved reports whether the key is reserved by the token and not expired.
+func (m *MemoryStore) reserved(key string, token string) bool {
+	entry, ok := m.entries[key]
+	return ok && !entry.record.Done && entry.token == token && entry.expireAt.After(m.now())
+}
+
+func (m *MemoryStore) Complete(key string, token string, record *Record, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.reserved(key, token) {
+		return ErrReservationLost
+	}
+	m.entries[key] = &memoryEntry{record: record, expireAt: m.now().Add(ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Release(key string, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reserved(key, token) {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Sweep deletes the expired entries and returns the count.
+func (m *MemoryStore) Sweep() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now, count := m.now(), 0
+	for key, entry := range m.entries {
+		if !entry.expireAt.After(now) {
+			delete(m.entries, key)
+			count++
+		}
+	}
+	return count
+}
+
+// StartSweeper sweeps the expired entries periodically in background until the stop function called.
+func (m *MemoryStore) StartSweeper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.Sweep()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
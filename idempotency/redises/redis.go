@@ -0,0 +1,102 @@
+package redises
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.drunkce.com/dce/idempotency"
+)
+
+const DefaultKeyPrefix = "dceidem"
+
+// reserveScript returns the existing record, or reserves the key with a running record.
+// KEYS: record key
+// ARGV: running record, ttl milliseconds
+// Returns: the existing record or nil
+var reserveScript = redis.NewScript(`
+local record = redis.call('GET', KEYS[1])
+if record then
+	return record
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return false
+`)
+
+// settleScript completes or releases the key if it is still reserved by the running record.
+// KEYS: record key
+// ARGV: running record, completed record or empty to release, ttl milliseconds
+// Returns: 1 if settled, or else 0
+var settleScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == '' then
+	redis.call('DEL', KEYS[1])
+else
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+end
+return 1
+`)
+
+// running is the record of a running request, the token identifies the reservation.
+type running struct {
+	idempotency.Record
+	Token string `json:"token"`
+}
+
+func runningRecord(token string) []byte {
+	seq, _ := json.Marshal(&running{Token: token})
+	return seq
+}
+
+// Store shares the records across the nodes via Redis, the records are encoded as json.
+type Store struct {
+	redis  redis.UniversalClient
+	ctx    context.Context
+	prefix string
+}
+
+func NewStore(rdb redis.UniversalClient) *Store {
+	return &Store{redis: rdb, ctx: context.Background(), prefix: DefaultKeyPrefix}
+}
+
+// SetKeyPrefix specifies the prefix of the keys.
+func (s *Store) SetKeyPrefix(prefix string) *Store {
+	s.prefix = prefix
+	return s
+}
+
+func (s *Store) Reserve(key string, token string, ttl time.Duration) (*idempotency.Record, error) {
+	seq, err := reserveScript.Run(s.ctx, s.redis, []string{s.prefix + ":" + key}, runningRecord(token), max(ttl.Milliseconds(), 1)).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var record idempotency.Record
+	if err = json.Unmarshal([]byte(seq), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *Store) Complete(key string, token string, record *idempotency.Record, ttl time.Duration) error {
+	seq, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	settled, err := settleScript.Run(s.ctx, s.redis, []string{s.prefix + ":" + key}, runningRecord(token), seq, max(ttl.Milliseconds(), 1)).Int()
+	if err != nil {
+		return err
+	} else if settled == 0 {
+		return idempotency.ErrReservationLost
+	}
+	return nil
+}
+
+func (s *Store) Release(key string, token string) error {
+	return settleScript.Run(s.ctx, s.redis, []string{s.prefix + ":" + key}, runningRecord(token), "", 0).Err()
+}
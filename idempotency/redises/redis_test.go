@@ -0,0 +1,64 @@
+package redises_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.drunkce.com/dce/idempotency"
+	"go.drunkce.com/dce/idempotency/redises"
+)
+
+func TestStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := redises.NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	if record, err := store.Reserve("key", "t1", time.Minute); err != nil || record != nil {
+		t.Fatalf("expected the key reserved, got %v, %v", record, err)
+	}
+	if record, err := store.Reserve("key", "t2", time.Minute); err != nil || record == nil || record.Done {
+		t.Fatalf("expected a running record, got %v, %v", record, err)
+	}
+	if err := store.Complete("key", "t1", &idempotency.Record{Done: true, Code: 422, Body: []byte("body")}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := store.Reserve("key", "t2", time.Minute); err != nil || !record.Done || record.Code != 422 || string(record.Body) != "body" {
+		t.Fatalf("expected the completed record, got %v, %v", record, err)
+	}
+	if err := store.Release("key", "t1"); err != nil {
+		t.Fatal(err)
+	} else if !mr.Exists(redises.DefaultKeyPrefix + ":key") {
+		t.Fatal("expected the completed record not released")
+	}
+	mr.Del(redises.DefaultKeyPrefix + ":key")
+	if record, err := store.Reserve("key", "t1", time.Minute); err != nil || record != nil {
+		t.Fatalf("expected the key reserved again, got %v, %v", record, err)
+	}
+	if err := store.Release("key", "t1"); err != nil {
+		t.Fatal(err)
+	} else if mr.Exists(redises.DefaultKeyPrefix + ":key") {
+		t.Fatal("expected the reservation released")
+	}
+}
+
+func TestStoreReservationLost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := redises.NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	_, _ = store.Reserve("key", "t1", time.Minute)
+	// the reservation expired, and the key was reserved by a duplicate
+	mr.FastForward(time.Minute)
+	if record, _ := store.Reserve("key", "t2", time.Minute); record != nil {
+		t.Fatalf("expected the key reserved by the duplicate, got %v", record)
+	}
+	if err := store.Complete("key", "t1", &idempotency.Record{Done: true}, time.Hour); !errors.Is(err, idempotency.ErrReservationLost) {
+		t.Fatalf("expected the reservation lost, got %v", err)
+	}
+	_ = store.Release("key", "t1")
+	if record, _ := store.Reserve("key", "t3", time.Minute); record == nil || record.Done {
+		t.Fatalf("expected the duplicate still running, got %v", record)
+	}
+	if err := store.Complete("key", "t2", &idempotency.Record{Done: true}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
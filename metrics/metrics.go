@@ -0,0 +1,316 @@
+// Package metrics records the counters, gauges and histograms, and exposes them in the Prometheus text format without
+// any third-party dependency. The routers could be instrumented to record the requests per api pattern, the connection
+// counts of the long connection routers and the timings of the session store operations could be watched too.
+//
+//	metrics.Instrument(metrics.DefaultRegistry, proto.HttpRouter.Raw(), "http")
+//	metrics.Instrument(metrics.DefaultRegistry, flex.WebsocketRouter.Router, flex.WebsocketRouter.Id())
+//	metrics.WatchConnections(metrics.DefaultRegistry, flex.WebsocketRouter)
+//	metrics.WatchSessions(metrics.DefaultRegistry)
+//	proto.HttpRouter.Get("metrics", metrics.Expose[*proto.HttpProtocol](metrics.DefaultRegistry))
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets in seconds, they are suitable for the request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry is the registry used by the examples and the most applications.
+var DefaultRegistry = NewRegistry()
+
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry keeps the metrics in the registered order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register registers the metric, or returns the registered one with the same name, it panics if the registered one is
+// not the same kind.
+func register[M metric](r *Registry, name string, create func() M) M {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if index := slices.IndexFunc(r.metrics, func(m metric) bool { return m.name() == name }); index > -1 {
+		if m, ok := r.metrics[index].(M); ok {
+			return m
+		}
+		panic(fmt.Sprintf(`Metric "%s" was registered as another kind`, name))
+	}
+	m := create()
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// Counter registers a counter, or returns the registered one with the same name.
+func (r *Registry) Counter(name string, help string, labels ...string) *Counter {
+	return register(r, name, func() *Counter {
+		return &Counter{vec: newVec[float64](name, help, labels)}
+	})
+}
+
+// Gauge registers a gauge, or returns the registered one with the same name.
+func (r *Registry) Gauge(name string, help string, labels ...string) *Gauge {
+	return register(r, name, func() *Gauge {
+		return &Gauge{vec: newVec[float64](name, help, labels)}
+	})
+}
+
+// GaugeFunc registers a gauge whose values are collected by the function on exposing, the keys of the returned map are
+// the values of the only label, or it should return a map with an empty key if the label is not specified. The
+// functions registered with the same name will be merged.
+func (r *Registry) GaugeFunc(name string, help string, label string, collect func() map[string]float64) {
+	g := register(r, name, func() *gaugeFunc {
+		return &gaugeFunc{metricName: name, help: help, label: label}
+	})
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.collects = append(g.collects, collect)
+}
+
+// Histogram registers a histogram with the buckets of upper bounds, or returns the registered one with the same name.
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return register(r, name, func() *Histogram {
+		buckets = slices.Sorted(slices.Values(buckets))
+		return &Histogram{vec: newVec[*histogramValue](name, help, labels), buckets: buckets}
+	})
+}
+
+// WriteText writes all the metrics in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// vec keeps the values of every label values combination.
+type vec[V any] struct {
+	metricName string
+	help       string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]V
+	labelsOf   map[string][]string
+}
+
+func newVec[V any](name string, help string, labels []string) vec[V] {
+	return vec[V]{metricName: name, help: help, labels: labels, values: make(map[string]V), labelsOf: make(map[string][]string)}
+}
+
+func (v *vec[V]) name() string {
+	return v.metricName
+}
+
+// with calls the function with the value of the label values under the lock.
+func (v *vec[V]) with(labelValues []string, init func() V, fn func(value *V)) {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf(`Metric "%s" requires %d label values, got %d`, v.metricName, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	value, ok := v.values[key]
+	if !ok {
+		value = init()
+		v.labelsOf[key] = slices.Clone(labelValues)
+	}
+	fn(&value)
+	v.values[key] = value
+}
+
+// each calls the function with the sorted series under the lock.
+func (v *vec[V]) each(fn func(labelValues []string, value V)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range slices.Sorted(maps.Keys(v.values)) {
+		fn(v.labelsOf[key], v.values[key])
+	}
+}
+
+func (v *vec[V]) writeHead(w *bufio.Writer, kind string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.metricName, escapeHelp(v.help), v.metricName, kind)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	vec[float64]
+}
+
+// Add adds the delta, it should not be negative.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.with(labelValues, func() float64 { return 0 }, func(value *float64) {
+		*value += delta
+	})
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeHead(w, "counter")
+	c.each(func(labelValues []string, value float64) {
+		writeSample(w, c.metricName, c.labels, labelValues, "", "", value)
+	})
+}
+
+// Gauge is a value which could go up and down.
+type Gauge struct {
+	vec[float64]
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.with(labelValues, func() float64 { return 0 }, func(v *float64) {
+		*v = value
+	})
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.with(labelValues, func() float64 { return 0 }, func(v *float64) {
+		*v += delta
+	})
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeHead(w, "gauge")
+	g.each(func(labelValues []string, value float64) {
+		writeSample(w, g.metricName, g.labels, labelValues, "", "", value)
+	})
+}
+
+type gaugeFunc struct {
+	metricName string
+	help       string
+	label      string
+	mu         sync.Mutex
+	collects   []func() map[string]float64
+}
+
+func (g *gaugeFunc) name() string {
+	return g.metricName
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.metricName, escapeHelp(g.help), g.metricName)
+	values := make(map[string]float64)
+	g.mu.Lock()
+	for _, collect := range g.collects {
+		maps.Copy(values, collect())
+	}
+	g.mu.Unlock()
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if g.label == "" {
+			writeSample(w, g.metricName, nil, nil, "", "", values[key])
+		} else {
+			writeSample(w, g.metricName, []string{g.label}, []string{key}, "", "", values[key])
+		}
+	}
+}
+
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts the observations in the buckets.
+type Histogram struct {
+	vec[*histogramValue]
+	buckets []float64
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.with(labelValues, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(h.buckets))}
+	}, func(hv **histogramValue) {
+		if i, _ := slices.BinarySearch(h.buckets, value); i < len(h.buckets) {
+			(*hv).counts[i]++
+		}
+		(*hv).sum += value
+		(*hv).count++
+	})
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.writeHead(w, "histogram")
+	h.each(func(labelValues []string, hv *histogramValue) {
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += hv.counts[i]
+			writeSample(w, h.metricName+"_bucket", h.labels, labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.metricName+"_bucket", h.labels, labelValues, "le", "+Inf", float64(hv.count))
+		writeSample(w, h.metricName+"_sum", h.labels, labelValues, "", "", hv.sum)
+		writeSample(w, h.metricName+"_count", h.labels, labelValues, "", "", float64(hv.count))
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, labelValues []string, extraLabel string, extraValue string, value float64) {
+	_, _ = w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		_ = w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = fmt.Fprintf(w, `%s="%s"`, label, escapeLabel(labelValues[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = fmt.Fprintf(w, `%s="%s"`, extraLabel, extraValue)
+		}
+		_ = w.WriteByte('}')
+	}
+	_ = w.WriteByte(' ')
+	_, _ = w.WriteString(formatFloat(value))
+	_ = w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.drunkce.com/dce/metrics"
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+type connCounter int
+
+func (c connCounter) Id() string {
+	return "flex-tcp"
+}
+
+func (c connCounter) ConnCount() int {
+	return int(c)
+}
+
+func TestInstrument(t *testing.T) {
+	registry := metrics.NewRegistry()
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	r.Get("goods/{id}", func(h *proto.Http) {
+		_, _ = h.WriteString("goods")
+	}).Get("fail", func(h *proto.Http) {
+		h.SetError(util.Openly(422, "failed"))
+	}).Get("metrics", metrics.Expose[*proto.HttpProtocol](registry))
+	metrics.Instrument(registry, r.Raw(), "http")
+	metrics.WatchConnections(registry, connCounter(3))
+	cancel := metrics.WatchSessions(registry)
+	defer cancel()
+
+	for _, path := range []string{"goods/1", "goods/2", "fail", "missing"} {
+		r.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/"+path, nil))
+	}
+	sess, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+	_ = sess.Set("k", "v")
+	var missing string
+	_ = sess.Get("missing", &missing)
+
+	w := httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	text := w.Body.String()
+	for _, expected := range []string{
+		"# TYPE dce_requests_total counter\n",
+		`dce_requests_total{router="http",api="goods/{id}",code="0"} 2`,
+		`dce_requests_total{router="http",api="fail",code="422"} 1`,
+		`dce_requests_total{router="http",api="-",code="404"} 1`,
+		`dce_request_duration_seconds_bucket{router="http",api="goods/{id}",le="+Inf"} 2`,
+		`dce_request_duration_seconds_count{router="http",api="fail"} 1`,
+		`dce_requests_in_flight{router="http"} 1`,
+		`dce_connections{router="flex-tcp"} 3`,
+		`dce_session_operation_duration_seconds_count{op="set"} 1`,
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in the exposition:\n%s", expected, text)
+		}
+	}
+	if strings.Contains(text, "dce_session_operation_errors_total{") {
+		t.Errorf("the missing fields should not be counted as errors:\n%s", text)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != metrics.ContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	registry := metrics.NewRegistry()
+	h := registry.Histogram("latency", "Latency with \"quotes\".", []float64{1, 0.5}, "path")
+	for _, v := range []float64{0.2, 0.5, 0.7, 3} {
+		h.Observe(v, "a\"b")
+	}
+	var sb strings.Builder
+	_ = registry.WriteText(&sb)
+	expected := `# HELP latency Latency with "quotes".
+# TYPE latency histogram
+latency_bucket{path="a\"b",le="0.5"} 2
+latency_bucket{path="a\"b",le="1"} 3
+latency_bucket{path="a\"b",le="+Inf"} 4
+latency_sum{path="a\"b"} 4.4
+latency_count{path="a\"b"} 4
+`
+	if sb.String() != expected {
+		t.Fatalf("unexpected exposition:\n%s", sb.String())
+	}
+}
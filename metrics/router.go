@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+// UnmatchedApi is the api label of the requests not located any api.
+const UnmatchedApi = "-"
+
+// Instrument records the requests of the router by the api pattern and the response code, the code is 0 for the
+// succeeded requests, or the explicitly specified HTTP status, or the code of the openly error, or 503 for the others.
+//
+// The recorded metrics:
+//   - dce_requests_total{router, api, code}: The count of the requests.
+//   - dce_request_duration_seconds{router, api}: The latency histogram of the requests.
+//   - dce_requests_in_flight{router}: The count of the requests being handled.
+func Instrument[Rp router.RoutableProtocol](registry *Registry, r *router.Router[Rp], name string) {
+	total := registry.Counter("dce_requests_total", "Total routed requests.", "router", "api", "code")
+	duration := registry.Histogram("dce_request_duration_seconds", "Latencies of the routed requests.", DefBuckets, "router", "api")
+	inFlight := registry.Gauge("dce_requests_in_flight", "Requests being handled.", "router")
+	inFlight.Add(0, name)
+	r.Intercept(func(ctx *router.Context[Rp]) func() {
+		start := time.Now()
+		inFlight.Add(1, name)
+		return func() {
+			inFlight.Add(-1, name)
+			api := UnmatchedApi
+			if ctx.Api != nil {
+				api = ctx.Api.Path
+			}
+			total.Inc(name, api, responseCode(ctx.Rp))
+			duration.Observe(time.Since(start).Seconds(), name, api)
+		}
+	})
+}
+
+func responseCode(rp router.RoutableProtocol) string {
+	if sg, ok := rp.(interface{ Status() int }); ok && sg.Status() > 0 {
+		return strconv.Itoa(sg.Status())
+	} else if err := rp.Error(); err != nil {
+		code, _ := util.ResponseUnits(err)
+		return strconv.Itoa(code)
+	}
+	return "0"
+}
+
+// ConnCounter counts the live connections of a router, such as the `proto.ConnectorMappingManager`.
+type ConnCounter interface {
+	Id() string
+	ConnCount() int
+}
+
+// WatchConnections collects the live connection counts of the routers on exposing, as the dce_connections{router}.
+func WatchConnections(registry *Registry, counters ...ConnCounter) {
+	registry.GaugeFunc("dce_connections", "Live connections of the long connection routers.", "router", func() map[string]float64 {
+		counts := make(map[string]float64, len(counters))
+		for _, c := range counters {
+			counts[c.Id()] = float64(c.ConnCount())
+		}
+		return counts
+	})
+}
+
+// WatchSessions records the session store operations until the returned function called.
+//
+// The recorded metrics:
+//   - dce_session_operation_duration_seconds{op}: The latency histogram of the operations.
+//   - dce_session_operation_errors_total{op}: The count of the failed operations, the silent errors such as the missing
+//     fields are not counted.
+func WatchSessions(registry *Registry) (cancel func()) {
+	duration := registry.Histogram("dce_session_operation_duration_seconds", "Latencies of the session store operations.",
+		[]float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25}, "op")
+	errs := registry.Counter("dce_session_operation_errors_total", "Failed session store operations.", "op")
+	return session.Observe(func(op session.Operation) {
+		duration.Observe(op.Duration.Seconds(), op.Name)
+		var e util.Error
+		if op.Err != nil && !(errors.As(op.Err, &e) && e.Type == util.ErrorSilent) {
+			errs.Inc(op.Name)
+		}
+	})
+}
+
+// Expose returns a controller to expose the metrics of the registry in the Prometheus text format.
+//
+//	proto.HttpRouter.Get("metrics", metrics.Expose[*proto.HttpProtocol](metrics.DefaultRegistry))
+func Expose[Rp router.RoutableProtocol](registry *Registry) func(ctx *router.Context[Rp]) {
+	return func(ctx *router.Context[Rp]) {
+		ctx.Rp.SetCtxData(router.HttpContentTypeKey, ContentType)
+		if err := registry.WriteText(ctx); err != nil {
+			ctx.SetError(err)
+		}
+	}
+}
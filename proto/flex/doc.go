@@ -7,10 +7,10 @@ Protocol format:
 	 0               1               .               .               .
 	 0 1 2 3 4 5 6 7 0 . . . . . . . . . . . . . . . . . . . . . . . . . . . . . . .
 	+-+-+-+-+-+-+-+-+- - - - - - - - -  - - - - - - - - - - - - - - - - - - - - - - |
-	|I|P|S|C|M|L|N|R| LEN of| LEN of| LEN of| LEN of|  ID   |  CODE |NumPath| same  |
-	|D|A|I|O|S|O|P|S| Path  | Sid   | Msg   |  Body |FlexNum|FlexNum|FlexNum| order |
-	|E|T|D|D|G|A|A|V|FlexNum|FlexNum|FlexNum|FlexNum| HEAD  | HEAD  | HEAD  |FlexNum|
-	|N|H| |E| |D|T| | HEAD  | HEAD  | HEAD  | HEAD  |       |       |       | BODY  |
+	|I|P|S|C|M|L|N|H| LEN of| LEN of| LEN of| LEN of|  ID   |  CODE |NumPath| same  |
+	|D|A|I|O|S|O|P|D| Path  | Sid   | Msg   |  Body |FlexNum|FlexNum|FlexNum| order |
+	|E|T|D|D|G|A|A|R|FlexNum|FlexNum|FlexNum|FlexNum| HEAD  | HEAD  | HEAD  |FlexNum|
+	|N|H| |E| |D|T|S| HEAD  | HEAD  | HEAD  | HEAD  |       |       |       | BODY  |
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+ - - - - - - - - - - - - - - - - - - - - - - - |
 	|      |     |     |                                                            |
 	| Path | Sid | Msg |                       Body Data ...                        |
@@ -25,6 +25,11 @@ Protocol format:
 	MSG: with error messages
 	LOAD: with payload data
 	NPAT: with a number Path
+	HDRS: with request headers
+
+	The custom fields passed to `SerializeWith` and `PackageDeserializeHeadWith` take the bits from the
+	`CustomFieldOffset` (8) in order. Breaking wire change: they took the bits from 7 before the HDRS added, so the
+	peers using custom fields should be upgraded together. The packages without custom fields are still compatible.
 
 	LEN of xxx FlexNum HEAD: The FlexNum HEAD of xxx's length
 	xxx FlexNum HEAD: The FlexNum HEAD of xxx number
@@ -32,6 +37,7 @@ Protocol format:
 	PATH part: the api Path. (No this part if the NPAT is set)
 	SID part: the session Id
 	MESG part: the error Msg
+	HDRS part: the request headers in the url query encoding, such as "Idempotency-Key=k1&traceparent=00-..."
 	Payload part: the payload data
 
 Definition of flexible length sequence numbers:
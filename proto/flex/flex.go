@@ -7,6 +7,7 @@ import (
 	"math"
 	"math/bits"
 	"net"
+	"net/url"
 	"reflect"
 	"slices"
 	"sync/atomic"
@@ -18,6 +19,7 @@ import (
 
 type PackageProtocol[Req any] struct {
 	router.Meta[Req]
+	router.RespondedNotifier
 	pkg *Package
 }
 
@@ -37,11 +39,22 @@ func (p *PackageProtocol[Req]) Body() ([]byte, error) {
 	return p.pkg.parseBody()
 }
 
+// ContentLength returns the length of the request body.
+func (p *PackageProtocol[Req]) ContentLength() int64 {
+	return int64(p.pkg.bodyLen)
+}
+
+// RequestHeader returns the request header value carried by the package, the key is case-insensitive.
+func (p *PackageProtocol[Req]) RequestHeader(key string) string {
+	return router.HeaderValue(p.pkg.Headers, key)
+}
+
 func (p *PackageProtocol[Req]) ClearBuffer() []byte {
 	p.pkg.Sid = p.RespSid()
 	p.pkg.Body = p.Meta.ClearBuffer()
 	code, message := p.ErrorUnits()
 	p.pkg.Code, p.pkg.Message = int32(code), message
+	p.pkg.Headers = nil
 	return p.pkg.Serialize()
 }
 
@@ -54,7 +67,7 @@ func NewPackageProtocolWithMeta[Req any](reader *bufio.Reader, meta router.Meta[
 	if err != nil {
 		return nil, err
 	}
-	return &PackageProtocol[Req]{meta, pkg}, nil
+	return &PackageProtocol[Req]{Meta: meta, pkg: pkg}, nil
 }
 
 type PackageField struct {
@@ -128,6 +141,54 @@ var baseFields = []*PackageField{
 	{"Code", reflect.Int32, DefaultPropertyGetter, DefaultPropertySetter},
 	{"Message", reflect.String, DefaultPropertyGetter, DefaultPropertySetter},
 	{"Body", reflect.Slice, DefaultPropertyGetter, DefaultPropertySetter},
+	// Headers takes the reserved bit 7 after Body, the packages without headers and custom fields are compatible with
+	// the old versions, but the custom fields were numbered from bit 7 before, see `CustomFieldOffset`
+	{"Headers", reflect.Map, headersGetter, headersSetter},
+}
+
+// CustomFieldOffset is the flag bit of the first custom field passed to `SerializeWith` and
+// `PackageDeserializeHeadWith`, the bits below it are reserved for the base fields. A new base field must not move the
+// custom field bits, it could only be added by a breaking wire change with the offset raised.
+//
+// Breaking: the custom fields were numbered from bit 7 before the headers took it, so the peers using custom fields
+// should be upgraded together.
+const CustomFieldOffset = 8
+
+func init() {
+	if len(baseFields) != CustomFieldOffset {
+		panic("flex: the base fields should take exactly the bits below CustomFieldOffset")
+	}
+}
+
+// headersGetter encodes the headers map as a url query string.
+func headersGetter(fc *PackageField, pkg *reflect.Value) (numHead *NumHead, textSeq []byte) {
+	headers, _ := pkg.FieldByName(fc.Field).Interface().(map[string]string)
+	if len(headers) == 0 {
+		return
+	}
+	values := make(url.Values, len(headers))
+	for k, v := range headers {
+		values.Set(k, v)
+	}
+	textSeq = []byte(values.Encode())
+	return Non0LenPackHead(uint(len(textSeq))), textSeq
+}
+
+func headersSetter(fc *PackageField, pkg *reflect.Value, nh *NumHead, nbSeq []byte, reader io.Reader) error {
+	seq := make([]byte, Non0LenParse(nh.Original, nbSeq))
+	if _, err := io.ReadFull(reader, seq); err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(seq))
+	if err != nil {
+		return err
+	}
+	headers := make(map[string]string, len(values))
+	for k := range values {
+		headers[k] = values.Get(k)
+	}
+	pkg.FieldByName(fc.Field).Set(reflect.ValueOf(headers))
+	return nil
 }
 
 type Package struct {
@@ -138,6 +199,7 @@ type Package struct {
 	Code    int32
 	Message string
 	Body    []byte
+	Headers map[string]string
 	bodyLen uint64
 	reader  *bufio.Reader
 }
@@ -148,7 +210,7 @@ func (p *Package) Serialize() []byte {
 
 func (p *Package) mergeFields(fields []*PackageField, pkg *reflect.Value) []*util.Tuple2[*PackageField, *reflect.Value] {
 	pe := reflect.ValueOf(p).Elem()
-	fullFields := make([]*util.Tuple2[*PackageField, *reflect.Value], 0, len(baseFields))
+	fullFields := make([]*util.Tuple2[*PackageField, *reflect.Value], 0, CustomFieldOffset+len(fields))
 	for _, f := range baseFields {
 		fullFields = append(fullFields, util.NewTuple2(f, &pe))
 	}
@@ -271,8 +333,7 @@ func PackageDeserializeHeadWith(reader *bufio.Reader, fields []*PackageField, pk
 	}
 
 	p := &Package{reader: reader}
-	pkgRef := reflect.ValueOf(p).Elem()
-	fullFields := p.mergeFields(fields, &pkgRef)
+	fullFields := p.mergeFields(fields, pkg)
 	if bitsLen > len(fullFields) {
 		return nil, util.Closed0(`Packet exception, flag overflow`)
 	}
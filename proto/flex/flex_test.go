@@ -8,6 +8,7 @@ import (
 	"math"
 	"math/bits"
 	"math/rand/v2"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -232,3 +233,41 @@ func bits7NumSerialize[U uint | uint64 | uint32 | uint16 | uint8](u64 U, bitsLen
 	}
 	return bit7Units
 }
+
+func TestPackage_Headers(t *testing.T) {
+	pkg := NewPackage("order", []byte("body"), "sid", -1)
+	pkg.Headers = map[string]string{"Idempotency-Key": "k1&=", "traceparent": "00-01"}
+	dePkg, err := PackageDeserialize(bufio.NewReader(bytes.NewReader(pkg.Serialize())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dePkg.Headers["Idempotency-Key"] != "k1&=" || dePkg.Headers["traceparent"] != "00-01" || string(dePkg.Body) != "body" || dePkg.Sid != "sid" {
+		t.Fatalf("unexpected package: %+v", dePkg)
+	}
+	if dePkg, _ = PackageDeserialize(bufio.NewReader(bytes.NewReader(NewPackage("order", nil, "", -1).Serialize()))); dePkg.Headers != nil {
+		t.Fatalf("expected no headers, got %v", dePkg.Headers)
+	}
+}
+
+func TestPackage_CustomFieldOffset(t *testing.T) {
+	type extension struct {
+		Trace string
+	}
+	fields := []*PackageField{{"Trace", reflect.String, DefaultPropertyGetter, DefaultPropertySetter}}
+	ext := reflect.ValueOf(&extension{Trace: "t1"}).Elem()
+	if seq := (&Package{}).SerializeWith(fields, &ext); !bytes.HasPrefix(seq, UintSerialize(uint(1)<<CustomFieldOffset)) {
+		t.Fatalf("the custom field should take the bit %d, got %v", CustomFieldOffset, seq)
+	}
+
+	pkg := NewPackage("order", []byte("body"), "", -1)
+	pkg.Headers = map[string]string{"k": "v"}
+	seq := pkg.SerializeWith(fields, &ext)
+	deExt := reflect.ValueOf(&extension{}).Elem()
+	dePkg, err := PackageDeserializeHeadWith(bufio.NewReader(bytes.NewReader(seq)), fields, &deExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dePkg.Headers["k"] != "v" || deExt.Interface().(extension).Trace != "t1" || dePkg.Path != "order" {
+		t.Fatalf("unexpected package: %+v, %+v", dePkg, deExt.Interface())
+	}
+}
@@ -29,12 +29,14 @@ func (q *WrappedQuicRouter) Route(conn quic.Connection, ctxData map[string]any)
 	if !ok {
 		return false
 	}
+	var n int
 	if context.Api != nil && context.Api.Responsive {
 		bts := qp.ClearBuffer()
-		if _, err = stream.Write(bts); err != nil {
+		if n, err = stream.Write(bts); err != nil {
 			println(err.Error())
 		}
 	}
+	qp.Responded(n)
 	return true
 }
 
@@ -44,7 +46,11 @@ func (q *WrappedQuicRouter) UniRoute(conn quic.Connection, ctxData map[string]an
 	if err != nil {
 		return q.Except(conn.RemoteAddr().String(), err)
 	}
-	_, _, ok := q.uniRoute(stream, meta)
+	_, qp, ok := q.uniRoute(stream, meta)
+	if ok {
+		// nothing to respond to the unidirectional stream
+		qp.Responded(0)
+	}
 	return ok
 }
 
@@ -28,12 +28,14 @@ func (t *WrappedTcpRouter) Route(conn net.Conn, ctxData map[string]any) bool {
 	context := router.NewContext(sw)
 	t.Router.Route(context)
 	sw.TryPrintErr()
+	var n int
 	if context.Api != nil && context.Api.Responsive {
 		bytes := sw.ClearBuffer()
-		if _, err = conn.Write(bytes); err != nil {
+		if n, err = conn.Write(bytes); err != nil {
 			slog.Error(err.Error())
 		}
 	}
+	sw.Responded(n)
 	return true
 }
 
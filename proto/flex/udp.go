@@ -25,12 +25,14 @@ func UdpRoute(conn *net.UDPConn, pkg []byte, addr *net.UDPAddr, ctxData map[stri
 	context := router.NewContext(sw)
 	UdpRouter.Route(context)
 	sw.TryPrintErr()
+	var n int
 	if context.Api != nil && context.Api.Responsive {
 		bts := sw.ClearBuffer()
-		if _, err = conn.WriteToUDP(bts, addr); err != nil {
+		if n, err = conn.WriteToUDP(bts, addr); err != nil {
 			println(err.Error())
 		}
 	}
+	sw.Responded(n)
 }
 
 var UdpRouter *router.Router[*UdpProtocol]
@@ -34,12 +34,16 @@ func (w *WrappedWebsocketRouter) Route(conn *websocket.Conn, req *http.Request,
 	context := router.NewContext(sw)
 	w.Router.Route(context)
 	sw.TryPrintErr()
+	var n int
 	if context.Api != nil && context.Api.Responsive {
 		bytes := sw.ClearBuffer()
 		if err = conn.Write(context, ty, bytes); err != nil {
 			slog.Error(err.Error())
+		} else {
+			n = len(bytes)
 		}
 	}
+	sw.Responded(n)
 	return true
 }
 
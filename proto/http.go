@@ -1,6 +1,7 @@
 package proto
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
@@ -13,16 +14,18 @@ import (
 	"go.drunkce.com/dce/util"
 )
 
+// The http methods are bit flags, so that an Api could accept multiple methods, such as `HttpGet|HttpHead`. They were
+// the sequence 1..9 before, see the CHANGELOG for migrating the hard-coded numbers.
 var (
 	HttpGet     = router.Method(1)
-	HttpPost    = router.Method(2)
-	HttpPut     = router.Method(3)
-	HttpDelete  = router.Method(4)
-	HttpHead    = router.Method(5)
-	HttpOptions = router.Method(6)
-	HttpConnect = router.Method(7)
-	HttpPatch   = router.Method(8)
-	HttpTrace   = router.Method(9)
+	HttpPost    = router.Method(1 << 1)
+	HttpPut     = router.Method(1 << 2)
+	HttpDelete  = router.Method(1 << 3)
+	HttpHead    = router.Method(1 << 4)
+	HttpOptions = router.Method(1 << 5)
+	HttpConnect = router.Method(1 << 6)
+	HttpPatch   = router.Method(1 << 7)
+	HttpTrace   = router.Method(1 << 8)
 )
 
 type Http = router.Context[*HttpProtocol]
@@ -31,7 +34,13 @@ const HeaderSidKey = "X-Session-Id"
 
 type HttpProtocol struct {
 	router.Meta[*http.Request]
-	Writer http.ResponseWriter
+	router.RespondedNotifier
+	Writer    http.ResponseWriter
+	committed bool
+	stream    *HttpStream
+	status    int
+	sidCookie *http.Cookie
+	written   int
 }
 
 func (h *HttpProtocol) Path() string {
@@ -42,44 +51,182 @@ func (h *HttpProtocol) MatchApi(apis []*router.Api) (index int) {
 	return slices.IndexFunc(apis, func(api *router.Api) bool {
 		if method := uint(ToUintMethod(h.Req.Method)); method < 1 || method&uint(api.Method) != method {
 			return false
-		} else if hosts := api.Hosts(); len(hosts) > 0 {
-			for _, host := range hosts {
-				if strings.Contains(host, ":") {
-					if host == h.Req.Host {
-						return true
-					}
-				} else if _, err := strconv.Atoi(host); err == nil {
-					if strings.HasSuffix(h.Req.Host, ":"+host) {
-						return true
-					}
-				} else if strings.HasPrefix(h.Req.Host, host+":") {
-					return true
-				}
-			}
-			return false
 		}
-		return true
+		return h.matchHost(api)
 	})
 }
 
+func (h *HttpProtocol) matchHost(api *router.Api) bool {
+	hosts := api.Hosts()
+	if len(hosts) == 0 {
+		return true
+	}
+	for _, host := range hosts {
+		if strings.Contains(host, ":") {
+			if host == h.Req.Host {
+				return true
+			}
+		} else if _, err := strconv.Atoi(host); err == nil {
+			if strings.HasSuffix(h.Req.Host, ":"+host) {
+				return true
+			}
+		} else if strings.HasPrefix(h.Req.Host, host+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedMethods returns the method mask accepted by the apis of the requested path, the apis bound to other hosts
+// will be ignored.
+func (h *HttpProtocol) allowedMethods(apis []*router.Api) router.Method {
+	var methods router.Method
+	for _, api := range apis {
+		if h.matchHost(api) {
+			methods |= api.Method
+		}
+	}
+	return methods
+}
+
+// Request returns the underlying HTTP request.
+func (h *HttpProtocol) Request() *http.Request {
+	return h.Req
+}
+
 func (h *HttpProtocol) Body() ([]byte, error) {
 	return io.ReadAll(h.Req.Body)
 }
 
+// ContentLength returns the length of the request body, it is -1 if unknown.
+func (h *HttpProtocol) ContentLength() int64 {
+	return h.Req.ContentLength
+}
+
+// RawQuery returns the encoded query of the request url, without the leading '?'.
+func (h *HttpProtocol) RawQuery() string {
+	return h.Req.URL.RawQuery
+}
+
+// RequestHeader returns the request header value.
+func (h *HttpProtocol) RequestHeader(key string) string {
+	return h.Req.Header.Get(key)
+}
+
 var headerSidKey string = strings.ToLower(HeaderSidKey)
 
 func (h *HttpProtocol) Sid() string {
+	sid, _ := h.sid()
+	return sid
+}
+
+// sid returns the request sid and whether it was taken from the cookies.
+func (h *HttpProtocol) sid() (string, bool) {
 	if headerSid := h.Req.Header.Get(HeaderSidKey); len(headerSid) > 0 {
-		return headerSid
+		return headerSid, false
 	} else if cookies := h.Req.Cookies(); len(cookies) > 0 {
 		if cookie, ok := util.SeqFrom(cookies).Find(func(c *http.Cookie) bool {
 			lower := strings.ToLower((*c).Name)
-			return lower == "session_id" || lower == "session-id" || lower == headerSidKey
+			return lower == "session_id" || lower == "session-id" || lower == headerSidKey ||
+				(h.sidCookie != nil && (*c).Name == h.sidCookie.Name)
 		}); ok {
-			return (*cookie).Value
+			return (*cookie).Value, true
+		}
+	}
+	return "", false
+}
+
+// Write writes into the response buffer, or directly flushes to the client if the response is in streaming mode.
+func (h *HttpProtocol) Write(bytes []byte) (int, error) {
+	if h.stream != nil {
+		return h.stream.Write(bytes)
+	}
+	return h.Meta.Write(bytes)
+}
+
+func (h *HttpProtocol) WriteString(str string) (int, error) {
+	return h.Write([]byte(str))
+}
+
+// SetStatus specifies the response status code, it has a higher priority than the code of the openly error.
+func (h *HttpProtocol) SetStatus(code int) {
+	h.status = code
+}
+
+func (h *HttpProtocol) Status() int {
+	return h.status
+}
+
+// Header returns the response header map, modifications after the response committed will not take effect.
+func (h *HttpProtocol) Header() http.Header {
+	return h.Writer.Header()
+}
+
+func (h *HttpProtocol) SetHeader(key string, value string) {
+	h.Writer.Header().Set(key, value)
+}
+
+func (h *HttpProtocol) AddHeader(key string, value string) {
+	h.Writer.Header().Add(key, value)
+}
+
+func (h *HttpProtocol) SetCookie(cookie *http.Cookie) {
+	http.SetCookie(h.Writer, cookie)
+}
+
+// Redirect responds an HTTP redirection to the client with the `Location` header, the code will be 302 Found if not
+// specified. It is different from the `Api.Redirect`, which is an internal route aliasing.
+func (h *HttpProtocol) Redirect(url string, code int) {
+	if code == 0 {
+		code = http.StatusFound
+	}
+	h.SetHeader("Location", url)
+	h.SetStatus(code)
+}
+
+// commit writes the response headers and status code, it should only be called once, any header modified after
+// this will be ignored.
+func (h *HttpProtocol) commit() {
+	if h.committed {
+		return
+	}
+	h.commitHeader()
+	if status := h.ResponseStatus(); status != http.StatusOK {
+		h.Writer.WriteHeader(status)
+	}
+}
+
+// ResponseStatus returns the status code to respond, the explicitly specified status code has a higher priority than
+// the error code, and the openly error with a response body is responded with 200.
+func (h *HttpProtocol) ResponseStatus() int {
+	if h.status > 0 {
+		return h.status
+	} else if h.Error() != nil {
+		var e util.Error
+		if !errors.As(h.Error(), &e) {
+			return util.ServiceUnavailable
+		} else if !e.IsOpenly() || h.ResponseEmpty() {
+			return util.Iif(e.Code > 0 && e.Code < 600, e.Code, util.ServiceUnavailable)
+		}
+	}
+	return http.StatusOK
+}
+
+// commitHeader fills the context headers into the response header map and marks the response as committed, it could
+// be used directly when the status code will be written by a standard library handler.
+func (h *HttpProtocol) commitHeader() {
+	h.committed = true
+	if ct, ok := h.CtxData(router.HttpContentTypeKey); ok {
+		h.Writer.Header().Set(router.HttpContentTypeKey, ct.(string))
+	}
+	if sid := h.RespSid(); sid != "" {
+		h.Writer.Header().Set(HeaderSidKey, sid)
+		if h.sidCookie != nil {
+			cookie := *h.sidCookie
+			cookie.Value = sid
+			h.SetCookie(&cookie)
 		}
 	}
-	return ""
 }
 
 func (h *HttpProtocol) Deadline() (deadline time.Time, ok bool) {
@@ -98,6 +245,11 @@ func (h *HttpProtocol) Value(key any) any {
 	return h.Req.Context().Value(key)
 }
 
+// WithValue derives the context of the request with the key value pair.
+func (h *HttpProtocol) WithValue(key any, val any) {
+	h.Req = h.Req.WithContext(context.WithValue(h.Req.Context(), key, val))
+}
+
 var methodNameUintMapping = map[string]router.Method{
 	"GET":     HttpGet,
 	"POST":    HttpPost,
@@ -117,6 +269,15 @@ func ToUintMethod(name string) router.Method {
 	return 0
 }
 
+var methodNames = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"}
+
+// MethodNames converts the method mask into the method names, it could be used as the `Allow` header value.
+func MethodNames(methods router.Method) []string {
+	return util.SeqFrom(methodNames).Filter(func(name string) bool {
+		return methods&methodNameUintMapping[name] > 0
+	}).Collect()
+}
+
 type WrappedHttpRouter router.Router[*HttpProtocol]
 
 func (h *WrappedHttpRouter) Raw() *router.Router[*HttpProtocol] {
@@ -128,19 +289,19 @@ func (h *WrappedHttpRouter) Get(path string, controller func(h *Http)) *WrappedH
 }
 
 func (h *WrappedHttpRouter) Post(path string, controller func(h *Http)) *WrappedHttpRouter {
-	return h.pushMethod(HttpPost|HttpOptions, path, controller)
+	return h.pushMethod(HttpPost, path, controller)
 }
 
 func (h *WrappedHttpRouter) Put(path string, controller func(h *Http)) *WrappedHttpRouter {
-	return h.pushMethod(HttpPut|HttpOptions, path, controller)
+	return h.pushMethod(HttpPut, path, controller)
 }
 
 func (h *WrappedHttpRouter) Patch(path string, controller func(h *Http)) *WrappedHttpRouter {
-	return h.pushMethod(HttpPatch|HttpOptions, path, controller)
+	return h.pushMethod(HttpPatch, path, controller)
 }
 
 func (h *WrappedHttpRouter) Delete(path string, controller func(h *Http)) *WrappedHttpRouter {
-	return h.pushMethod(HttpDelete|HttpOptions, path, controller)
+	return h.pushMethod(HttpDelete, path, controller)
 }
 
 func (h *WrappedHttpRouter) pushMethod(method router.Method, path string, controller func(h *Http)) *WrappedHttpRouter {
@@ -157,27 +318,36 @@ func (h *WrappedHttpRouter) PushApi(api router.Api, controller func(c *Http)) *W
 
 func (h *WrappedHttpRouter) Route(writer http.ResponseWriter, request *http.Request) {
 	hp := NewHttpProtocol(writer, request)
-	context := router.NewContext(hp)
-	h.Raw().Route(context)
-	hp.TryPrintErr()
-	if ct, ok := hp.CtxData(router.HttpContentTypeKey); ok {
-		hp.Writer.Header().Set(router.HttpContentTypeKey, ct.(string))
+	if cookie, ok := h.Raw().ExtraBy(extraSidCookieKey).(*http.Cookie); ok {
+		hp.sidCookie = cookie
 	}
-	if hp.Error() != nil {
-		var e util.Error
-		if !errors.As(hp.Error(), &e) {
-			hp.Writer.WriteHeader(util.ServiceUnavailable)
-		} else if ! e.IsOpenly() || hp.ResponseEmpty() {
-			hp.Writer.WriteHeader(util.Iif(e.Code > 0 && e.Code < 600, e.Code, util.ServiceUnavailable))
+	context := router.NewContext(hp)
+	if request.Method != http.MethodOptions || !h.preflight(hp) {
+		if request.Header.Get(HeaderOrigin) != "" {
+			h.applyCors(hp)
+		}
+		h.Raw().Route(context)
+		if context.Api == nil && hp.Error() != nil {
+			h.tryMethodNotAllowed(hp)
 		}
 	}
-	if sid := hp.RespSid(); sid != "" {
-		hp.Writer.Header().Set(HeaderSidKey, sid)
-	}
-	bytes := hp.ClearBuffer()
-	if _, err := hp.Writer.Write(bytes); err != nil {
-		println(err.Error())
+	hp.TryPrintErr()
+	if hp.stream != nil {
+		// the headers were already committed at the first flush, so just flush the remains
+		if err := hp.stream.Flush(); err != nil {
+			println(err.Error())
+		}
+	} else {
+		hp.commit()
+		if bytes := hp.ClearBuffer(); len(bytes) > 0 {
+			n, err := hp.Writer.Write(bytes)
+			hp.written += n
+			if err != nil {
+				println(err.Error())
+			}
+		}
 	}
+	hp.Responded(hp.written + hp.StreamedBytes())
 }
 
 func NewHttpProtocol(writer http.ResponseWriter, request *http.Request) *HttpProtocol {
@@ -189,6 +359,27 @@ func NewHttpProtocol(writer http.ResponseWriter, request *http.Request) *HttpPro
 
 var HttpRouter *WrappedHttpRouter
 
+const extraSidCookieKey = "$#SID-COOKIE#"
+
+// SetSidCookie specifies a cookie template to issue the response session id of the router to the client in addition
+// to the `X-Session-Id` header, the cookie will carry the sid as value, and will also be accepted as the request sid.
+// Passing nil will stop issuing the sid cookie.
+//
+//	proto.HttpRouter.SetSidCookie(&http.Cookie{Name: "session_id", Path: "/", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+func (h *WrappedHttpRouter) SetSidCookie(template *http.Cookie) *WrappedHttpRouter {
+	if template == nil {
+		h.Raw().SetExtra(extraSidCookieKey, nil)
+	} else {
+		h.Raw().SetExtra(extraSidCookieKey, template)
+	}
+	return h
+}
+
+// DefaultSidCookie returns a secure HttpOnly cookie template named "session_id".
+func DefaultSidCookie() *http.Cookie {
+	return &http.Cookie{Name: "session_id", Path: "/", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+}
+
 func init() {
 	HttpRouter = (*WrappedHttpRouter)(router.ProtoRouter[*HttpProtocol]("http"))
 }
@@ -0,0 +1,164 @@
+package proto
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+)
+
+const (
+	HeaderOrigin                     = "Origin"
+	HeaderAllow                      = "Allow"
+	HeaderAccessControlRequestMethod = "Access-Control-Request-Method"
+	HeaderAccessControlRequestHeader = "Access-Control-Request-Headers"
+)
+
+const CodeMethodNotAllowed = 405
+
+// CorsPolicy defines the Cross-Origin Resource Sharing rules of the http apis.
+//
+// Fields:
+//   - Origins: The allowed origins, such as "https://example.com", "*" means allowing any origin.
+//   - Headers: The allowed request headers of the preflight, "*" means allowing the requested headers.
+//   - ExposeHeaders: The response headers could be exposed to the client scripts.
+//   - Credentials: Whether to allow the cookies or the authorization headers, the origin will be echoed instead of "*".
+//   - MaxAge: The duration the preflight result could be cached by the client, omitted if zero.
+type CorsPolicy struct {
+	Origins       []string
+	Headers       []string
+	ExposeHeaders []string
+	Credentials   bool
+	MaxAge        time.Duration
+}
+
+func (c *CorsPolicy) allowOrigin(origin string) (string, bool) {
+	if slices.Contains(c.Origins, origin) {
+		return origin, true
+	} else if slices.Contains(c.Origins, "*") {
+		return util.Iif(c.Credentials, origin, "*"), true
+	}
+	return "", false
+}
+
+// apply writes the cors response headers, the preflight headers will be written if methods specified.
+func (c *CorsPolicy) apply(header http.Header, origin string, methods router.Method, requestHeaders string) {
+	allowOrigin, ok := c.allowOrigin(origin)
+	header.Add("Vary", HeaderOrigin)
+	if !ok {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if c.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if methods == 0 {
+		if len(c.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposeHeaders, ", "))
+		}
+		return
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(MethodNames(methods), ", "))
+	if slices.Contains(c.Headers, "*") {
+		if requestHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+	} else if len(c.Headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+	}
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+}
+
+const extraCorsKey = "$#CORS#"
+
+// WithCors binds the cors policy to the api, it has a higher priority than the policies set via `SetCors`.
+//
+//	proto.HttpRouter.PushApi(proto.WithCors(router.Path("user").ByMethod(proto.HttpPost), policy), controller)
+func WithCors(api router.Api, policy *CorsPolicy) router.Api {
+	return api.With(extraCorsKey, policy)
+}
+
+// extraCorsRulesKey is the router extra key of the cors rules, the value is []*util.Tuple2[string, *CorsPolicy].
+const extraCorsRulesKey = "$#CORS-RULES#"
+
+// SetCors sets the cors policy to the apis matched the path pattern, the pattern syntax is the same as that in the
+// `router.SetBefore` method, the later set pattern has a higher priority.
+//
+//	proto.HttpRouter.SetCors("*", &proto.CorsPolicy{Origins: []string{"*"}}) // apply to all apis
+//	proto.HttpRouter.SetCors("api+", &proto.CorsPolicy{Origins: []string{"https://example.com"}, Credentials: true})
+func (h *WrappedHttpRouter) SetCors(pattern string, policy *CorsPolicy) *WrappedHttpRouter {
+	rules, _ := h.Raw().ExtraBy(extraCorsRulesKey).([]*util.Tuple2[string, *CorsPolicy])
+	h.Raw().SetExtra(extraCorsRulesKey, append(rules, util.NewTuple2(pattern, policy)))
+	return h
+}
+
+func (h *WrappedHttpRouter) corsPolicy(api *router.Api) *CorsPolicy {
+	if policy, ok := api.ExtraBy(extraCorsKey).(*CorsPolicy); ok {
+		return policy
+	} else if rules, ok := h.Raw().ExtraBy(extraCorsRulesKey).([]*util.Tuple2[string, *CorsPolicy]); ok {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if router.MatchPathPattern(rules[i].A, api.Path) {
+				return rules[i].B
+			}
+		}
+	}
+	return nil
+}
+
+// applyCors writes the cors headers for the actual cross-origin requests before routing, so that the headers will be
+// committed even if the controller flushes the response by itself.
+func (h *WrappedHttpRouter) applyCors(hp *HttpProtocol) {
+	apis := h.Raw().PathApis(hp.Path())
+	if index := hp.MatchApi(apis); index > -1 {
+		if policy := h.corsPolicy(apis[index]); policy != nil {
+			policy.apply(hp.Header(), hp.Req.Header.Get(HeaderOrigin), 0, "")
+		}
+	}
+}
+
+// preflight responds the OPTIONS requests with the allowed methods of the requested path, and the cors headers if it
+// is a cors preflight request. It returns false if the path not matched or there is an api explicitly accepts the
+// OPTIONS method, then the request should be routed as usual.
+func (h *WrappedHttpRouter) preflight(hp *HttpProtocol) bool {
+	apis := util.SeqFrom(h.Raw().PathApis(hp.Path())).Filter(hp.matchHost).Collect()
+	if len(apis) == 0 || slices.ContainsFunc(apis, func(api *router.Api) bool {
+		return api.Method&HttpOptions > 0
+	}) {
+		return false
+	}
+	methods := hp.allowedMethods(apis) | HttpOptions
+	hp.SetHeader(HeaderAllow, strings.Join(MethodNames(methods), ", "))
+	if origin, requestMethod := hp.Req.Header.Get(HeaderOrigin), hp.Req.Header.Get(HeaderAccessControlRequestMethod); origin != "" && requestMethod != "" {
+		method := ToUintMethod(requestMethod)
+		if api, ok := util.SeqFrom(apis).Find(func(api *router.Api) bool {
+			return method > 0 && api.Method&method == method
+		}); ok {
+			if policy := h.corsPolicy(api); policy != nil {
+				policy.apply(hp.Header(), origin, methods, hp.Req.Header.Get(HeaderAccessControlRequestHeader))
+			}
+		}
+	}
+	hp.SetStatus(http.StatusNoContent)
+	return true
+}
+
+// tryMethodNotAllowed converts the not found error into the 405 Method Not Allowed if the path matched but no api
+// accepts the request method.
+func (h *WrappedHttpRouter) tryMethodNotAllowed(hp *HttpProtocol) {
+	var e util.Error
+	if !errors.As(hp.Error(), &e) || e.Code != router.CodeNotFound {
+		return
+	}
+	apis := h.Raw().PathApis(hp.Path())
+	if methods := hp.allowedMethods(apis); methods > 0 {
+		hp.SetHeader(HeaderAllow, strings.Join(MethodNames(methods|HttpOptions), ", "))
+		hp.SetError(util.Openly(CodeMethodNotAllowed, `method "%s" is not allowed by path "%s"`, hp.Req.Method, hp.Path()))
+	}
+}
@@ -0,0 +1,128 @@
+package proto_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/router"
+)
+
+func newCorsRouter() *proto.WrappedHttpRouter {
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	r.Get("user", func(h *proto.Http) {
+		_, _ = h.WriteString("user")
+	}).Post("user", func(h *proto.Http) {
+		_, _ = h.WriteString("created")
+	}).PushApi(router.Path("echo").ByMethod(proto.HttpOptions), func(h *proto.Http) {
+		_, _ = h.WriteString("options")
+	})
+	r.SetCors("*", &proto.CorsPolicy{
+		Origins:       []string{"https://example.com"},
+		Headers:       []string{"*"},
+		ExposeHeaders: []string{"X-Total"},
+		Credentials:   true,
+		MaxAge:        10 * time.Minute,
+	})
+	return r
+}
+
+func TestPreflight(t *testing.T) {
+	r := newCorsRouter()
+	req := httptest.NewRequest(http.MethodOptions, "/user", nil)
+	req.Header.Set(proto.HeaderOrigin, "https://example.com")
+	req.Header.Set(proto.HeaderAccessControlRequestMethod, http.MethodPost)
+	req.Header.Set(proto.HeaderAccessControlRequestHeader, "X-Token")
+	w := httptest.NewRecorder()
+	r.Route(w, req)
+
+	if w.Code != http.StatusNoContent || w.Body.Len() > 0 {
+		t.Fatalf("expected an empty 204, got %d %q", w.Code, w.Body.String())
+	}
+	for key, expected := range map[string]string{
+		proto.HeaderAllow:                  "GET, HEAD, POST, OPTIONS",
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD, POST, OPTIONS",
+		"Access-Control-Allow-Headers":     "X-Token",
+		"Access-Control-Max-Age":           "600",
+		"Vary":                             proto.HeaderOrigin,
+	} {
+		if actual := w.Header().Get(key); actual != expected {
+			t.Errorf("expected %s: %q, got %q", key, expected, actual)
+		}
+	}
+
+	// the disallowed origin gets no cors headers
+	req.Header.Set(proto.HeaderOrigin, "https://evil.com")
+	w = httptest.NewRecorder()
+	r.Route(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no cors headers for the disallowed origin, got %v", w.Header())
+	}
+
+	// the explicit OPTIONS api is routed as usual
+	w = httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodOptions, "/echo", nil))
+	if w.Body.String() != "options" {
+		t.Fatalf("expected the OPTIONS api routed, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := newCorsRouter()
+	w := httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodDelete, "/user", nil))
+	if w.Code != proto.CodeMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	} else if allow := w.Header().Get(proto.HeaderAllow); allow != "GET, HEAD, POST, OPTIONS" {
+		t.Fatalf("unexpected Allow %q", allow)
+	}
+
+	w = httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodDelete, "/missing", nil))
+	if w.Code != router.CodeNotFound || w.Header().Get(proto.HeaderAllow) != "" {
+		t.Fatalf("expected 404 without Allow, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCorsResponseHeaders(t *testing.T) {
+	r := newCorsRouter()
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(proto.HeaderOrigin, "https://example.com")
+	w := httptest.NewRecorder()
+	r.Route(w, req)
+	if w.Body.String() != "user" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	for key, expected := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "X-Total",
+		"Access-Control-Allow-Methods":     "",
+	} {
+		if actual := w.Header().Get(key); actual != expected {
+			t.Errorf("expected %s: %q, got %q", key, expected, actual)
+		}
+	}
+
+	// the same-origin requests get no cors headers
+	w = httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodGet, "/user", nil))
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no cors headers without origin, got %v", w.Header())
+	}
+
+	// the cors rules belong to the router they were set on
+	other := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	other.Get("user", func(h *proto.Http) {
+		_, _ = h.WriteString("user")
+	})
+	w = httptest.NewRecorder()
+	other.Route(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no cors headers from the other router, got %v", w.Header())
+	}
+}
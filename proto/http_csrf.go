@@ -0,0 +1,121 @@
+package proto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+const (
+	HeaderCsrfToken = "X-Csrf-Token"
+	// DefaultCsrfField is the session field to store the csrf token.
+	DefaultCsrfField = "$csrf"
+)
+
+const CodeCsrfMismatched = 403
+
+// csrfFormMaxBytes is the max size of the form body to be read for the csrf token, the larger forms should submit the
+// token via the `X-Csrf-Token` header.
+const csrfFormMaxBytes = 1 << 20
+
+const extraCsrfExemptKey = "$#CSRF-EXEMPT#"
+
+// CsrfExempt exempts the api from the csrf verification, such as the webhooks authenticated by signatures.
+//
+//	proto.HttpRouter.PushApi(proto.CsrfExempt(router.Path("webhook").ByMethod(proto.HttpPost)), controller)
+func CsrfExempt(api router.Api) router.Api {
+	return api.With(extraCsrfExemptKey, true)
+}
+
+// CsrfToken returns the csrf token of the session, it will be generated and stored into the session if not exists.
+func CsrfToken(sess session.IfSession) (string, error) {
+	if token, err := session.GetAs[string](sess, DefaultCsrfField); err == nil && token != "" {
+		return token, nil
+	}
+	bts := make([]byte, 32)
+	if _, err := rand.Read(bts); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(bts)
+	if err := session.SetAs(sess, DefaultCsrfField, token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SidFromCookie reports whether the request sid was taken from the cookies but not the `X-Session-Id` header, the
+// browsers attach the cookies to the cross-site requests automatically, so these requests should be verified.
+func (h *HttpProtocol) SidFromCookie() bool {
+	_, fromCookie := h.sid()
+	return fromCookie
+}
+
+func unsafeMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// formValue gets the field value of the url-encoded request body up to 1MB, the other content types such as the
+// multipart forms are ignored. The body will be restored after parsed, so that the controller could still read it.
+func (h *HttpProtocol) formValue(field string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(h.Req.Header.Get(router.HttpContentTypeKey))
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return "", nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, h.Req.Body, csrfFormMaxBytes))
+	h.Req.Body = io.NopCloser(bytes.NewReader(body))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return "", util.Openly(http.StatusRequestEntityTooLarge, "Form too large to verify the CSRF token")
+	} else if err != nil {
+		return "", err
+	}
+	// the malformed pairs are skipped as the form parsing of the request
+	values, _ := url.ParseQuery(string(body))
+	return values.Get(field), nil
+}
+
+// CsrfProtect is a before hook to protect the cookie based sessions from the cross-site request forgery, it should be
+// chained after the session bound:
+//
+//	proto.HttpRouter.Raw().SetBefore("*", router.Chain(sessions.Before, proto.CsrfProtect))
+//
+// It provides the token getter to the templates rendered by `converter.TemplateResponser`, which could be rendered via
+// `{{csrfToken}}` or `{{csrfField}}`, and verifies the token of the unsafe methods (POST, PUT, PATCH and DELETE) if the
+// sid came from a cookie. The token could be submitted via the `X-Csrf-Token` header, or the `csrf_token` field of the
+// url-encoded forms up to 1MB, the multipart forms should submit it via the header.
+// The requests with the sid in the header are not verified, since the cross-site requests could not set it.
+func CsrfProtect(ctx *Http) error {
+	sess := ctx.Rp.Session()
+	if sess == nil {
+		return nil
+	}
+	ctx.Rp.SetCtxData(router.ContextKeyCsrfToken, func() string {
+		token, _ := CsrfToken(sess)
+		return token
+	})
+	if !unsafeMethod(ctx.Rp.Req.Method) || !ctx.Rp.SidFromCookie() || (ctx.Api != nil && ctx.Api.ExtraBy(extraCsrfExemptKey) != nil) {
+		return nil
+	}
+	provided := ctx.Rp.Req.Header.Get(HeaderCsrfToken)
+	if provided == "" {
+		var err error
+		if provided, err = ctx.Rp.formValue(router.CsrfFormField); err != nil {
+			return err
+		}
+	}
+	token, err := session.GetAs[string](sess, DefaultCsrfField)
+	if err != nil || token == "" || provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		return util.Openly(CodeCsrfMismatched, "CSRF token mismatched")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package proto_test
+
+import (
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.drunkce.com/dce/converter"
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+)
+
+func TestCsrfProtect(t *testing.T) {
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	r.Get("form", func(h *proto.Http) {
+		converter.TextTemplate[*proto.HttpProtocol, string](h, `{{csrfToken}}`).Response("")
+	}).Post("submit", func(h *proto.Http) {
+		_, _ = h.WriteString("ok")
+	}).PushApi(proto.CsrfExempt(router.Path("hook").ByMethod(proto.HttpPost)), func(h *proto.Http) {
+		_, _ = h.WriteString("ok")
+	})
+	sessions := router.NewSessionMiddleware[*proto.HttpProtocol](func(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[*session.SimpleUser], error) {
+		return session.NewShmSession[*session.SimpleUser](sidPool, ttlMinutes)
+	})
+	r.Raw().SetBefore("*", router.Chain(sessions.Before, proto.CsrfProtect)).SetAfter("*", sessions.After)
+
+	do := func(method string, path string, cookieSid string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/"+path, nil)
+		if cookieSid != "" {
+			req.AddCookie(&http.Cookie{Name: "session_id", Value: cookieSid})
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.Route(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "form", "", nil)
+	token, sid := strings.TrimSpace(w.Body.String()), w.Header().Get(proto.HeaderSidKey)
+	if len(token) != 64 || sid == "" {
+		t.Fatalf("expected a token rendered with a new sid, got %q, %q", token, sid)
+	}
+	if w = do(http.MethodPost, "submit", sid, nil); w.Code != proto.CodeCsrfMismatched {
+		t.Fatalf("expected the request without token rejected, got %d", w.Code)
+	}
+	if w = do(http.MethodPost, "submit", sid, map[string]string{proto.HeaderCsrfToken: "forged"}); w.Code != proto.CodeCsrfMismatched {
+		t.Fatalf("expected the forged token rejected, got %d", w.Code)
+	}
+	if w = do(http.MethodPost, "submit", sid, map[string]string{proto.HeaderCsrfToken: token}); w.Body.String() != "ok" {
+		t.Fatalf("expected the request with token accepted, got %d", w.Code)
+	}
+	if w = do(http.MethodPost, "submit", "", map[string]string{proto.HeaderSidKey: sid}); w.Body.String() != "ok" {
+		t.Fatalf("expected the request with header sid accepted, got %d", w.Code)
+	}
+	if w = do(http.MethodPost, "hook", sid, nil); w.Body.String() != "ok" {
+		t.Fatalf("expected the exempted api accepted, got %d", w.Code)
+	}
+}
+
+func TestCsrfFormFallback(t *testing.T) {
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	r.Get("form", func(h *proto.Http) {
+		converter.TextTemplate[*proto.HttpProtocol, string](h, `{{csrfToken}}`).Response("")
+	}).Post("echo", func(h *proto.Http) {
+		body, _ := h.Rp.Body()
+		_, _ = h.Write(body)
+	})
+	sessions := router.NewSessionMiddleware[*proto.HttpProtocol](func(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[*session.SimpleUser], error) {
+		return session.NewShmSession[*session.SimpleUser](sidPool, ttlMinutes)
+	})
+	r.Raw().SetBefore("*", router.Chain(sessions.Before, proto.CsrfProtect)).SetAfter("*", sessions.After)
+
+	// render concurrently after the router is ready, every request should get the token of its own session
+	r.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/form", nil))
+	var wg sync.WaitGroup
+	tokens := make([][2]string, 8)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.Route(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+			tokens[i] = [2]string{strings.TrimSpace(w.Body.String()), w.Header().Get(proto.HeaderSidKey)}
+		}()
+	}
+	wg.Wait()
+	for i, pair := range tokens {
+		sess, _ := session.NewShmSession[*session.SimpleUser]([]string{pair[1]}, 0)
+		if expected, _ := proto.CsrfToken(sess); len(pair[0]) != 64 || pair[0] != expected {
+			t.Fatalf("the token %d should be rendered from its own session, got %q, expected %q", i, pair[0], expected)
+		}
+	}
+	token, sid := tokens[0][0], tokens[0][1]
+
+	post := func(contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sid})
+		w := httptest.NewRecorder()
+		r.Route(w, req)
+		return w
+	}
+	form := url.Values{router.CsrfFormField: {token}, "name": {"Drunk"}}.Encode()
+	if w := post("application/x-www-form-urlencoded", form); w.Body.String() != form {
+		t.Fatalf("expected the form accepted with the body readable, got %d %q", w.Code, w.Body.String())
+	}
+
+	var multipartBody strings.Builder
+	mw := multipart.NewWriter(&multipartBody)
+	_ = mw.WriteField(router.CsrfFormField, token)
+	_ = mw.Close()
+	if w := post(mw.FormDataContentType(), multipartBody.String()); w.Code != proto.CodeCsrfMismatched {
+		t.Fatalf("expected the multipart form required the header, got %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(multipartBody.String()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set(proto.HeaderCsrfToken, token)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: sid})
+	w := httptest.NewRecorder()
+	if r.Route(w, req); w.Body.String() != multipartBody.String() {
+		t.Fatalf("expected the multipart form accepted with the header, got %d %q", w.Code, w.Body.String())
+	}
+	large := form + "&pad=" + strings.Repeat("x", 1<<20)
+	if w := post("application/x-www-form-urlencoded", large); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the large form rejected, got %d", w.Code)
+	}
+
+	for _, contentType := range []string{"application/json", "text/plain", ""} {
+		if w := post(contentType, form); w.Code != proto.CodeCsrfMismatched {
+			t.Fatalf("expected the %q body not parsed as form, got %d", contentType, w.Code)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package proto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+)
+
+// StaticConfig defines the behaviors of the static file serving.
+//
+// Fields:
+//   - Index: The index file names to try in order when a directory is requested, directory listing is not supported.
+//   - CacheControl: The `Cache-Control` header value of the responses, omitted if empty.
+//   - Precompressed: Whether to serve the precompressed ".gz" variant if exists and the client accepts gzip.
+type StaticConfig struct {
+	Index         []string
+	CacheControl  string
+	Precompressed bool
+}
+
+func DefaultStaticConfig() StaticConfig {
+	return StaticConfig{Index: []string{"index.html"}, Precompressed: true}
+}
+
+// Static binds a file system to serve the static files under the path prefix, it supports the `embed.FS`, `os.DirFS`
+// and any other `fs.FS` implementations. The files will be matched by a `{path*}` vector route, so the before and
+// after hooks of the prefix will be applied as usual.
+//
+//	//go:embed assets
+//	var assets embed.FS
+//	sub, _ := fs.Sub(assets, "assets")
+//	proto.HttpRouter.Static("static", sub) // GET /static/css/app.css => assets/css/app.css
+func (h *WrappedHttpRouter) Static(prefix string, fsys fs.FS) *WrappedHttpRouter {
+	return h.StaticWith(prefix, fsys, DefaultStaticConfig())
+}
+
+func (h *WrappedHttpRouter) StaticWith(prefix string, fsys fs.FS, config StaticConfig) *WrappedHttpRouter {
+	prefix = strings.Trim(prefix, router.MarkPathPartSeparator)
+	routePath := router.MarkVariableOpener + staticPathParam + router.MarkVarTypeEmptableVector + router.MarkVariableClosing
+	if prefix != "" {
+		routePath = prefix + router.MarkPathPartSeparator + routePath
+	}
+	server := &staticServer{fsys: fsys, config: config}
+	return h.pushMethod(HttpGet|HttpHead, routePath, server.serve)
+}
+
+const staticPathParam = "path"
+
+type staticServer struct {
+	fsys   fs.FS
+	config StaticConfig
+	etags  sync.Map
+}
+
+func (s *staticServer) serve(h *Http) {
+	name := path.Clean(strings.Join(h.Params(staticPathParam), "/"))
+	if name == "" || name == "/" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		h.SetError(util.Openly(http.StatusNotFound, `Static file "%s" not found`, name))
+		return
+	}
+	info, err := fs.Stat(s.fsys, name)
+	if err == nil && info.IsDir() {
+		name, info, err = s.index(name)
+	}
+	if err != nil {
+		h.SetError(util.Openly(http.StatusNotFound, `Static file "%s" not found`, name))
+		return
+	}
+	header := h.Rp.Header()
+	servedName := name
+	if s.config.Precompressed && strings.Contains(h.Rp.Req.Header.Get("Accept-Encoding"), "gzip") {
+		if gzInfo, err := fs.Stat(s.fsys, name+".gz"); err == nil && !gzInfo.IsDir() {
+			servedName, info = name+".gz", gzInfo
+			header.Set("Content-Encoding", "gzip")
+		}
+	}
+	if s.config.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	content, err := s.open(servedName)
+	if err != nil {
+		h.SetError(err)
+		return
+	}
+	if closer, ok := content.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if header.Get(router.HttpContentTypeKey) == "" {
+		if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+			header.Set(router.HttpContentTypeKey, ct)
+		}
+	}
+	if s.config.CacheControl != "" {
+		header.Set("Cache-Control", s.config.CacheControl)
+	}
+	if etag, err := s.etag(servedName, info, content); err == nil {
+		header.Set("ETag", etag)
+	}
+	h.Rp.commitHeader()
+	// ServeContent will handle the Range, If-None-Match and If-Modified-Since request headers
+	http.ServeContent(countingWriter{h.Rp.Writer, h.Rp}, h.Rp.Req, name, info.ModTime(), content)
+}
+
+func (s *staticServer) index(dir string) (string, fs.FileInfo, error) {
+	for _, index := range s.config.Index {
+		name := path.Join(dir, index)
+		if info, err := fs.Stat(s.fsys, name); err == nil && !info.IsDir() {
+			return name, info, nil
+		}
+	}
+	return dir, nil, fs.ErrNotExist
+}
+
+func (s *staticServer) open(name string) (io.ReadSeeker, error) {
+	file, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if rs, ok := file.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// etag generates a weak etag by the size and modification time, or a strong one by the content hash if the file
+// system does not provide the modification time, such as the `embed.FS`.
+func (s *staticServer) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()), nil
+	} else if etag, ok := s.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	} else if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%x"`, hash.Sum(nil)[:16])
+	s.etags.Store(name, etag)
+	return etag, nil
+}
+
+// countingWriter counts the bytes written by the standard library handlers into the response bytes of the protocol.
+type countingWriter struct {
+	http.ResponseWriter
+	hp *HttpProtocol
+}
+
+func (w countingWriter) Write(bytes []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(bytes)
+	w.hp.written += n
+	return n, err
+}
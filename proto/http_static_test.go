@@ -0,0 +1,93 @@
+package proto_test
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.drunkce.com/dce/proto"
+)
+
+func newStaticRouter(t *testing.T) *proto.WrappedHttpRouter {
+	root := fstest.MapFS{
+		"secret.txt":        {Data: []byte("secret")},
+		"public/index.html": {Data: []byte("<h1>home</h1>"), ModTime: time.Unix(1700000000, 0)},
+		"public/app.js":     {Data: []byte("console.log('dce')")},
+		"public/docs/a.txt": {Data: []byte("0123456789")},
+	}
+	public, err := fs.Sub(root, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newHttpRouter().StaticWith("static", public, proto.StaticConfig{Index: []string{"index.html"}, CacheControl: "max-age=60"})
+}
+
+func TestStaticServe(t *testing.T) {
+	r := newStaticRouter(t)
+	for path, expected := range map[string]string{
+		"/static":                "<h1>home</h1>",
+		"/static/":               "<h1>home</h1>",
+		"/static/app.js":         "console.log('dce')",
+		"/static/docs/a.txt":     "0123456789",
+		"/static/docs/../app.js": "console.log('dce')",
+	} {
+		w := httptest.NewRecorder()
+		r.Route(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != expected {
+			t.Errorf("%s: expected %q, got %d %q", path, expected, w.Code, w.Body.String())
+		} else if w.Header().Get("Cache-Control") != "max-age=60" || w.Header().Get("ETag") == "" {
+			t.Errorf("%s: expected the cache headers, got %v", path, w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	r.Route(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() > 0 {
+		t.Fatalf("expected 304 by the etag, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticTraversal(t *testing.T) {
+	r := newStaticRouter(t)
+	for _, path := range []string{
+		"/static/../secret.txt",
+		"/static/docs/../../secret.txt",
+		"/static/%2e%2e/secret.txt",
+		"/static/..%2fsecret.txt",
+		"/static/missing.txt",
+		"/static/docs",
+	} {
+		w := httptest.NewRecorder()
+		r.Route(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d %q", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestStaticRange(t *testing.T) {
+	r := newStaticRouter(t)
+	req := httptest.NewRequest(http.MethodGet, "/static/docs/a.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	r.Route(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Fatalf("expected the partial content, got %d %q", w.Code, w.Body.String())
+	} else if cr := w.Header().Get("Content-Range"); cr != "bytes 2-5/10" {
+		t.Fatalf("unexpected Content-Range %q", cr)
+	}
+
+	req.Header.Set("Range", "bytes=20-")
+	w = httptest.NewRecorder()
+	r.Route(w, req)
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected 416 for the unsatisfiable range, got %d", w.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package proto
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.drunkce.com/dce/router"
+)
+
+// HttpStream is a flushing response writer of the HttpProtocol, it could be used to send partial output, such as
+// large downloads or long polling responses. The response headers, status code and the session id header will be
+// committed at the first flush, so they should be set before writing anything to the stream.
+//
+// The client disconnection could be detected via the `Done()` channel of the routing context.
+type HttpStream struct {
+	hp         *HttpProtocol
+	controller *http.ResponseController
+	written    int
+}
+
+// Stream switches the response into streaming mode and returns the flushing writer, the content written to the
+// context before will be flushed with the first flush.
+func (h *HttpProtocol) Stream() *HttpStream {
+	if h.stream == nil {
+		h.stream = &HttpStream{hp: h, controller: http.NewResponseController(h.Writer)}
+	}
+	return h.stream
+}
+
+// Streaming reports whether the response was switched into streaming mode.
+func (h *HttpProtocol) Streaming() bool {
+	return h.stream != nil
+}
+
+// StreamedBytes returns the count of the bytes flushed to the client in streaming mode.
+func (h *HttpProtocol) StreamedBytes() int {
+	if h.stream == nil {
+		return 0
+	}
+	return h.stream.written
+}
+
+func (s *HttpStream) Write(bytes []byte) (int, error) {
+	if err := s.flushBuffer(); err != nil {
+		return 0, err
+	}
+	n, err := s.hp.Writer.Write(bytes)
+	s.written += n
+	if err != nil {
+		return n, err
+	}
+	return n, s.controller.Flush()
+}
+
+func (s *HttpStream) WriteString(str string) (int, error) {
+	return s.Write([]byte(str))
+}
+
+// Flush commits the headers if not yet, and flushes the buffered data to the client.
+func (s *HttpStream) Flush() error {
+	if err := s.flushBuffer(); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
+
+func (s *HttpStream) flushBuffer() error {
+	s.hp.commit()
+	if s.hp.ResponseEmpty() {
+		return nil
+	}
+	n, err := s.hp.Writer.Write(s.hp.ClearBuffer())
+	s.written += n
+	return err
+}
+
+const HttpEventStreamContentType = "text/event-stream"
+
+// SseEvent is a Server-Sent Events message, the empty fields will be omitted.
+type SseEvent struct {
+	Id    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+func (e SseEvent) serialize() []byte {
+	var builder strings.Builder
+	if e.Id != "" {
+		builder.WriteString("id: " + sseLineClean(e.Id) + "\n")
+	}
+	if e.Event != "" {
+		builder.WriteString("event: " + sseLineClean(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		builder.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\n") {
+		builder.WriteString("data: " + line + "\n")
+	}
+	builder.WriteString("\n")
+	return []byte(builder.String())
+}
+
+func sseLineClean(field string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(field)
+}
+
+// SseStream is a Server-Sent Events writer based on the HttpStream.
+//
+//	proto.HttpRouter.Get("events", func(h *proto.Http) {
+//		sse := h.Rp.EventStream()
+//		for i := 0; ; i++ {
+//			select {
+//			case <-h.Done():
+//				return
+//			case <-time.After(time.Second):
+//				_ = sse.Send(proto.SseEvent{Id: strconv.Itoa(i), Data: "tick"})
+//			}
+//		}
+//	})
+type SseStream struct {
+	*HttpStream
+}
+
+// EventStream switches the response into Server-Sent Events streaming mode.
+func (h *HttpProtocol) EventStream() *SseStream {
+	h.SetCtxData(router.HttpContentTypeKey, HttpEventStreamContentType)
+	header := h.Writer.Header()
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	return &SseStream{h.Stream()}
+}
+
+// LastEventId returns the id of the last event received by the reconnected client.
+func (h *HttpProtocol) LastEventId() string {
+	return h.Req.Header.Get("Last-Event-ID")
+}
+
+func (s *SseStream) Send(event SseEvent) error {
+	_, err := s.Write(event.serialize())
+	return err
+}
+
+// Comment sends a comment line, it is usually used as a heartbeat to keep the connection alive.
+func (s *SseStream) Comment(text string) error {
+	_, err := s.WriteString(": " + sseLineClean(text) + "\n\n")
+	return err
+}
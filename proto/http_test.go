@@ -0,0 +1,126 @@
+package proto_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/router"
+)
+
+func newHttpRouter() *proto.WrappedHttpRouter {
+	return (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+}
+
+func TestStream(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := newHttpRouter().Get("download", func(h *proto.Http) {
+		h.Rp.SetHeader("X-Before", "1")
+		h.Rp.SetStatus(http.StatusAccepted)
+		_, _ = h.WriteString("buffered ")
+		if w.Flushed || w.Body.Len() > 0 {
+			t.Errorf("expected nothing flushed before streaming, got %q", w.Body.String())
+		}
+		stream := h.Rp.Stream()
+		_, _ = stream.WriteString("chunk")
+		if !w.Flushed || w.Body.String() != "buffered chunk" || w.Code != http.StatusAccepted {
+			t.Errorf("expected the buffer and the chunk flushed, got %t %d %q", w.Flushed, w.Code, w.Body.String())
+		}
+		// the headers were committed at the first flush
+		h.Rp.SetHeader("X-After", "1")
+		_, _ = h.WriteString(" end")
+	})
+	r.Route(w, httptest.NewRequest(http.MethodGet, "/download", nil))
+	resp := w.Result()
+	if body := w.Body.String(); body != "buffered chunk end" {
+		t.Fatalf("unexpected body %q", body)
+	} else if resp.Header.Get("X-Before") != "1" || resp.Header.Get("X-After") != "" {
+		t.Fatalf("expected only the headers set before the first flush, got %v", resp.Header)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := newHttpRouter().Get("events", func(h *proto.Http) {
+		sse := h.Rp.EventStream()
+		_ = sse.Send(proto.SseEvent{Id: "1", Event: "tick\n", Data: "a\r\nb"})
+		_ = sse.Comment("ping")
+		if h.Rp.StreamedBytes() != w.Body.Len() {
+			t.Errorf("expected %d streamed bytes, got %d", w.Body.Len(), h.Rp.StreamedBytes())
+		}
+	})
+	r.Route(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if body := w.Body.String(); body != "id: 1\nevent: tick\ndata: a\ndata: b\n\n: ping\n\n" {
+		t.Fatalf("unexpected body %q", body)
+	} else if ct := w.Header().Get(router.HttpContentTypeKey); ct != proto.HttpEventStreamContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	} else if w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("expected no-cache, got %v", w.Header())
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	r := newHttpRouter().Get("old", func(h *proto.Http) {
+		h.Rp.Redirect("/new", 0)
+	}).Get("moved", func(h *proto.Http) {
+		h.Rp.Redirect("https://example.com/new", http.StatusMovedPermanently)
+	})
+	for path, expected := range map[string]struct {
+		code     int
+		location string
+	}{
+		"/old":   {http.StatusFound, "/new"},
+		"/moved": {http.StatusMovedPermanently, "https://example.com/new"},
+	} {
+		w := httptest.NewRecorder()
+		r.Route(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != expected.code || w.Header().Get("Location") != expected.location {
+			t.Errorf("%s: expected %d to %q, got %d to %q", path, expected.code, expected.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestSidCookie(t *testing.T) {
+	newRouter := func() *proto.WrappedHttpRouter {
+		return newHttpRouter().Get("login", func(h *proto.Http) {
+			h.Rp.SetRespSid("new-sid")
+		}).Get("sid", func(h *proto.Http) {
+			_, _ = h.WriteString(h.Rp.Sid())
+		})
+	}
+	r := newRouter().SetSidCookie(proto.DefaultSidCookie())
+	w := httptest.NewRecorder()
+	r.Route(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a sid cookie, got %v", cookies)
+	} else if c := cookies[0]; c.Name != "session_id" || c.Value != "new-sid" || c.Path != "/" || !c.Secure || !c.HttpOnly ||
+		c.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected sid cookie %v", c)
+	} else if w.Header().Get(proto.HeaderSidKey) != "new-sid" {
+		t.Fatalf("expected the sid header, got %v", w.Header())
+	}
+
+	// the cookie template is per router
+	w = httptest.NewRecorder()
+	newRouter().Route(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	if len(w.Result().Cookies()) > 0 || w.Header().Get(proto.HeaderSidKey) != "new-sid" {
+		t.Fatalf("expected only the sid header from the router without cookie, got %v", w.Header())
+	}
+
+	// the custom cookie name is accepted as the request sid
+	r = newRouter().SetSidCookie(&http.Cookie{Name: "sid", Path: "/"})
+	req := httptest.NewRequest(http.MethodGet, "/sid", nil)
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "cookie-sid"})
+	w = httptest.NewRecorder()
+	r.Route(w, req)
+	if w.Body.String() != "cookie-sid" {
+		t.Fatalf("expected the sid from the custom cookie, got %q", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.SetSidCookie(nil).Route(w, req)
+	if w.Body.String() != "" {
+		t.Fatalf("expected the custom cookie ignored after unset, got %q", w.Body.String())
+	}
+}
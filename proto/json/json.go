@@ -10,6 +10,7 @@ import (
 
 type PackageProtocol[Req any] struct {
 	router.Meta[Req]
+	router.RespondedNotifier
 	pkg *Package
 }
 
@@ -29,11 +30,22 @@ func (p *PackageProtocol[Req]) Body() ([]byte, error) {
 	return p.pkg.Body, nil
 }
 
+// ContentLength returns the length of the request body.
+func (p *PackageProtocol[Req]) ContentLength() int64 {
+	return int64(len(p.pkg.Body))
+}
+
+// RequestHeader returns the request header value carried by the package, the key is case-insensitive.
+func (p *PackageProtocol[Req]) RequestHeader(key string) string {
+	return router.HeaderValue(p.pkg.Headers, key)
+}
+
 func (p *PackageProtocol[Req]) ClearBuffer() []byte {
 	p.pkg.Sid = p.RespSid()
 	p.pkg.Body = p.Meta.ClearBuffer()
 	code, message := p.ErrorUnits()
 	p.pkg.Code, p.pkg.Msg = int32(code), message
+	p.pkg.Headers = nil
 	return p.pkg.Serialize()
 }
 
@@ -42,7 +54,7 @@ func NewPackageProtocol[Req any](data []byte, meta router.Meta[Req]) (*PackagePr
 	if err != nil {
 		return nil, err
 	}
-	return &PackageProtocol[Req]{meta, pkg}, nil
+	return &PackageProtocol[Req]{Meta: meta, pkg: pkg}, nil
 }
 
 type Package struct {
@@ -52,6 +64,8 @@ type Package struct {
 	Code int32  `json:"code,omitempty"`
 	Msg  string `json:"msg,omitempty"`
 	Body []byte `json:"body,omitempty"`
+	// Headers carries the request headers such as the idempotency key, it will not be echoed in the response.
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 func (p *Package) Serialize() []byte {
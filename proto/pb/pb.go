@@ -6,12 +6,15 @@ import (
 	"sync/atomic"
 
 	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
 	"google.golang.org/protobuf/proto"
 )
 
 type PackageProtocol[Req any] struct {
 	router.Meta[Req]
-	pkg *Package
+	router.RespondedNotifier
+	pkg    *Package
+	pusher func(seq []byte) error
 }
 
 func (p *PackageProtocol[Req]) Id() uint32 {
@@ -30,6 +33,16 @@ func (p *PackageProtocol[Req]) Body() ([]byte, error) {
 	return p.pkg.GetBody(), nil
 }
 
+// ContentLength returns the length of the request body.
+func (p *PackageProtocol[Req]) ContentLength() int64 {
+	return int64(len(p.pkg.GetBody()))
+}
+
+// RequestHeader returns the request header value carried by the package, the key is case-insensitive.
+func (p *PackageProtocol[Req]) RequestHeader(key string) string {
+	return router.HeaderValue(p.pkg.GetHeaders(), key)
+}
+
 func (p *PackageProtocol[Req]) ClearBuffer() []byte {
 	respSid := p.RespSid()
 	p.pkg.Sid = &respSid
@@ -37,6 +50,7 @@ func (p *PackageProtocol[Req]) ClearBuffer() []byte {
 	code, message := p.ErrorUnits()
 	i32Code := int32(code)
 	p.pkg.Code, p.pkg.Msg = &i32Code, &message
+	p.pkg.Headers = nil
 	return pkgSerialize(p.pkg)
 }
 
@@ -45,7 +59,20 @@ func NewPackageProtocol[Req any](bts []byte, meta router.Meta[Req]) (*PackagePro
 	if err != nil {
 		return nil, err
 	}
-	return &PackageProtocol[Req]{meta, pkg}, nil
+	return &PackageProtocol[Req]{Meta: meta, pkg: pkg}, nil
+}
+
+// SetPusher binds a connection writer to the protocol, so that the server can push packages to the client
+// outside the request-response cycle, it is required by the service streaming methods.
+func (p *PackageProtocol[Req]) SetPusher(pusher func(seq []byte) error) {
+	p.pusher = pusher
+}
+
+func (p *PackageProtocol[Req]) Push(seq []byte) error {
+	if p.pusher == nil {
+		return util.Closed0(`Protocol of request "%s" does not support server push`, p.Path())
+	}
+	return p.pusher(seq)
 }
 
 func pkgSerialize(pkg *Package) []byte {
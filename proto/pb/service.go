@@ -0,0 +1,199 @@
+package pb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Pusher is implemented by the routable protocols which hold a persistent connection, such as the WebSocket and TCP
+// package protocols, it is used by ServerStream to push packages to the client.
+type Pusher interface {
+	Push(seq []byte) error
+}
+
+// ServerStream is the server side of a streaming rpc method. Each sent message is pushed to the client as an
+// independent Package with the same id and path as the request, the final response package (with the code and
+// message of the method result) marks the end of the stream.
+type ServerStream struct {
+	ctx    context.Context
+	id     uint32
+	path   string
+	pusher Pusher
+}
+
+func (s *ServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *ServerStream) Send(msg proto.Message) error {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.pusher.Push(PackageSerialize(s.path, body, "", int(s.id)))
+}
+
+var (
+	contextType      = reflect.TypeFor[context.Context]()
+	errorType        = reflect.TypeFor[error]()
+	messageType      = reflect.TypeFor[proto.Message]()
+	serverStreamType = reflect.TypeFor[*ServerStream]()
+)
+
+type serviceMethod struct {
+	name      string
+	method    reflect.Value
+	in        reflect.Type
+	streaming bool
+}
+
+// parseServiceMethod checks whether the method matches one of the supported rpc signatures:
+//
+//	func(ctx context.Context, req *Req) (*Resp, error)  // unary
+//	func(req *Req, stream *pb.ServerStream) error        // server streaming
+func parseServiceMethod(name string, method reflect.Value) (*serviceMethod, bool) {
+	ty := method.Type()
+	if ty.NumIn() != 2 {
+		return nil, false
+	}
+	if ty.In(0) == contextType && ty.In(1).Implements(messageType) && ty.NumOut() == 2 &&
+		ty.Out(0).Implements(messageType) && ty.Out(1) == errorType {
+		return &serviceMethod{name: name, method: method, in: ty.In(1)}, true
+	} else if ty.In(0).Implements(messageType) && ty.In(1) == serverStreamType && ty.NumOut() == 1 && ty.Out(0) == errorType {
+		return &serviceMethod{name: name, method: method, in: ty.In(0), streaming: true}, true
+	}
+	return nil, false
+}
+
+func (m *serviceMethod) newRequest(body []byte) (reflect.Value, error) {
+	req := reflect.New(m.in.Elem())
+	if err := proto.Unmarshal(body, req.Interface().(proto.Message)); err != nil {
+		return reflect.Value{}, util.Openly(400, "Invalid request body: %s", err.Error())
+	}
+	return req, nil
+}
+
+func serviceController[Rp router.RoutableProtocol](m *serviceMethod) func(c *router.Context[Rp]) {
+	return func(c *router.Context[Rp]) {
+		body, err := c.Body()
+		if err != nil {
+			c.SetError(err)
+			return
+		}
+		req, err := m.newRequest(body)
+		if err != nil {
+			c.SetError(err)
+			return
+		}
+		if m.streaming {
+			pusher, ok := any(c.Rp).(Pusher)
+			if !ok {
+				c.SetError(util.Closed0(`Rpc "%s" is a streaming method, but protocol "%T" cannot push`, m.name, c.Rp))
+				return
+			}
+			stream := &ServerStream{ctx: c, id: c.Rp.Id(), path: c.Rp.Path(), pusher: pusher}
+			if errVal := m.method.Call([]reflect.Value{req, reflect.ValueOf(stream)})[0]; !errVal.IsNil() {
+				c.SetError(serviceError(errVal.Interface().(error)))
+			}
+			return
+		}
+		outs := m.method.Call([]reflect.Value{reflect.ValueOf(c), req})
+		if !outs[1].IsNil() {
+			c.SetError(serviceError(outs[1].Interface().(error)))
+			return
+		} else if outs[0].IsNil() {
+			return
+		}
+		seq, err := proto.Marshal(outs[0].Interface().(proto.Message))
+		if err != nil {
+			c.SetError(err)
+		} else if _, err = c.Write(seq); err != nil {
+			c.SetError(err)
+		}
+	}
+}
+
+// ServiceCoder could be implemented by the errors returned from the rpc methods to specify the response
+// `Package.Code`, the error message will be used as the `Package.Msg`.
+type ServiceCoder interface {
+	ServiceCode() int
+}
+
+func serviceError(err error) error {
+	var e util.Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var coder ServiceCoder
+	if errors.As(err, &coder) {
+		return util.Openly(coder.ServiceCode(), "%s", err.Error())
+	}
+	return err
+}
+
+// BindService binds the rpc methods of a service implementation into the router, each matched method will be
+// pushed as an Api with path "service/Method". The request body will be decoded into the typed request message,
+// and the returned message will be encoded into the response body. Returned errors are translated into the
+// `Package.Code` and `Package.Msg`, openly `util.Error` or `ServiceCoder` errors are exposed to the client.
+//
+//	type GreeterServer interface {
+//		SayHello(ctx context.Context, req *HelloRequest) (*HelloReply, error)
+//		Subscribe(req *SubscribeRequest, stream *pb.ServerStream) error
+//	}
+//	pb.BindService(pb.WebsocketRouter.Router, "greeter", &greeterServer{})
+//
+// The ctx passed to unary methods is the routing context, it could be asserted to the concrete `*router.Context`.
+// Streaming methods should send messages via the stream, which pushes them through the request connection, so they
+// are only available on the connection-oriented protocols such as WebSocket and TCP.
+func BindService[Rp router.RoutableProtocol](r *router.Router[Rp], service string, impl any) *router.Router[Rp] {
+	rv := reflect.ValueOf(impl)
+	bound := 0
+	for i := 0; i < rv.NumMethod(); i++ {
+		name := rv.Type().Method(i).Name
+		if m, ok := parseServiceMethod(name, rv.Method(i)); ok {
+			r.Push(fmt.Sprintf("%s%s%s", service, router.MarkPathPartSeparator, name), serviceController[Rp](m))
+			bound++
+		}
+	}
+	if bound == 0 {
+		log.Panicf(`Type "%T" has no method matches the rpc signatures`, impl)
+	}
+	return r
+}
+
+// BindServiceDesc binds the service implementation according to a protobuf service descriptor, the full name of the
+// service will be used as the path prefix. Every rpc defined in the descriptor must be implemented with the matched
+// request/response types and streaming mode, client streaming rpc is not supported.
+func BindServiceDesc[Rp router.RoutableProtocol](r *router.Router[Rp], sd protoreflect.ServiceDescriptor, impl any) *router.Router[Rp] {
+	rv := reflect.ValueOf(impl)
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		name := string(md.Name())
+		method := rv.MethodByName(name)
+		if !method.IsValid() {
+			log.Panicf(`Rpc "%s" of service "%s" is not implemented by "%T"`, name, sd.FullName(), impl)
+		} else if md.IsStreamingClient() {
+			log.Panicf(`Rpc "%s" of service "%s" is client streaming, it is not supported`, name, sd.FullName())
+		}
+		m, ok := parseServiceMethod(name, method)
+		if !ok || m.streaming != md.IsStreamingServer() || messageName(m.in) != md.Input().FullName() ||
+			(!m.streaming && messageName(method.Type().Out(0)) != md.Output().FullName()) {
+			log.Panicf(`Method "%s" of "%T" does not match the rpc definition`, name, impl)
+		}
+		r.Push(fmt.Sprintf("%s%s%s", sd.FullName(), router.MarkPathPartSeparator, name), serviceController[Rp](m))
+	}
+	return r
+}
+
+func messageName(ty reflect.Type) protoreflect.FullName {
+	return reflect.Zero(ty).Interface().(proto.Message).ProtoReflect().Descriptor().FullName()
+}
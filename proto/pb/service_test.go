@@ -0,0 +1,189 @@
+package pb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type conflictError struct{}
+
+func (conflictError) Error() string {
+	return "conflicted"
+}
+
+func (conflictError) ServiceCode() int {
+	return 409
+}
+
+type echoServer struct{}
+
+func (echoServer) Say(_ context.Context, req *Package) (*Package, error) {
+	switch string(req.GetBody()) {
+	case "openly":
+		return nil, util.Openly(422, "invalid")
+	case "coded":
+		return nil, conflictError{}
+	case "closed":
+		return nil, errors.New("internal detail")
+	}
+	return &Package{Body: append([]byte("echo "), req.GetBody()...)}, nil
+}
+
+func (echoServer) Watch(req *Package, stream *ServerStream) error {
+	for i := range 2 {
+		if err := stream.Send(&Package{Body: []byte{byte('0' + i)}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name does not match the rpc signatures, it should be ignored
+func (echoServer) Name() string {
+	return "echo"
+}
+
+type rp = *PackageProtocol[int]
+
+// call routes a request with the message body, and returns the response package with the unmarshalled message
+func call(t *testing.T, r *router.Router[rp], path string, body string, pushed *[][]byte) (*Package, *Package) {
+	req, _ := proto.Marshal(&Package{Body: []byte(body)})
+	p, err := NewPackageProtocol(PackageSerialize(path, req, "", 1), router.NewMeta(0, nil, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed != nil {
+		p.SetPusher(func(seq []byte) error {
+			*pushed = append(*pushed, seq)
+			return nil
+		})
+	}
+	r.Route(router.NewContext(p))
+	resp, err := PackageDeserialize(p.ClearBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg Package
+	if err = proto.Unmarshal(resp.GetBody(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	return resp, &msg
+}
+
+func TestBindService(t *testing.T) {
+	r := BindService(router.NewRouter[rp](), "echo", echoServer{})
+	if resp, msg := call(t, r, "echo/Say", "hi", nil); resp.GetCode() != 0 || string(msg.GetBody()) != "echo hi" {
+		t.Fatalf("unexpected unary response %v", resp)
+	}
+	for body, expected := range map[string]int32{"openly": 422, "coded": 409, "closed": util.ServiceUnavailable} {
+		resp, _ := call(t, r, "echo/Say", body, nil)
+		if resp.GetCode() != expected {
+			t.Errorf("expected the %s error translated to %d, got %v", body, expected, resp)
+		} else if body == "closed" && strings.Contains(resp.GetMsg(), "internal detail") {
+			t.Errorf("the closed error should not be exposed, got %q", resp.GetMsg())
+		}
+	}
+	if resp, _ := call(t, r, "echo/Name", "", nil); resp.GetCode() != router.CodeNotFound {
+		t.Fatalf("the non-rpc method should not be bound, got %v", resp)
+	}
+
+	var pushed [][]byte
+	if resp, _ := call(t, r, "echo/Watch", "", &pushed); resp.GetCode() != 0 || len(pushed) != 2 {
+		t.Fatalf("expected 2 messages pushed before the final response, got %d, %v", len(pushed), resp)
+	}
+	for i, seq := range pushed {
+		pkg, _ := PackageDeserialize(seq)
+		var msg Package
+		if err := proto.Unmarshal(pkg.GetBody(), &msg); err != nil || pkg.GetId() != 1 || pkg.GetPath() != "echo/Watch" ||
+			string(msg.GetBody()) != string(rune('0'+i)) {
+			t.Fatalf("unexpected pushed package %v, %v", pkg, err)
+		}
+	}
+	if resp, _ := call(t, r, "echo/Watch", "", nil); resp.GetCode() != util.ServiceUnavailable {
+		t.Fatalf("streaming without pusher should fail, got %v", resp)
+	}
+}
+
+func serviceDesc(t *testing.T, methods ...*descriptorpb.MethodDescriptorProto) protoreflect.ServiceDescriptor {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("echo.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{File_package_proto.Path(), (&emptypb.Empty{}).ProtoReflect().Descriptor().ParentFile().Path()},
+		Service:    []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Echo"), Method: methods}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Services().Get(0)
+}
+
+func rpc(name string, in string, out string, clientStreaming bool, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{Name: proto.String(name), InputType: proto.String(in), OutputType: proto.String(out),
+		ClientStreaming: proto.Bool(clientStreaming), ServerStreaming: proto.Bool(serverStreaming)}
+}
+
+func TestBindServiceDesc(t *testing.T) {
+	sd := serviceDesc(t, rpc("Say", ".Package", ".Package", false, false), rpc("Watch", ".Package", ".Package", false, true))
+	r := BindServiceDesc(router.NewRouter[rp](), sd, echoServer{})
+	if resp, msg := call(t, r, "test.Echo/Say", "hi", nil); string(msg.GetBody()) != "echo hi" {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	var pushed [][]byte
+	if resp, _ := call(t, r, "test.Echo/Watch", "", &pushed); resp.GetCode() != 0 || len(pushed) != 2 {
+		t.Fatalf("expected 2 messages pushed, got %d, %v", len(pushed), resp)
+	}
+}
+
+func expectPanic(t *testing.T, name string, contains string, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		if r := recover(); r == nil {
+			t.Errorf("%s: expected a panic", name)
+		} else if !strings.Contains(r.(string), contains) {
+			t.Errorf("%s: expected the panic contains %q, got %q", name, contains, r)
+		}
+	}()
+	fn()
+}
+
+type noRpcServer struct{}
+
+func (noRpcServer) Hello(name string) string {
+	return "hello " + name
+}
+
+func TestBindServicePanics(t *testing.T) {
+	expectPanic(t, "no rpc", "has no method matches", func() {
+		BindService(router.NewRouter[rp](), "none", noRpcServer{})
+	})
+	const empty = ".google.protobuf.Empty"
+	for name, c := range map[string]struct {
+		rpc      *descriptorpb.MethodDescriptorProto
+		contains string
+	}{
+		"missing":          {rpc("Missing", ".Package", ".Package", false, false), "is not implemented"},
+		"client streaming": {rpc("Say", ".Package", ".Package", true, false), "is client streaming"},
+		"server streaming": {rpc("Say", ".Package", ".Package", false, true), "does not match"},
+		"unary":            {rpc("Watch", ".Package", ".Package", false, false), "does not match"},
+		"input":            {rpc("Say", empty, ".Package", false, false), "does not match"},
+		"output":           {rpc("Say", ".Package", empty, false, false), "does not match"},
+	} {
+		sd := serviceDesc(t, c.rpc)
+		expectPanic(t, name, c.contains, func() {
+			BindServiceDesc(router.NewRouter[rp](), sd, echoServer{})
+		})
+	}
+}
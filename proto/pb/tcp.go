@@ -31,14 +31,23 @@ func (t *WrappedTcpRouter) Route(conn net.Conn, ctxData map[string]any) bool {
 	}
 	sw := &TcpProtocol{pkg}
 	context := router.NewContext(sw)
+	// the pushed messages are counted in the response bytes
+	var pushed int
+	sw.SetPusher(func(seq []byte) error {
+		n, err := conn.Write(flex.StreamPack(seq))
+		pushed += n
+		return err
+	})
 	t.Router.Route(context)
 	sw.TryPrintErr()
+	var n int
 	if context.Api != nil && context.Api.Responsive {
 		bytes := sw.ClearBuffer()
-		if _, err = conn.Write(flex.StreamPack(bytes)); err != nil {
+		if n, err = conn.Write(flex.StreamPack(bytes)); err != nil {
 			slog.Error(err.Error())
 		}
 	}
+	sw.Responded(pushed + n)
 	return true
 }
 
@@ -31,14 +31,27 @@ func (w *WrappedWebsocketRouter) Route(conn *websocket.Conn, req *http.Request,
 	}
 	sw := &WebsocketProtocol{pkg}
 	context := router.NewContext(sw)
+	// the pushed messages are counted in the response bytes
+	var pushed int
+	sw.SetPusher(func(seq []byte) error {
+		if err := conn.Write(context, ty, seq); err != nil {
+			return err
+		}
+		pushed += len(seq)
+		return nil
+	})
 	w.Router.Route(context)
 	sw.TryPrintErr()
+	var n int
 	if context.Api != nil && context.Api.Responsive {
 		bytes := sw.ClearBuffer()
 		if err = conn.Write(context, ty, bytes); err != nil {
 			slog.Error(err.Error())
+		} else {
+			n = len(bytes)
 		}
 	}
+	sw.Responded(pushed + n)
 	return true
 }
 
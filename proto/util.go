@@ -6,19 +6,36 @@ import (
 	"sync"
 
 	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
 	"go.drunkce.com/dce/util"
 )
 
 func NewConnectorMappingManager[Rp router.RoutableProtocol, C any](routerId string) ConnectorMappingManager[Rp, C] {
-	return ConnectorMappingManager[Rp, C]{router.ProtoRouter[Rp](routerId), util.NewStruct[sync.Map](), util.NewStruct[sync.Map]()}
+	return ConnectorMappingManager[Rp, C]{router.ProtoRouter[Rp](routerId), routerId, util.NewStruct[sync.Map](), util.NewStruct[sync.Map]()}
 }
 
 type ConnectorMappingManager[Rp router.RoutableProtocol, C any] struct {
 	*router.Router[Rp]
+	id          string
 	connMapping sync.Map
 	uidMapping  sync.Map
 }
 
+// Id returns the router id, such as "flex-websocket".
+func (w *ConnectorMappingManager[Rp, C]) Id() string {
+	return w.id
+}
+
+// ConnCount returns the count of the live connections.
+func (w *ConnectorMappingManager[Rp, C]) ConnCount() int {
+	count := 0
+	w.connMapping.Range(func(_, _ any) bool {
+		count++
+		return true
+	})
+	return count
+}
+
 func (w *ConnectorMappingManager[Rp, C]) SetMapping(addr string, conn C) {
 	w.connMapping.Store(addr, conn)
 }
@@ -79,3 +96,26 @@ func (w *ConnectorMappingManager[Rp, C]) UidMapping() map[string]uint64 {
 	})
 	return um
 }
+
+// CloseEvicted closes the live connections bound to the sessions evicted by the login policy or LogoutAll, the
+// connections are located by the client address stored in the connection session, so the shadow session should be
+// bound via `Connect` with the same address as the mapping.
+//
+//	cancel := flex.WebsocketRouter.CloseEvicted(func(conn *websocket.Conn) error {
+//		return conn.Close(websocket.StatusPolicyViolation, "session evicted")
+//	})
+func (w *ConnectorMappingManager[Rp, C]) CloseEvicted(closer func(conn C) error) (cancel func()) {
+	return session.Listen(func(e session.Event) {
+		if e.Client == "" {
+			return
+		}
+		if conn, ok := w.ConnBy(e.Client); ok {
+			w.Unmapping(e.Client)
+			go func() {
+				if err := closer(conn); err != nil {
+					w.Warn(err)
+				}
+			}()
+		}
+	}, session.EventEvicted)
+}
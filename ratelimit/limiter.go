@@ -0,0 +1,104 @@
+// Package ratelimit throttles the routed requests of all the protocols, the requests could be limited per client
+// address, sid, uid or api, with the token bucket or the sliding window algorithm, and the limits could be kept in
+// memory or shared across the nodes via Redis.
+//
+//	limiter := ratelimit.New[*proto.HttpProtocol](ratelimit.NewMemoryStore()).
+//		SetRule("*", &ratelimit.Rule{Limit: 20, Window: time.Second, By: ratelimit.KeyAddr}).
+//		SetRule("order+", &ratelimit.Rule{Algorithm: ratelimit.SlidingWindow, Limit: 1000, Window: 24 * time.Hour, By: ratelimit.KeyUid|ratelimit.KeyApi})
+//	proto.HttpRouter.Raw().SetBefore("*", router.Chain(sessions.Before, limiter.Check))
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+type Algorithm uint8
+
+const (
+	// TokenBucket allows bursts up to the limit, and refills the tokens evenly over the window.
+	TokenBucket Algorithm = iota
+	// SlidingWindow limits the requests in any window, it is approximated by weighting the previous fixed window, it is
+	// suitable for the quotas such as 1000 requests per day.
+	SlidingWindow
+)
+
+// Rule is a rate limit rule.
+//
+// Fields:
+//   - Algorithm: The limit algorithm, the token bucket by default.
+//   - Limit: The max requests in the window, or the capacity of the token bucket.
+//   - Window: The duration of the window, or the duration to refill the full token bucket.
+//   - By: The key parts to count the requests separately, such as `KeyUid|KeyApi`, all the requests share the limit if
+//     not specified.
+//   - Name: Distinguishes the counters of the rules with the same key parts, such as a burst limit and a daily quota,
+//     the rule will be named by its limit and window if not specified.
+type Rule struct {
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+	By        Key
+	Name      string
+}
+
+// Result is the result of taking a request from a limit.
+//
+// Fields:
+//   - Allowed: Whether the request is allowed.
+//   - Limit: The limit of the rule.
+//   - Remaining: The remaining requests could be taken immediately.
+//   - RetryAfter: The duration to wait before the next request could be allowed, it is zero if allowed.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Store keeps the limit states, the MemoryStore keeps them in the process, and the `redises.Store` shares them across
+// the nodes.
+type Store interface {
+	// Take takes a request from the limit identified by the key, the key is unique for the rule.
+	Take(key string, rule *Rule) (Result, error)
+}
+
+// tokenBucket calculates the token bucket, the tokens are refilled since the last stamp, all the stamps are in
+// milliseconds.
+func tokenBucket(rule *Rule, tokens float64, last int64, now int64) (float64, Result) {
+	window := max(rule.Window.Milliseconds(), 1)
+	rate := float64(rule.Limit) / float64(window)
+	if elapsed := now - last; elapsed > 0 {
+		tokens = min(float64(rule.Limit), tokens+float64(elapsed)*rate)
+	}
+	result := Result{Limit: rule.Limit}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	result.Remaining = int(tokens)
+	return tokens, result
+}
+
+// slidingWindow calculates the approximated sliding window by the counts of the current and previous fixed windows,
+// the count of the current window should be increased if allowed.
+func slidingWindow(rule *Rule, current int64, previous int64, elapsed int64) Result {
+	window := max(rule.Window.Milliseconds(), 1)
+	count := float64(previous)*float64(window-elapsed)/float64(window) + float64(current)
+	result := Result{Limit: rule.Limit}
+	if count+1 <= float64(rule.Limit) {
+		result.Allowed = true
+		result.Remaining = int(float64(rule.Limit) - count - 1)
+		return result
+	}
+	// the previous window count decays linearly, wait until it decays enough or the current window ends
+	wait := window - elapsed
+	if previous > 0 {
+		if decay := int64((count + 1 - float64(rule.Limit)) * float64(window) / float64(previous)); decay < wait {
+			wait = decay + 1
+		}
+	}
+	result.RetryAfter = time.Duration(wait) * time.Millisecond
+	return result
+}
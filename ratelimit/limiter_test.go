@@ -0,0 +1,100 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/ratelimit"
+	"go.drunkce.com/dce/router"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func take(t *testing.T, store ratelimit.Store, rule *ratelimit.Rule, n int) (allowed int, last ratelimit.Result) {
+	t.Helper()
+	for range n {
+		result, err := store.Take("key", rule)
+		if err != nil {
+			t.Fatal(err)
+		} else if result.Allowed {
+			allowed++
+		}
+		last = result
+	}
+	return
+}
+
+func TestMemoryTokenBucket(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	store := ratelimit.NewMemoryStore().SetClock(c.Now)
+	rule := &ratelimit.Rule{Limit: 5, Window: time.Second}
+	if allowed, last := take(t, store, rule, 6); allowed != 5 || last.RetryAfter <= 0 || last.RetryAfter > 200*time.Millisecond {
+		t.Fatalf("expected 5 allowed with a retry hint, got %d, %v", allowed, last.RetryAfter)
+	}
+	c.now = c.now.Add(400 * time.Millisecond)
+	if allowed, _ := take(t, store, rule, 3); allowed != 2 {
+		t.Fatalf("expected 2 tokens refilled, got %d", allowed)
+	}
+}
+
+func TestMemorySlidingWindow(t *testing.T) {
+	// start at the beginning of a window
+	c := &clock{now: time.Unix(60*1000, 0)}
+	store := ratelimit.NewMemoryStore().SetClock(c.Now)
+	rule := &ratelimit.Rule{Algorithm: ratelimit.SlidingWindow, Limit: 10, Window: time.Minute}
+	if allowed, last := take(t, store, rule, 12); allowed != 10 || last.RetryAfter <= 0 {
+		t.Fatalf("expected 10 allowed, got %d, %v", allowed, last.RetryAfter)
+	}
+	// half of the previous window is weighted
+	c.now = c.now.Add(90 * time.Second)
+	if allowed, _ := take(t, store, rule, 10); allowed != 5 {
+		t.Fatalf("expected 5 allowed in the sliding window, got %d", allowed)
+	}
+	c.now = c.now.Add(3 * time.Minute)
+	if store.Sweep() != 1 {
+		t.Fatal("expected the idle entry swept")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	r.Get("free", func(h *proto.Http) {}).
+		PushApi(ratelimit.WithRule(router.Path("sms").ByMethod(proto.HttpPost), &ratelimit.Rule{Limit: 1, Window: time.Minute, By: ratelimit.KeyAddr}), func(h *proto.Http) {})
+	limiter := ratelimit.New[*proto.HttpProtocol](ratelimit.NewMemoryStore()).
+		SetRule("*", &ratelimit.Rule{Limit: 3, Window: time.Minute, By: ratelimit.KeyAddr | ratelimit.KeyApi})
+	r.Raw().SetBefore("*", limiter.Check)
+	do := func(method string, path string, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/"+path, nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		r.Route(w, req)
+		return w
+	}
+
+	for i := range 3 {
+		if w := do(http.MethodGet, "free", "10.0.0.1:1234"); w.Code != http.StatusOK || w.Header().Get(ratelimit.HeaderRateLimitRemaining) != []string{"2", "1", "0"}[i] {
+			t.Fatalf("expected allowed with the remaining header, got %d, %v", w.Code, w.Header())
+		}
+	}
+	if w := do(http.MethodGet, "free", "10.0.0.1:5678"); w.Code != ratelimit.CodeTooManyRequests || w.Header().Get(ratelimit.HeaderRetryAfter) == "" {
+		t.Fatalf("expected 429 with the retry header, got %d, %v", w.Code, w.Header())
+	}
+	if w := do(http.MethodGet, "free", "10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expected the other client allowed, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "sms", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expected the api rule used, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "sms", "10.0.0.1:1234"); w.Code != ratelimit.CodeTooManyRequests {
+		t.Fatalf("expected the api rule limited, got %d", w.Code)
+	}
+}
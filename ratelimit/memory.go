@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	mu sync.Mutex
+	// tokens and stamp are the token bucket states
+	tokens float64
+	stamp  int64
+	// window, current and previous are the sliding window states
+	window   int64
+	current  int64
+	previous int64
+	// expireAt is the stamp after which the entry is identical to a new one, so that it could be swept
+	expireAt int64
+}
+
+// MemoryStore keeps the limit states in the process, it is suitable for the single-node deployments.
+type MemoryStore struct {
+	entries sync.Map
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now}
+}
+
+// SetClock replaces the clock, it is used to simulate the time passing in tests.
+func (m *MemoryStore) SetClock(now func() time.Time) *MemoryStore {
+	m.now = now
+	return m
+}
+
+func (m *MemoryStore) Take(key string, rule *Rule) (Result, error) {
+	now := m.now().UnixMilli()
+	e, _ := m.entries.LoadOrStore(key, &memoryEntry{tokens: float64(rule.Limit), stamp: now})
+	entry := e.(*memoryEntry)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	window := max(rule.Window.Milliseconds(), 1)
+	entry.expireAt = now + window*2
+	if rule.Algorithm == SlidingWindow {
+		index := now / window
+		if index == entry.window+1 {
+			entry.previous, entry.current = entry.current, 0
+		} else if index != entry.window {
+			entry.previous, entry.current = 0, 0
+		}
+		entry.window = index
+		result := slidingWindow(rule, entry.current, entry.previous, now-index*window)
+		if result.Allowed {
+			entry.current++
+		}
+		return result, nil
+	}
+	var result Result
+	entry.tokens, result = tokenBucket(rule, entry.tokens, entry.stamp, now)
+	entry.stamp = now
+	return result, nil
+}
+
+// Sweep deletes the idle entries and returns the count.
+func (m *MemoryStore) Sweep() int {
+	now, count := m.now().UnixMilli(), 0
+	m.entries.Range(func(key, e any) bool {
+		entry := e.(*memoryEntry)
+		entry.mu.Lock()
+		idle := entry.expireAt <= now
+		entry.mu.Unlock()
+		if idle && m.entries.CompareAndDelete(key, e) {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// StartSweeper sweeps the idle entries periodically in background until the stop function called.
+func (m *MemoryStore) StartSweeper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.Sweep()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/util"
+)
+
+const CodeTooManyRequests = 429
+
+const (
+	HeaderRetryAfter         = "Retry-After"
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+)
+
+// Key specifies the parts to identify the limit counters, they could be combined such as `KeyUid|KeyApi`.
+type Key uint8
+
+const (
+	// KeyAddr counts by the client host, the port is ignored.
+	KeyAddr Key = 1 << iota
+	// KeySid counts by the request sid.
+	KeySid
+	// KeyUid counts by the uid of the session user, the anonymous requests will be counted by the client host instead.
+	KeyUid
+	// KeyApi counts by the matched api path, but not the raw request path.
+	KeyApi
+)
+
+const extraRulesKey = "$#RATE-LIMIT#"
+
+// WithRule binds the rules to the api, they have a higher priority than the rules set via `Limiter.SetRule`.
+//
+//	proto.HttpRouter.PushApi(ratelimit.WithRule(router.Path("sms").ByMethod(proto.HttpPost), &ratelimit.Rule{Limit: 1, Window: time.Minute, By: ratelimit.KeyUid}), controller)
+func WithRule(api router.Api, rules ...*Rule) router.Api {
+	return api.Append(extraRulesKey, util.MapSeqFrom[*Rule, any](rules).Map(func(r *Rule) any {
+		return r
+	}).Collect()...)
+}
+
+// Limiter limits the routed requests by the rules, it could be used as a before hook of any router, the rejected
+// requests get the 429 error, with the `Retry-After` header for HTTP, or the code and the retry hint in the message of
+// the flex, json and pb packages. The requests will be allowed if the store failed.
+type Limiter[Rp router.RoutableProtocol] struct {
+	store Store
+	rules []*util.Tuple2[string, []*Rule]
+}
+
+func New[Rp router.RoutableProtocol](store Store) *Limiter[Rp] {
+	return &Limiter[Rp]{store: store}
+}
+
+// SetRule sets the rules to the apis matched the path pattern, the pattern syntax is the same as that in the
+// `router.SetBefore` method, the later set pattern has a higher priority. It should be called before serving.
+func (l *Limiter[Rp]) SetRule(pattern string, rules ...*Rule) *Limiter[Rp] {
+	l.rules = append(l.rules, util.NewTuple2(pattern, rules))
+	return l
+}
+
+func (l *Limiter[Rp]) rulesOf(api *router.Api) []*Rule {
+	if extras := api.ExtrasBy(extraRulesKey); len(extras) > 0 {
+		return util.MapSeqFrom[any, *Rule](extras).Map(func(r any) *Rule {
+			return r.(*Rule)
+		}).Collect()
+	}
+	for i := len(l.rules) - 1; i >= 0; i-- {
+		if router.MatchPathPattern(l.rules[i].A, api.Path) {
+			return l.rules[i].B
+		}
+	}
+	return nil
+}
+
+func clientHost(rp router.RoutableProtocol) string {
+	addr := router.RemoteAddr(rp)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func sessionUid(rp router.RoutableProtocol) (uint64, bool) {
+	if us, ok := rp.Session().(interface{ Uid() (uint64, error) }); ok {
+		if uid, err := us.Uid(); err == nil {
+			return uid, true
+		}
+	}
+	return 0, false
+}
+
+func (l *Limiter[Rp]) key(ctx *router.Context[Rp], rule *Rule) string {
+	name := rule.Name
+	if name == "" {
+		name = fmt.Sprintf("%d:%d/%s", rule.Algorithm, rule.Limit, rule.Window)
+	}
+	parts := []string{name}
+	if rule.By&KeyApi > 0 {
+		parts = append(parts, "api="+ctx.Api.Path)
+	}
+	if rule.By&KeySid > 0 {
+		// the sids could be long tokens, hash them to keep the keys short
+		hash := sha256.Sum256([]byte(ctx.Rp.Sid()))
+		parts = append(parts, "sid="+hex.EncodeToString(hash[:16]))
+	}
+	if rule.By&KeyUid > 0 {
+		if uid, ok := sessionUid(ctx.Rp); ok {
+			parts = append(parts, "uid="+strconv.FormatUint(uid, 10))
+		} else if rule.By&KeyAddr == 0 {
+			parts = append(parts, "addr="+clientHost(ctx.Rp))
+		}
+	}
+	if rule.By&KeyAddr > 0 {
+		parts = append(parts, "addr="+clientHost(ctx.Rp))
+	}
+	return strings.Join(parts, "|")
+}
+
+// Check takes a request from the limits of all the rules of the routed api, it could be used as a before hook directly.
+func (l *Limiter[Rp]) Check(ctx *router.Context[Rp]) error {
+	if ctx.Api == nil {
+		return nil
+	}
+	var tightest *Result
+	for _, rule := range l.rulesOf(&ctx.Api.Api) {
+		result, err := l.store.Take(l.key(ctx, rule), rule)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Rate limit store failed, the request is allowed: %s", err.Error()))
+			continue
+		} else if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			setHeaders(ctx.Rp, &result, retryAfter)
+			return util.Openly(CodeTooManyRequests, "Too many requests, retry after %ds", retryAfter)
+		} else if tightest == nil || result.Remaining < tightest.Remaining {
+			tightest = &result
+		}
+	}
+	if tightest != nil {
+		setHeaders(ctx.Rp, tightest, 0)
+	}
+	return nil
+}
+
+// setHeaders writes the limit headers if the protocol supports, such as HTTP.
+func setHeaders(rp router.RoutableProtocol, result *Result, retryAfter int) {
+	hs, ok := rp.(interface {
+		SetHeader(key string, value string)
+	})
+	if !ok {
+		return
+	}
+	hs.SetHeader(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	hs.SetHeader(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	if retryAfter > 0 {
+		hs.SetHeader(HeaderRetryAfter, strconv.Itoa(retryAfter))
+	}
+}
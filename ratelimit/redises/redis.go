@@ -0,0 +1,111 @@
+package redises
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.drunkce.com/dce/ratelimit"
+)
+
+const DefaultKeyPrefix = "dcerl"
+
+// tokenBucketScript refills and takes a token atomically.
+// KEYS: bucket key
+// ARGV: limit, window milliseconds, now milliseconds
+// Returns: allowed (0/1), remaining, retry after milliseconds
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 't', 's')
+local tokens = tonumber(state[1]) or limit
+local stamp = tonumber(state[2]) or now
+local rate = limit / window
+if now > stamp then
+	tokens = math.min(limit, tokens + (now - stamp) * rate)
+	stamp = now
+end
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 's', tostring(stamp))
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {allowed, math.floor(tokens), wait}
+`)
+
+// slidingWindowScript counts the request in the current fixed window if allowed by the weighted previous window.
+// KEYS: current window key, previous window key
+// ARGV: limit, window milliseconds, elapsed milliseconds in current window
+// Returns: allowed (0/1), remaining, retry after milliseconds
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+local count = previous * (window - elapsed) / window + current
+if count + 1 <= limit then
+	redis.call('INCR', KEYS[1])
+	redis.call('PEXPIRE', KEYS[1], window * 2)
+	return {1, math.floor(limit - count - 1), 0}
+end
+local wait = window - elapsed
+if previous > 0 then
+	local decay = math.floor((count + 1 - limit) * window / previous)
+	if decay < wait then
+		wait = decay + 1
+	end
+end
+return {0, 0, wait}
+`)
+
+// Store shares the limit states across the nodes via Redis, the limits are calculated atomically by the scripts. The
+// keys of a limit are hash tagged, so it works on Redis Cluster too. The sliding windows are split by the node clocks,
+// so the clocks should be synchronized.
+type Store struct {
+	redis  redis.UniversalClient
+	ctx    context.Context
+	prefix string
+}
+
+func NewStore(rdb redis.UniversalClient) *Store {
+	return &Store{redis: rdb, ctx: context.Background(), prefix: DefaultKeyPrefix}
+}
+
+// SetKeyPrefix specifies the prefix of the keys.
+func (s *Store) SetKeyPrefix(prefix string) *Store {
+	s.prefix = prefix
+	return s
+}
+
+func (s *Store) Take(key string, rule *ratelimit.Rule) (ratelimit.Result, error) {
+	window := max(rule.Window.Milliseconds(), 1)
+	now := time.Now().UnixMilli()
+	base := s.prefix + ":{" + key + "}"
+	var res []int64
+	var err error
+	if rule.Algorithm == ratelimit.SlidingWindow {
+		index := now / window
+		res, err = slidingWindowScript.Run(s.ctx, s.redis, []string{
+			base + ":" + strconv.FormatInt(index, 10),
+			base + ":" + strconv.FormatInt(index-1, 10),
+		}, rule.Limit, window, now-index*window).Int64Slice()
+	} else {
+		res, err = tokenBucketScript.Run(s.ctx, s.redis, []string{base}, rule.Limit, window, now).Int64Slice()
+	}
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	return ratelimit.Result{
+		Allowed:    res[0] == 1,
+		Limit:      rule.Limit,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,35 @@
+package redises_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.drunkce.com/dce/ratelimit"
+	"go.drunkce.com/dce/ratelimit/redises"
+)
+
+func TestStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := redises.NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	for _, rule := range []*ratelimit.Rule{
+		{Limit: 3, Window: time.Minute},
+		{Algorithm: ratelimit.SlidingWindow, Limit: 3, Window: time.Hour},
+	} {
+		allowed := 0
+		var last ratelimit.Result
+		for range 4 {
+			result, err := store.Take("key", rule)
+			if err != nil {
+				t.Fatal(err)
+			} else if result.Allowed {
+				allowed++
+			}
+			last = result
+		}
+		if allowed != 3 || last.RetryAfter <= 0 {
+			t.Fatalf("algorithm %d: expected 3 allowed with a retry hint, got %d, %v", rule.Algorithm, allowed, last.RetryAfter)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package router
+
+import (
+	"errors"
+	"slices"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+const (
+	CodeUnauthorized = 401
+	CodeForbidden    = 403
+)
+
+const (
+	extraAuthenticatedKey = "$#AUTHENTICATED#"
+	extraRolesKey         = "$#ROLES#"
+	extraPermissionsKey   = "$#PERMISSIONS#"
+	extraScopesKey        = "$#SCOPES#"
+	extraPoliciesKey      = "$#POLICIES#"
+)
+
+// RoleGetter could be implemented by the user types to be authorized by roles.
+type RoleGetter interface {
+	Roles() []string
+}
+
+// PermissionGetter could be implemented by the user types to carry the permissions directly, they will be merged with
+// the permissions granted to the roles.
+type PermissionGetter interface {
+	Permissions() []string
+}
+
+// ScopeGetter could be implemented by the user types to be authorized by scopes, such as the scopes of a token.
+type ScopeGetter interface {
+	Scopes() []string
+}
+
+// RequireAuthenticated marks the api could only be accessed by the logged in users, the other requirements imply it.
+func (a Api) RequireAuthenticated() Api {
+	return a.With(extraAuthenticatedKey, true)
+}
+
+// RequireRoles requires the user to have any of the roles, including the inherited roles.
+func (a Api) RequireRoles(roles ...string) Api {
+	return a.Append(extraRolesKey, toAnys(roles)...)
+}
+
+// RequirePermissions requires the user to have all the permissions.
+func (a Api) RequirePermissions(permissions ...string) Api {
+	return a.Append(extraPermissionsKey, toAnys(permissions)...)
+}
+
+// RequireScopes requires the user to have all the scopes.
+func (a Api) RequireScopes(scopes ...string) Api {
+	return a.Append(extraScopesKey, toAnys(scopes)...)
+}
+
+// RequirePolicies requires all the named policies registered by `Authorizer.SetPolicy` to pass.
+func (a Api) RequirePolicies(policies ...string) Api {
+	return a.Append(extraPoliciesKey, toAnys(policies)...)
+}
+
+func toAnys(items []string) []any {
+	return util.MapSeqFrom[string, any](items).Map(func(v string) any {
+		return v
+	}).Collect()
+}
+
+func (a Api) extraStrings(key string) []string {
+	return util.MapSeqFrom[any, string](a.ExtrasBy(key)).Map(func(v any) string {
+		return v.(string)
+	}).Collect()
+}
+
+// Policy checks the resource level access, such as whether the user owns the resource identified by the path params.
+// Returning nil means allowed, or the error will interrupt the request, a 403 error if it is not an `util.Error`.
+type Policy[Rp RoutableProtocol, U session.UidGetter] func(ctx *Context[Rp], user U) error
+
+// Authorizer checks the requirements declared on the apis against the session user, it could be set as a before hook
+// after the session bound, for all the routable protocols:
+//
+//	authorizer := router.NewAuthorizer[*proto.HttpProtocol, *Member]().
+//		Inherit("admin", "editor").
+//		Grant("editor", "article:write").
+//		SetPolicy("owner", func(ctx *proto.Http, member *Member) error {
+//			if ctx.Param("uid") != strconv.FormatUint(member.Uid(), 10) {
+//				return util.Openly(router.CodeForbidden, "Not your profile")
+//			}
+//			return nil
+//		})
+//	proto.HttpRouter.PushApi(router.Path("user/{uid}").RequirePolicies("owner"), controller)
+//	proto.HttpRouter.SetBefore("*", router.Chain(sessions.Before, authorizer.Check))
+//
+// The unauthenticated requests get the 401 error, and the unauthorized get the 403 error.
+type Authorizer[Rp RoutableProtocol, U session.UidGetter] struct {
+	inherits    map[string][]string
+	permissions map[string][]string
+	policies    map[string]Policy[Rp, U]
+}
+
+func NewAuthorizer[Rp RoutableProtocol, U session.UidGetter]() *Authorizer[Rp, U] {
+	return &Authorizer[Rp, U]{
+		inherits:    make(map[string][]string),
+		permissions: make(map[string][]string),
+		policies:    make(map[string]Policy[Rp, U]),
+	}
+}
+
+// Inherit makes the role have all the roles and permissions of the inherited roles, such as the "admin" inherits the
+// "editor", then the apis require the "editor" could also be accessed by the "admin".
+func (a *Authorizer[Rp, U]) Inherit(role string, inherited ...string) *Authorizer[Rp, U] {
+	a.inherits[role] = append(a.inherits[role], inherited...)
+	return a
+}
+
+// Grant grants the permissions to the role.
+func (a *Authorizer[Rp, U]) Grant(role string, permissions ...string) *Authorizer[Rp, U] {
+	a.permissions[role] = append(a.permissions[role], permissions...)
+	return a
+}
+
+// SetPolicy registers a named policy, which could be required by `Api.RequirePolicies`.
+func (a *Authorizer[Rp, U]) SetPolicy(name string, policy Policy[Rp, U]) *Authorizer[Rp, U] {
+	a.policies[name] = policy
+	return a
+}
+
+// ExpandRoles returns the roles with all the inherited roles.
+func (a *Authorizer[Rp, U]) ExpandRoles(roles []string) []string {
+	expanded := slices.Clone(roles)
+	for i := 0; i < len(expanded); i++ {
+		for _, inherited := range a.inherits[expanded[i]] {
+			if !slices.Contains(expanded, inherited) {
+				expanded = append(expanded, inherited)
+			}
+		}
+	}
+	return expanded
+}
+
+// Permissions returns the permissions of the user, including the ones granted to the roles.
+func (a *Authorizer[Rp, U]) Permissions(user U) []string {
+	var permissions []string
+	if pg, ok := any(user).(PermissionGetter); ok {
+		permissions = append(permissions, pg.Permissions()...)
+	}
+	if rg, ok := any(user).(RoleGetter); ok {
+		for _, role := range a.ExpandRoles(rg.Roles()) {
+			permissions = append(permissions, a.permissions[role]...)
+		}
+	}
+	return permissions
+}
+
+// Check verifies the requirements of the routed api, it could be used as a before hook directly.
+func (a *Authorizer[Rp, U]) Check(ctx *Context[Rp]) error {
+	if ctx.Api == nil {
+		return nil
+	}
+	api := &ctx.Api.Api
+	roles := api.extraStrings(extraRolesKey)
+	permissions := api.extraStrings(extraPermissionsKey)
+	scopes := api.extraStrings(extraScopesKey)
+	policies := api.extraStrings(extraPoliciesKey)
+	if api.ExtraBy(extraAuthenticatedKey) == nil && len(roles)+len(permissions)+len(scopes)+len(policies) == 0 {
+		return nil
+	}
+	us, ok := ctx.Rp.Session().(interface{ User() (U, bool) })
+	if !ok {
+		return util.Openly(CodeUnauthorized, "Unauthorized")
+	}
+	user, ok := us.User()
+	if !ok {
+		return util.Openly(CodeUnauthorized, "Unauthorized")
+	}
+	if len(roles) > 0 {
+		rg, ok := any(user).(RoleGetter)
+		if !ok || !slices.ContainsFunc(a.ExpandRoles(rg.Roles()), func(role string) bool {
+			return slices.Contains(roles, role)
+		}) {
+			return util.Openly(CodeForbidden, "Forbidden")
+		}
+	}
+	if len(permissions) > 0 {
+		granted := a.Permissions(user)
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				return util.Openly(CodeForbidden, `Forbidden, permission "%s" required`, permission)
+			}
+		}
+	}
+	if len(scopes) > 0 {
+		sg, ok := any(user).(ScopeGetter)
+		for _, scope := range scopes {
+			if !ok || !slices.Contains(sg.Scopes(), scope) {
+				return util.Openly(CodeForbidden, `Forbidden, scope "%s" required`, scope)
+			}
+		}
+	}
+	for _, name := range policies {
+		policy, ok := a.policies[name]
+		if !ok {
+			return util.Closed0(`Policy "%s" was not registered`, name)
+		} else if err := policy(ctx, user); err != nil {
+			var e util.Error
+			if !errors.As(err, &e) {
+				return util.Openly(CodeForbidden, "%s", err.Error())
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package router_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+type aclUser struct {
+	Id    uint64
+	Role  string
+	Scope []string
+}
+
+func (u *aclUser) Uid() uint64 {
+	return u.Id
+}
+
+func (u *aclUser) Roles() []string {
+	return []string{u.Role}
+}
+
+func (u *aclUser) Scopes() []string {
+	return u.Scope
+}
+
+func TestAuthorizer(t *testing.T) {
+	r := router.NewRouter[*testProtocol]()
+	noop := func(c *router.Context[*testProtocol]) {}
+	r.PushApi(router.Path("public"), noop).
+		PushApi(router.Path("private").RequireAuthenticated(), noop).
+		PushApi(router.Path("article").RequireRoles("editor"), noop).
+		PushApi(router.Path("article/publish").RequirePermissions("article:publish"), noop).
+		PushApi(router.Path("token").RequireScopes("read"), noop).
+		PushApi(router.Path("user/{uid}").RequirePolicies("owner"), noop)
+	authorizer := router.NewAuthorizer[*testProtocol, *aclUser]().
+		Inherit("admin", "editor").
+		Grant("admin", "article:publish").
+		SetPolicy("owner", func(ctx *router.Context[*testProtocol], user *aclUser) error {
+			if ctx.Param("uid") != strconv.FormatUint(user.Uid(), 10) {
+				return errors.New("not the owner")
+			}
+			return nil
+		})
+	r.SetBefore("*", authorizer.Check)
+	request := func(path string, user *aclUser) int {
+		rp := &testProtocol{Meta: router.NewMeta(path, nil, true)}
+		sess, _ := session.NewShmSession[*aclUser](nil, session.DefaultTtlMinutes)
+		if user != nil {
+			_ = sess.Login(user, session.DefaultTtlMinutes)
+		}
+		rp.SetSession(sess)
+		r.Route(router.NewContext(rp))
+		if rp.Error() == nil {
+			return 0
+		}
+		var e util.Error
+		errors.As(rp.Error(), &e)
+		return e.Code
+	}
+
+	editor := &aclUser{Id: 1, Role: "editor"}
+	admin := &aclUser{Id: 2, Role: "admin", Scope: []string{"read"}}
+	cases := []struct {
+		path string
+		user *aclUser
+		code int
+	}{
+		{"public", nil, 0},
+		{"private", nil, router.CodeUnauthorized},
+		{"private", editor, 0},
+		{"article", editor, 0},
+		{"article", admin, 0},
+		{"article/publish", editor, router.CodeForbidden},
+		{"article/publish", admin, 0},
+		{"token", editor, router.CodeForbidden},
+		{"token", admin, 0},
+		{"user/1", editor, 0},
+		{"user/1", admin, router.CodeForbidden},
+	}
+	for _, c := range cases {
+		if code := request(c.path, c.user); code != c.code {
+			t.Errorf("%s: expected code %d, got %d", c.path, c.code, code)
+		}
+	}
+}
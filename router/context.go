@@ -1,6 +1,7 @@
 package router
 
 import (
+	"maps"
 	"strings"
 	"time"
 
@@ -63,6 +64,11 @@ func (c *Context[Rp]) Params(key string) []string {
 	return []string{}
 }
 
+// PathParams returns a copy of the located path params.
+func (c *Context[Rp]) PathParams() map[string]Param {
+	return maps.Clone(c.params)
+}
+
 func (c *Context[Rp]) Body() ([]byte, error) {
 	return c.Rp.Body()
 }
@@ -3,6 +3,9 @@ package router
 import (
 	"bytes"
 	"context"
+	"net"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,7 +16,12 @@ import (
 const (
 	ContextKeyRespSid  = "Resp-Session-Id"
 	HttpContentTypeKey = "Content-Type"
-	sessionKey         = "$#session#"
+	// ContextKeyCsrfToken is the context data key of the csrf token getter `func() string`, the token will be generated
+	// and stored into the session on the first call.
+	ContextKeyCsrfToken = "Csrf-Token"
+	// CsrfFormField is the form field name to submit the csrf token.
+	CsrfFormField = "csrf_token"
+	sessionKey    = "$#session#"
 )
 
 // Meta is a generic struct that encapsulates metadata and state associated with a request.
@@ -56,6 +64,20 @@ func (m *Meta[Req]) ClearBuffer() []byte {
 	return bs
 }
 
+// Buffered returns a copy of the buffered response data without clearing it.
+func (m *Meta[Req]) Buffered() []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return bytes.Clone(m.respBuffer.Bytes())
+}
+
+// BufferedLen returns the length of the buffered response data.
+func (m *Meta[Req]) BufferedLen() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.respBuffer.Len()
+}
+
 func (m *Meta[Req]) ResponseEmpty() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -145,6 +167,103 @@ func (m *Meta[Req]) RespSid() string {
 	return ""
 }
 
+// RemoteAddr returns the client address of the request, it supports the request which is an *http.Request, a connection
+// with the `RemoteAddr()` method or a net.Addr, or else returns an empty string.
+func (m *Meta[Req]) RemoteAddr() string {
+	switch req := any(m.Req).(type) {
+	case *http.Request:
+		return req.RemoteAddr
+	case interface{ RemoteAddr() net.Addr }:
+		return req.RemoteAddr().String()
+	case net.Addr:
+		return req.String()
+	}
+	return ""
+}
+
+// RemoteAddr returns the client address of the protocol if it implements the `RemoteAddr() string`, such as the
+// protocols embedded the Meta.
+func RemoteAddr(rp RoutableProtocol) string {
+	if ag, ok := rp.(interface{ RemoteAddr() string }); ok {
+		return ag.RemoteAddr()
+	}
+	return ""
+}
+
+// RequestHeader returns the request header value of the protocol if it implements the `RequestHeader(key string)
+// string`, such as the HTTP protocol and the flex, json and pb package protocols, or else returns an empty string.
+func RequestHeader(rp RoutableProtocol, key string) string {
+	if hg, ok := rp.(interface{ RequestHeader(key string) string }); ok {
+		return hg.RequestHeader(key)
+	}
+	return ""
+}
+
+// HeaderValue looks up the header value in a package headers map, the key is case-insensitive as the HTTP headers.
+func HeaderValue(headers map[string]string, key string) string {
+	if val, ok := headers[key]; ok {
+		return val
+	}
+	for k, val := range headers {
+		if strings.EqualFold(k, key) {
+			return val
+		}
+	}
+	return ""
+}
+
+// WithValue derives the request context with the key value pair, so that the value could be got via `Value`.
+func (m *Meta[Req]) WithValue(key any, val any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.context == nil {
+		m.context = context.Background()
+	}
+	m.context = context.WithValue(m.context, key, val)
+}
+
+// WithValue derives the request context of the protocol if it implements the `WithValue(key any, val any)`, such as
+// the protocols embedded the Meta, it returns false if not supported.
+func WithValue(rp RoutableProtocol, key any, val any) bool {
+	if wv, ok := rp.(interface{ WithValue(key any, val any) }); ok {
+		wv.WithValue(key, val)
+		return true
+	}
+	return false
+}
+
+// RespondedNotifier notifies the registered functions of the bytes written to the client after the response sent. It
+// should be embedded in the protocols whose routers call `Responded` exactly once after writing, even if nothing was
+// written, such as the HTTP protocol and the flex, json and pb package protocols.
+type RespondedNotifier struct {
+	respondedFns []func(n int)
+}
+
+// OnResponded registers the function to be called with the count of the bytes written to the client.
+func (r *RespondedNotifier) OnResponded(fn func(n int)) {
+	r.respondedFns = append(r.respondedFns, fn)
+}
+
+// Responded calls the registered functions with the count of the bytes written to the client, it should be called by
+// the protocol router after the response sent.
+func (r *RespondedNotifier) Responded(n int) {
+	fns := r.respondedFns
+	r.respondedFns = nil
+	for _, fn := range fns {
+		fn(n)
+	}
+}
+
+// OnResponded registers the function to the protocol if it implements the `OnResponded(fn func(n int))`, such as the
+// protocols embedded the RespondedNotifier, it returns false if not supported.
+func OnResponded(rp RoutableProtocol, fn func(n int)) bool {
+	if or, ok := rp.(interface{ OnResponded(fn func(n int)) }); ok {
+		or.OnResponded(fn)
+		return true
+	}
+	return false
+}
+
 func (m *Meta[Req]) Deadline() (deadline time.Time, ok bool) {
 	return m.context.Deadline()
 }
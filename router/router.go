@@ -1,6 +1,7 @@
 package router
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -15,6 +16,10 @@ import (
 
 const CodeNotFound = 404
 
+// ErrHandled could be returned by a before hook to skip the controller when the hook has already responded, such as
+// replaying a stored response, the after hook will still be called, and it will not be set as the request error.
+var ErrHandled = errors.New("request handled by the before hook")
+
 // Router is a generic struct that provides routing functionality for a given RoutableProtocol type.
 // It manages API routes, handles path matching, and supports various routing features such as
 // path variables, suffixes, and event handling. The Router is designed to be flexible and
@@ -39,9 +44,16 @@ type Router[Rp RoutableProtocol] struct {
 	afterMapping 	  map[string] func(ctx *Context[Rp]) error
 	pathBeforeMapping map[string]string
 	pathAfterMapping  map[string]string
+	interceptors      []Interceptor[Rp]
+	extras            sync.Map
 	mu                sync.Mutex
 }
 
+// Interceptor wraps the whole handling of a request, including the locating, the hooks and the controller, it is
+// called before locating, so the `ctx.Api` is nil, the returned function is called after the handling, in which the
+// located api and the request error could be got, it is suitable for the observations such as metrics and logging.
+type Interceptor[Rp RoutableProtocol] func(ctx *Context[Rp]) (done func())
+
 func NewRouter[Rp RoutableProtocol]() *Router[Rp] {
 	return &Router[Rp]{
 		pathPartSeparator: MarkPathPartSeparator,
@@ -56,6 +68,22 @@ func NewRouter[Rp RoutableProtocol]() *Router[Rp] {
 	}
 }
 
+// SetExtra sets the router level config by the key, such as the sid cookie and the cors rules of the http router, a nil
+// value removes the config. It is safe to be called while routing.
+func (r *Router[Rp]) SetExtra(key string, val any) *Router[Rp] {
+	if val == nil {
+		r.extras.Delete(key)
+	} else {
+		r.extras.Store(key, val)
+	}
+	return r
+}
+
+func (r *Router[Rp]) ExtraBy(key string) any {
+	val, _ := r.extras.Load(key)
+	return val
+}
+
 func (r *Router[Rp]) SetSeparator(pps string, sb string) *Router[Rp] {
 	r.pathPartSeparator = pps
 	r.suffixBoundary = sb
@@ -73,7 +101,7 @@ func (r *Router[Rp]) SetSeparator(pps string, sb string) *Router[Rp] {
 //   SetBefore("member+", func(ctx *Context[Rp]) error {}) // Intercept sub-APIs of "/member"
 //   SetBefore("member/{mid}+", func(ctx *Context[Rp]) error {}) // Intercept sub-APIs of "/member/{mid}"
 //
-// Returning an error can interrupt and clear the processing flow.
+// Returning an error can interrupt and clear the processing flow, except the `ErrHandled` which only skips the controller.
 func (r *Router[Rp]) SetBefore(path string, handler func(ctx *Context[Rp]) error) *Router[Rp] {
 	hookOverrideWarn(path, r.beforeMapping, true)
 	r.beforeMapping[path] = handler
@@ -86,7 +114,7 @@ func (r *Router[Rp]) SetBeforePaths(paths []string, handler func(ctx *Context[Rp
 }
 
 func (r *Router[Rp]) SetAfter(path string, handler func(ctx *Context[Rp]) error) *Router[Rp] {
-	hookOverrideWarn(path, r.beforeMapping, false)
+	hookOverrideWarn(path, r.afterMapping, false)
 	r.afterMapping[path] = handler
 	return r
 }
@@ -96,6 +124,45 @@ func (r *Router[Rp]) SetAfterPaths(paths []string, handler func(ctx *Context[Rp]
 	return r
 }
 
+// Intercept appends an interceptor, the interceptors are called in order, and their done functions are called in the
+// reverse order. It should be called before serving.
+func (r *Router[Rp]) Intercept(interceptor Interceptor[Rp]) *Router[Rp] {
+	r.interceptors = append(r.interceptors, interceptor)
+	return r
+}
+
+func (r *Router[Rp]) intercept(ctx *Context[Rp]) func() {
+	if len(r.interceptors) == 0 {
+		return func() {}
+	}
+	dones := make([]func(), len(r.interceptors))
+	for i, interceptor := range r.interceptors {
+		dones[i] = interceptor(ctx)
+	}
+	return func() {
+		for i := len(dones) - 1; i >= 0; i-- {
+			if dones[i] != nil {
+				dones[i]()
+			}
+		}
+	}
+}
+
+// Chain composes the hooks into one, they will be called in order until any of them returned an error, since only one
+// hook could be set on a path pattern.
+//
+//   SetBefore("*", Chain(sessions.Before, authorizer.Check))
+func Chain[Rp RoutableProtocol](hooks ...func(ctx *Context[Rp]) error) func(ctx *Context[Rp]) error {
+	return func(ctx *Context[Rp]) error {
+		for _, hook := range hooks {
+			if err := hook(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 func hookOverrideWarn[T any](path string, mapping map[string]T, pre bool) {
 	if _, ok := mapping[path]; !ok {
 		return
@@ -352,6 +419,33 @@ func (r *Router[Rp]) locate(path string, apiFinder func([]*RpApi[Rp]) (*RpApi[Rp
 	return api, pathParams, suffix, nil
 }
 
+// PathApis returns all the apis bound to the path regardless of whether they match the request, it could be used to
+// distinguish between a mismatched path and a mismatched api (such as the http method).
+func (r *Router[Rp]) PathApis(path string) []*Api {
+	var pathApis []*Api
+	_, _, _, _ = r.locate(path, func(apis []*RpApi[Rp]) (*RpApi[Rp], bool) {
+		pathApis = util.MapSeqFrom[*RpApi[Rp], *Api](apis).Map(func(a *RpApi[Rp]) *Api {
+			return &a.Api
+		}).Collect()
+		return nil, false
+	})
+	return pathApis
+}
+
+// MatchPathPattern reports whether the api path matches the pattern, the pattern syntax is the same as that in the
+// SetBefore method, a trailing + matches the child apis excluding the current one, while a trailing * includes the
+// current api as well, and a single * matches all apis.
+func MatchPathPattern(pattern string, apiPath string) bool {
+	if len(pattern) == 0 || !slices.Contains(middlewarePathSuffixes, pattern[len(pattern)-1:]) {
+		return pattern == apiPath
+	}
+	suffix, path := pattern[len(pattern)-1:], pattern[:len(pattern)-1]
+	if path == "" {
+		return suffix == middlewarePathSuffixes[1] || apiPath != ""
+	}
+	return (suffix != middlewarePathSuffixes[0] && path == apiPath) || strings.HasPrefix(apiPath, path+MarkPathPartSeparator)
+}
+
 func (r *Router[Rp]) matchVarPath(path string) (string, map[string]Param, *Suffix, bool) {
 	pathParts := strings.Split(path, r.pathPartSeparator)
 	loopItems := []*util.Tuple2[*util.Tree[ApiBranch[Rp], string], int]{util.NewTuple2(&r.apisTree, 0)}
@@ -476,6 +570,7 @@ func (r *Router[Rp]) findConsiderSuffix(
 // This method is thread-safe and ensures that the routing logic is executed in a consistent manner, even
 // when multiple requests are processed concurrently.
 func (r *Router[Rp]) Route(context *Context[Rp]) {
+	defer r.intercept(context)()
 	api, pathParams, suffix, err := r.locate(context.Rp.Path(), func(apis []*RpApi[Rp]) (*RpApi[Rp], bool) {
 		if index := r.apiMatcher(context.Rp, util.MapSeqFrom[*RpApi[Rp], *Api](apis).Map(func(a *RpApi[Rp]) *Api {
 			return &a.Api
@@ -494,14 +589,19 @@ func (r *Router[Rp]) Route(context *Context[Rp]) {
 
 func (r *Router[Rp]) routedHandle(api *RpApi[Rp], pathParams map[string]Param, suffix *Suffix, context *Context[Rp]) error {
 	context.SetRoutes(r, api, pathParams, suffix)
+	handled := false
 	if bk, ok := r.pathBeforeMapping[api.Path]; ok {
 		if before, ok := r.beforeMapping[bk]; ok {
-			if err := before(context); err != nil {
+			if err := before(context); errors.Is(err, ErrHandled) {
+				handled = true
+			} else if err != nil {
 				return err
 			}
 		}
 	}
-	api.Controller(context)
+	if !handled {
+		api.Controller(context)
+	}
 	var err error = nil
 	if ak, ok := r.pathAfterMapping[api.Path]; ok {
 		if after, ok := r.afterMapping[ak]; ok {
@@ -520,6 +620,7 @@ func (r *Router[Rp]) idLocate(id string) (*RpApi[Rp], error) {
 }
 
 func (r *Router[Rp]) IdRoute(context *Context[Rp]) {
+	defer r.intercept(context)()
 	api, err := r.idLocate(context.Rp.Path())
 	if err == nil {
 		err = r.routedHandle(api, map[string]Param{}, nil, context)
@@ -0,0 +1,27 @@
+package router_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.drunkce.com/dce/router"
+)
+
+func TestHookOverrideWarn(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	hook := func(ctx *router.Context[*testProtocol]) error { return nil }
+	r := router.NewRouter[*testProtocol]()
+	r.SetBefore("home", hook).SetAfter("home", hook)
+	if logs.Len() > 0 {
+		t.Fatalf("the after hook should not be checked against the before hooks, got %q", logs.String())
+	}
+	r.SetAfter("home", hook)
+	if !strings.Contains(logs.String(), "postprocesser") {
+		t.Fatalf("the after hook override should be warned, got %q", logs.String())
+	}
+}
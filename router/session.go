@@ -0,0 +1,133 @@
+package router
+
+import (
+	"context"
+
+	"go.drunkce.com/dce/session"
+)
+
+// ShadowSessionKey is the context data key of the connection level shadow session, the connection-oriented protocols
+// (flex, json and pb over websocket, tcp or quic) should pass the shadow session via the context data, so that the
+// middleware could clone the request sessions from it.
+const ShadowSessionKey = "$shadowSession"
+
+// SessionFactory creates a session with the sid pool and ttl minutes, the same as the store constructors, such as:
+//
+//	func(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[*Member], error) {
+//		return redises.NewSession[*Member](rdb, sidPool, ttlMinutes)
+//	}
+type SessionFactory[U session.UidGetter] func(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[U], error)
+
+// SessionMiddleware binds the sessions to the requests, it works for all the protocols:
+//   - Before the controller, it loads the session by `Rp.Sid()`, or clones a request session from the shadow session
+//     for the connection-oriented protocols, binds it to the request via `BindContext`, applies the auto renew if
+//     configured, and sets it to `Rp.SetSession()`.
+//   - After the controller, it persists the session, sets the response sid if the sid was generated or changed, such
+//     as logged in or renewed, and destroys the newborn session if the request failed.
+//
+// The invalid sid will be replaced with a newborn session instead of failing the request.
+type SessionMiddleware[Rp RoutableProtocol, U session.UidGetter] struct {
+	factory    SessionFactory[U]
+	ttlMinutes uint16
+	autoRenew  bool
+	renew      [3]uint16
+}
+
+func NewSessionMiddleware[Rp RoutableProtocol, U session.UidGetter](factory SessionFactory[U]) *SessionMiddleware[Rp, U] {
+	return &SessionMiddleware[Rp, U]{factory: factory, ttlMinutes: session.DefaultTtlMinutes}
+}
+
+// TtlMinutes specifies the ttl of the newborn sessions.
+func (m *SessionMiddleware[Rp, U]) TtlMinutes(ttlMinutes uint16) *SessionMiddleware[Rp, U] {
+	m.ttlMinutes = ttlMinutes
+	return m
+}
+
+// AutoRenew enables the auto renew, the arguments are the same as `session.AutoRenew.Config()`, 0 means the default.
+func (m *SessionMiddleware[Rp, U]) AutoRenew(renewIntervalSeconds uint16, originalJudgmentSeconds uint16, clonedInactiveJudgmentSeconds uint16) *SessionMiddleware[Rp, U] {
+	m.autoRenew = true
+	m.renew = [3]uint16{renewIntervalSeconds, originalJudgmentSeconds, clonedInactiveJudgmentSeconds}
+	return m
+}
+
+// Bind sets the before and after hooks to the router on the path pattern, the hooks already set on the pattern will be
+// composed via Chain instead of overwritten: the existing before hook runs after the session loaded, and the existing
+// after hook runs after the session persisted and the response sid set. The hooks set on the pattern after binding
+// will overwrite the session hooks, they could be composed with Before and After manually.
+//
+//	r.SetBefore("*", authorizer.Check)
+//	sessions.Bind(r, "*") // the authorizer could check the roles of the session user
+func (m *SessionMiddleware[Rp, U]) Bind(router *Router[Rp], path string) *Router[Rp] {
+	before, after := m.Before, m.After
+	if existing, ok := router.beforeMapping[path]; ok {
+		delete(router.beforeMapping, path)
+		before = Chain(m.Before, existing)
+	}
+	if existing, ok := router.afterMapping[path]; ok {
+		delete(router.afterMapping, path)
+		after = Chain(m.After, existing)
+	}
+	return router.SetBefore(path, before).SetAfter(path, after)
+}
+
+func (m *SessionMiddleware[Rp, U]) open(ctx *Context[Rp]) (session.IfRequestSession[U], error) {
+	sid := ctx.Rp.Sid()
+	if shadow, ok := ctx.Rp.CtxData(ShadowSessionKey); ok {
+		if rs, ok := shadow.(session.IfRequestSession[U]); ok {
+			cl, err := rs.CloneForRequest(sid)
+			if err != nil {
+				return nil, err
+			}
+			return cl.(session.IfRequestSession[U]), nil
+		}
+	}
+	if sid != "" {
+		if sess, err := m.factory([]string{sid}, m.ttlMinutes); err == nil {
+			return sess, nil
+		}
+	}
+	return m.factory(nil, m.ttlMinutes)
+}
+
+// Before loads the session and binds it to the request.
+func (m *SessionMiddleware[Rp, U]) Before(ctx *Context[Rp]) error {
+	sess, err := m.open(ctx)
+	if err != nil {
+		return err
+	}
+	// bind the request, so that the store operations could be attributed to it, such as the tracing spans
+	if bc, ok := sess.(interface{ BindContext(ctx context.Context) }); ok {
+		bc.BindContext(ctx.Rp)
+	}
+	if m.autoRenew {
+		if _, err = session.NewAutoRenew(sess).Config(m.renew[0], m.renew[1], m.renew[2]).TryRenew(); err != nil {
+			return err
+		}
+	} else if !sess.Newborn() {
+		_ = sess.TryTouch()
+	}
+	ctx.Rp.SetSession(sess)
+	return nil
+}
+
+// After persists or destroys the session and sets the response sid.
+func (m *SessionMiddleware[Rp, U]) After(ctx *Context[Rp]) error {
+	sess, ok := ctx.Rp.Session().(session.IfRequestSession[U])
+	if !ok {
+		return nil
+	}
+	if sess.Newborn() {
+		if !sess.Touched() {
+			// nothing stored, no need to issue the sid
+			return nil
+		} else if ctx.Rp.Error() != nil {
+			return sess.Destroy()
+		}
+	} else if err := sess.TryTouch(); err != nil {
+		return err
+	}
+	if sess.Id() != ctx.Rp.Sid() && ctx.Rp.RespSid() == "" {
+		ctx.Rp.SetRespSid(sess.Id())
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package router_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+type testProtocol struct {
+	router.Meta[string]
+	sid string
+}
+
+func (p *testProtocol) Path() string {
+	return p.Req
+}
+
+func (p *testProtocol) Body() ([]byte, error) {
+	return nil, nil
+}
+
+func (p *testProtocol) Sid() string {
+	return p.sid
+}
+
+func newShmSession(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[*session.SimpleUser], error) {
+	return session.NewShmSession[*session.SimpleUser](sidPool, ttlMinutes)
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	r := router.NewRouter[*testProtocol]()
+	r.Push("anonymous", func(c *router.Context[*testProtocol]) {}).
+		Push("login", func(c *router.Context[*testProtocol]) {
+			sess := c.Rp.Session().(session.IfRequestSession[*session.SimpleUser])
+			if err := sess.Login(&session.SimpleUser{Id: 41}, 0); err != nil {
+				c.Rp.SetError(err)
+			}
+		}).
+		Push("profile", func(c *router.Context[*testProtocol]) {
+			sess := c.Rp.Session().(session.IfRequestSession[*session.SimpleUser])
+			if _, ok := sess.User(); !ok {
+				c.Rp.SetError(util.Openly(401, "Unauthorized"))
+			}
+		})
+	router.NewSessionMiddleware[*testProtocol](newShmSession).Bind(r, "*")
+	request := func(path string, sid string) *testProtocol {
+		rp := &testProtocol{Meta: router.NewMeta(path, nil, true), sid: sid}
+		r.Route(router.NewContext(rp))
+		return rp
+	}
+
+	if rp := request("anonymous", ""); rp.Error() != nil || rp.RespSid() != "" {
+		t.Fatalf("untouched newborn session should not issue a sid, got %q, %v", rp.RespSid(), rp.Error())
+	}
+	rp := request("login", "invalid sid")
+	if rp.Error() != nil || rp.RespSid() == "" {
+		t.Fatalf("login should issue a sid, got %q, %v", rp.RespSid(), rp.Error())
+	}
+	sid := rp.RespSid()
+	if rp = request("profile", sid); rp.Error() != nil || rp.RespSid() != "" {
+		t.Fatalf("logged in session should be loaded without a new sid, got %q, %v", rp.RespSid(), rp.Error())
+	}
+
+	shadow, _ := session.NewShmSession[*session.SimpleUser]([]string{sid}, 0)
+	rp = &testProtocol{Meta: router.NewMeta("profile", map[string]any{router.ShadowSessionKey: shadow}, true)}
+	r.Route(router.NewContext(rp))
+	if rp.Error() != nil || !rp.Session().(session.IfRequestSession[*session.SimpleUser]).Request() {
+		t.Fatalf("request session should be cloned from the shadow session, got %v", rp.Error())
+	}
+}
+
+func TestSessionMiddlewareBindComposes(t *testing.T) {
+	r := router.NewRouter[*testProtocol]()
+	var calls []string
+	r.Push("login", func(c *router.Context[*testProtocol]) {
+		calls = append(calls, "controller")
+		_ = c.Rp.Session().(session.IfRequestSession[*session.SimpleUser]).Login(&session.SimpleUser{Id: 42}, 0)
+	}).SetBefore("*", func(c *router.Context[*testProtocol]) error {
+		if c.Rp.Session() == nil {
+			t.Error("the session should be loaded before the existing before hook")
+		}
+		calls = append(calls, "before")
+		return nil
+	}).SetAfter("*", func(c *router.Context[*testProtocol]) error {
+		if c.Rp.RespSid() == "" {
+			t.Error("the response sid should be set before the existing after hook")
+		}
+		calls = append(calls, "after")
+		return nil
+	})
+	router.NewSessionMiddleware[*testProtocol](newShmSession).Bind(r, "*")
+	rp := &testProtocol{Meta: router.NewMeta("login", nil, true)}
+	r.Route(router.NewContext(rp))
+	if rp.Error() != nil || rp.RespSid() == "" {
+		t.Fatalf("login should issue a sid, got %q, %v", rp.RespSid(), rp.Error())
+	} else if strings.Join(calls, ",") != "before,controller,after" {
+		t.Fatalf("the existing hooks should be kept, got %v", calls)
+	}
+}
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec serializes the session field values for the stores which need serialization, such as Redis. The
+// serialization-free stores, such as ShmSession, keep the Go values, and only use the codec to convert the mismatched
+// types, so that a value could be read identically whatever the store is.
+type Codec interface {
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, target any) error
+}
+
+var (
+	JsonCodec  Codec = jsonCodec{}
+	GobCodec   Codec = gobCodec{}
+	ProtoCodec Codec = protoCodec{}
+)
+
+// TextCodec is implemented by the codecs whose output is always valid UTF-8 text, the output of the other codecs is
+// base64 encoded in the text stores.
+type TextCodec interface {
+	Codec
+	Text() bool
+}
+
+// TextStore is implemented by the sessions which keep the serialized values as text, such as a json log or a TEXT
+// column, in which the binary output would be corrupted by the UTF-8 replacement.
+type TextStore interface {
+	TextOnly() bool
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Text() bool {
+	return true
+}
+
+func (jsonCodec) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(data []byte, target any) error {
+	return json.Unmarshal(data, target)
+}
+
+// gobCodec is a binary codec, its output is base64 encoded in the text stores, the interface values should be
+// registered via `gob.Register` before encoding.
+type gobCodec struct{}
+
+func (gobCodec) Marshal(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, target any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(target)
+}
+
+// protoCodec only supports the protobuf messages, the target could be a message or a pointer to a message pointer,
+// such as the target of `GetAs[*pb.User]`, which will be allocated if nil.
+type protoCodec struct{}
+
+func (protoCodec) Marshal(value any) ([]byte, error) {
+	if msg, ok := value.(proto.Message); ok {
+		return proto.Marshal(msg)
+	}
+	return nil, fmt.Errorf("ProtoCodec: %T is not a proto.Message", value)
+}
+
+func (protoCodec) Unmarshal(data []byte, target any) error {
+	if msg, ok := target.(proto.Message); ok {
+		return proto.Unmarshal(data, msg)
+	}
+	rv := reflect.ValueOf(target)
+	if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if msg, ok := elem.Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, msg); err != nil {
+				return err
+			}
+			rv.Elem().Set(elem)
+			return nil
+		}
+	}
+	return fmt.Errorf("ProtoCodec: %T is not a proto.Message", target)
+}
+
+// base64Codec wraps a binary codec to keep its output in the text stores.
+type base64Codec struct {
+	Codec
+}
+
+func (c base64Codec) Marshal(value any) ([]byte, error) {
+	data, err := c.Codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.AppendEncode(nil, data), nil
+}
+
+func (c base64Codec) Unmarshal(data []byte, target any) error {
+	decoded, err := base64.StdEncoding.AppendDecode(nil, data)
+	if err != nil {
+		return err
+	}
+	return c.Codec.Unmarshal(decoded, target)
+}
+
+// Codec returns the codec of the session, the JsonCodec will be used if not specified, and the binary codecs will be
+// wrapped with base64 for the text stores.
+func (b *BasicSession) Codec() Codec {
+	if b.codec == nil {
+		return JsonCodec
+	} else if tc, ok := b.codec.(TextCodec); ok && tc.Text() {
+		return b.codec
+	} else if ts, ok := b.IfSession.(TextStore); ok && ts.TextOnly() {
+		return base64Codec{b.codec}
+	}
+	return b.codec
+}
+
+// SetCodec specifies the codec of the session, it should be called by the store factory before any field access,
+// the clones will inherit it.
+//
+//	sess, _ := redises.NewSession[*session.SimpleUser](rdb, []string{sid}, session.DefaultTtlMinutes)
+//	sess.SetCodec(session.GobCodec)
+func (b *BasicSession) SetCodec(codec Codec) {
+	b.codec = codec
+}
+
+func (b *BasicSession) encode(value any) (any, error) {
+	if !b.IfSession.NeedSerial() {
+		return value, nil
+	}
+	return b.Codec().Marshal(value)
+}
+
+func (b *BasicSession) decode(value any, target any) error {
+	if !b.IfSession.NeedSerial() {
+		rt := reflect.ValueOf(target).Elem()
+		if rv := reflect.ValueOf(value); rv.IsValid() && rv.Type().AssignableTo(rt.Type()) {
+			rt.Set(rv)
+			return nil
+		}
+		// the stored Go value has a different type, convert it via the codec
+		data, err := b.Codec().Marshal(value)
+		if err != nil {
+			return err
+		}
+		return b.Codec().Unmarshal(data, target)
+	}
+	switch v := value.(type) {
+	case string:
+		return b.Codec().Unmarshal([]byte(v), target)
+	case []byte:
+		return b.Codec().Unmarshal(v, target)
+	}
+	return fmt.Errorf("decode: unknown type %T", value)
+}
+
+// GetAs retrieves a field value as type T, the value is decoded with the codec of the session, so that the same code
+// works identically whatever the store is.
+//
+//	cart, err := session.GetAs[Cart](ctx.Session(), "cart")
+func GetAs[T any](s IfSession, field string) (T, error) {
+	var target T
+	err := s.Get(field, &target)
+	return target, err
+}
+
+// SetAs assigns a typed field value, the value is encoded with the codec of the session.
+func SetAs[T any](s IfSession, field string, value T) error {
+	return s.Set(field, value)
+}
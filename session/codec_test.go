@@ -0,0 +1,56 @@
+package session_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/session/files"
+)
+
+type cart struct {
+	Items []string
+	Total int
+}
+
+func TestTypedAccessAcrossStores(t *testing.T) {
+	shm, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+	path := filepath.Join(t.TempDir(), "session.log")
+	store, err := files.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, _ := files.NewSession[*session.SimpleUser](store, nil, session.DefaultTtlMinutes)
+	gobFile, _ := files.NewSession[*session.SimpleUser](store, nil, session.DefaultTtlMinutes)
+	gobFile.SetCodec(session.GobCodec)
+	sessions := map[string]session.IfSession{"shm": shm, "file": file, "gob": gobFile}
+	for name, sess := range sessions {
+		if err = session.SetAs(sess, "cart", cart{Items: []string{"a"}, Total: 3}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err = session.SetAs(sess, "count", 7); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	// the file sessions should be read from the replayed store
+	_ = store.Close()
+	if store, err = files.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, _ := files.NewSession[*session.SimpleUser](store, []string{file.Id()}, session.DefaultTtlMinutes)
+	reopenedGob, _ := files.NewSession[*session.SimpleUser](store, []string{gobFile.Id()}, session.DefaultTtlMinutes)
+	reopenedGob.SetCodec(session.GobCodec)
+	sessions["file"], sessions["gob"] = reopened, reopenedGob
+
+	for name, sess := range sessions {
+		if c, err := session.GetAs[cart](sess, "cart"); err != nil || c.Total != 3 || c.Items[0] != "a" {
+			t.Fatalf("%s: got %v %v", name, c, err)
+		}
+		// a mismatched numeric type should be converted instead of panicking
+		if n, err := session.GetAs[int64](sess, "count"); err != nil || n != 7 {
+			t.Fatalf("%s: got %d %v", name, n, err)
+		}
+	}
+}
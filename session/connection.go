@@ -84,3 +84,13 @@ func (c *ConnectionSession) handleClonedRequest(original *ConnectionSession) {
 type IfConnection interface {
 	handleClonedRequest(original *ConnectionSession)
 }
+
+// IfRequestSession is the session could be bound to the requests by the router middleware, it could be cloned from the
+// connection level shadow session for the connection-oriented protocols, all the built-in stores implement it.
+type IfRequestSession[U UidGetter] interface {
+	IfSession
+	IfUserSession[U]
+	Touched() bool
+	Request() bool
+	CloneForRequest(sid string) (any, error)
+}
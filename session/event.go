@@ -0,0 +1,134 @@
+package session
+
+import (
+	"slices"
+	"sync"
+)
+
+type EventKind uint8
+
+const (
+	// EventCreated is emitted when a newborn session was touched at the first time, which means it was persisted.
+	EventCreated EventKind = iota + 1
+	// EventLogin is emitted after a user logged in, the OldSid is the sid before login.
+	EventLogin
+	// EventLogout is emitted after a user logged out.
+	EventLogout
+	// EventRenewed is emitted after the sid was regenerated, including the renewal of login and auto renew.
+	EventRenewed
+	// EventDestroyed is emitted after a session was destroyed, such as the stale session of login and auto renew.
+	EventDestroyed
+	// EventExpired is emitted when an expired session was cleared, only the stores which clear the expired sessions
+	// actively emit it, such as ShmSession, the Redis expiry requires the keyspace notifications.
+	EventExpired
+	// EventFieldChanged is emitted after a field was set or deleted via Set or Del, the silent operations are ignored.
+	EventFieldChanged
+	// EventEvicted is emitted before a session was destroyed by the login policy or LogoutAll, the Client is the
+	// address of the connection bound to it.
+	EventEvicted
+)
+
+var eventKindNames = []string{"", "created", "login", "logout", "renewed", "destroyed", "expired", "field_changed", "evicted"}
+
+func (k EventKind) String() string {
+	if int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "unknown"
+}
+
+// Event is a session lifecycle event.
+//
+// Fields:
+//   - Kind: The event kind.
+//   - Sid: The session id, it is the new sid for the login and renewed events.
+//   - OldSid: The sid before regenerated, only for the login and renewed events.
+//   - Uid: The user id, only for the login, logout and destroyed (of a logged in session) events.
+//   - Field: The changed field, only for the field changed event.
+//   - Client: The client address of the connection bound to the session, only for the evicted event.
+//   - Session: The session emitted the event, it is nil for the expired event.
+type Event struct {
+	Kind    EventKind
+	Sid     string
+	OldSid  string
+	Uid     uint64
+	Field   string
+	Client  string
+	Session IfSession
+}
+
+// Listener receives the session events, it is called synchronously in the goroutine which emitted the event, so it
+// should return quickly, and dispatch the heavy works into other goroutines.
+type Listener func(event Event)
+
+type listenerEntry struct {
+	listener Listener
+	kinds    []EventKind
+}
+
+var listenerMu sync.RWMutex
+var listeners []*listenerEntry
+
+// Listen registers a listener for the specified event kinds, or for all kinds if not specified, the returned function
+// cancels the registration.
+//
+//	cancel := session.Listen(func(e session.Event) {
+//		// close the websocket connections bound to the dead session
+//		go closeConnsBySid(e.Sid)
+//	}, session.EventDestroyed, session.EventExpired, session.EventLogout)
+//	defer cancel()
+func Listen(listener Listener, kinds ...EventKind) (cancel func()) {
+	entry := &listenerEntry{listener: listener, kinds: kinds}
+	listenerMu.Lock()
+	listeners = append(slices.Clone(listeners), entry)
+	listenerMu.Unlock()
+	return func() {
+		listenerMu.Lock()
+		defer listenerMu.Unlock()
+		if index := slices.Index(listeners, entry); index > -1 {
+			listeners = slices.Delete(slices.Clone(listeners), index, index+1)
+		}
+	}
+}
+
+// Emit dispatches the event to the listeners, it could be used by the custom stores to emit the lifecycle events.
+func Emit(event Event) {
+	listenerMu.RLock()
+	entries := listeners
+	listenerMu.RUnlock()
+	for _, entry := range entries {
+		if len(entry.kinds) == 0 || slices.Contains(entry.kinds, event.Kind) {
+			entry.listener(event)
+		}
+	}
+}
+
+func hasListener() bool {
+	listenerMu.RLock()
+	defer listenerMu.RUnlock()
+	return len(listeners) > 0
+}
+
+func (b *BasicSession) emit(event Event) {
+	if !hasListener() {
+		return
+	}
+	if event.Sid == "" {
+		event.Sid = b.Id()
+	}
+	event.Session = b.IfSession
+	Emit(event)
+}
+
+// EmitDestroyed emits the destroyed event, it should be called by the stores after the session destroyed, the uid will
+// be attached if the user was loaded.
+func (s *UserSession[U]) EmitDestroyed() {
+	if !hasListener() {
+		return
+	}
+	event := Event{Kind: EventDestroyed}
+	if s.loadState == loadedSome {
+		event.Uid = s.user.Uid()
+	}
+	s.emit(event)
+}
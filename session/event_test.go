@@ -0,0 +1,58 @@
+package session_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	var events []session.Event
+	cancel := session.Listen(func(e session.Event) {
+		events = append(events, e)
+	})
+	defer cancel()
+	kinds := func() []session.EventKind {
+		var result []session.EventKind
+		for _, e := range events {
+			result = append(result, e.Kind)
+		}
+		events = nil
+		return result
+	}
+
+	s, _ := session.NewShmSession[*session.SimpleUser](nil, 1)
+	_ = s.Set("a", 1)
+	if got := kinds(); !slices.Equal(got, []session.EventKind{session.EventFieldChanged, session.EventCreated}) {
+		t.Fatalf("unexpected events %v", got)
+	}
+	anonymousSid := s.Id()
+	_ = s.Login(&session.SimpleUser{Id: 99, Nick: "Drunk"}, 0)
+	login := events[len(events)-1]
+	if got := kinds(); !slices.Equal(got, []session.EventKind{session.EventRenewed, session.EventDestroyed, session.EventLogin}) {
+		t.Fatalf("unexpected events %v", got)
+	} else if login.OldSid != anonymousSid || login.Sid != s.Id() || login.Uid != 99 {
+		t.Fatalf("unexpected login event %+v", login)
+	}
+	_ = s.Logout()
+	if logout := events[0]; logout.Kind != session.EventLogout || logout.Uid != 99 {
+		t.Fatalf("unexpected logout event %+v", logout)
+	}
+	events = nil
+
+	only := session.Listen(func(e session.Event) {
+		if e.Kind != session.EventExpired {
+			t.Fatalf("unexpected event %v", e.Kind)
+		}
+	}, session.EventExpired)
+	defer only()
+	session.ShmAdvance(t, 2*time.Minute)
+	if _, err := s.SilentGet("a"); err == nil {
+		t.Fatal("session should be expired")
+	}
+	if got := kinds(); !slices.Equal(got, []session.EventKind{session.EventExpired}) {
+		t.Fatalf("unexpected events %v", got)
+	}
+}
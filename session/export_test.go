@@ -0,0 +1,27 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+// ShmAdvance moves the shm clock forward to simulate the expiry, the clock will be restored after the test.
+func ShmAdvance(t testing.TB, d time.Duration) {
+	now := shmNow
+	t.Cleanup(func() {
+		shmNow = now
+	})
+	shmNow = func() int64 {
+		return now() + int64(d.Seconds())
+	}
+}
+
+// ShmStoreUnindexed stores a session already removed from the index but not cleared from the mapping yet, it simulates
+// the window between the sweep or eviction and the clear.
+func ShmStoreUnindexed(sid string, data map[string]any, expired bool) {
+	meta := &shmMeta{sid: sid, data: data}
+	if expired {
+		meta.expireStamp.Store(shmNow() - 1)
+	}
+	sessionMapping.Store(sid, meta)
+}
@@ -0,0 +1,68 @@
+package files
+
+import (
+	"time"
+
+	"go.drunkce.com/dce/session"
+)
+
+// NewSession creates a session persisted in a local file Store, it is designed for the single-node deployments without
+// Redis, the sessions will survive the process restarts.
+//
+//	store, err := files.Open("/var/lib/app/session.log")
+//	stop := store.StartSweeper(time.Minute)
+//	defer stop()
+//	sess, err := files.NewSession[*session.SimpleUser](store, []string{ctx.Rp.Sid()}, session.DefaultTtlMinutes)
+func NewSession[U session.UidGetter](store *Store, sidPool []string, ttlMinutes uint16) (*session.StoreSession[U], error) {
+	return session.NewStoreSession[U](kvStore{store}, sidPool, ttlMinutes)
+}
+
+// kvStore adapts the Store to the session.KvStore, the reads of the Store never fail, and the expiry is written with
+// the fields in the same log write.
+type kvStore struct {
+	*Store
+}
+
+func (k kvStore) HSet(key string, fields map[string]string, ttl time.Duration) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok := k.live(key)
+	records := k.create(key, &logRecord{Op: opHSet, Key: key, Fields: fields})
+	if !ok {
+		records = append(records, &logRecord{Op: opExpire, Key: key, ExpireAt: k.now().Add(ttl).UnixMilli()})
+	}
+	return k.write(records...)
+}
+
+func (k kvStore) HGet(key string, field string) (string, bool, error) {
+	v, ok := k.Store.HGet(key, field)
+	return v, ok, nil
+}
+
+func (k kvStore) HGetAll(key string) (map[string]string, error) {
+	return k.Store.HGetAll(key), nil
+}
+
+func (k kvStore) HDel(key string, field string) error {
+	return k.Store.HDel(key, field)
+}
+
+func (k kvStore) Exists(key string) (bool, error) {
+	return k.Store.Exists(key), nil
+}
+
+func (k kvStore) TTL(key string) (time.Duration, bool, error) {
+	ttl, ok := k.Store.TTL(key)
+	return ttl, ok, nil
+}
+
+func (k kvStore) SAdd(key string, ttl time.Duration, members ...string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	records := k.create(key, &logRecord{Op: opSAdd, Key: key, Members: members})
+	return k.write(append(records, &logRecord{Op: opExpire, Key: key, ExpireAt: k.now().Add(ttl).UnixMilli()})...)
+}
+
+func (k kvStore) SMembers(key string) ([]string, error) {
+	return k.Store.SMembers(key), nil
+}
@@ -0,0 +1,508 @@
+package files
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+const DefaultCompactThreshold = 10000
+
+const (
+	opHSet   = "hset"
+	opHDel   = "hdel"
+	opSAdd   = "sadd"
+	opSRem   = "srem"
+	opDel    = "del"
+	opExpire = "expire"
+)
+
+// logRecord is a line of the append-only log, it is serialized as "<crc32 hex> <json>\n", so that a torn write
+// caused by a crash could be detected and truncated while replaying.
+type logRecord struct {
+	Op     string            `json:"o"`
+	Key    string            `json:"k"`
+	Fields map[string]string `json:"f,omitempty"`
+	// Members is the field names to delete for the hdel op, or the set members for the sadd/srem ops
+	Members []string `json:"m,omitempty"`
+	// ExpireAt is the unix milli stamp for the expire op
+	ExpireAt int64 `json:"e,omitempty"`
+}
+
+// logFile is the operations of the log file, it is an *os.File except in the tests injecting the failures.
+type logFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+type entry struct {
+	hash     map[string]string
+	set      map[string]struct{}
+	expireAt int64
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expireAt > 0 && e.expireAt <= now
+}
+
+// Store is a durable key-value store persisted in an append-only log file, it keeps all the live data in memory and
+// replays the log while opening. Each mutation is appended and synced to the disk before it takes effect in memory
+// (unless the sync disabled), the log will be compacted into a snapshot of the live data when it grows too large.
+//
+// It provides the hash, set and expiry semantics that the file session requires, similar to a tiny subset of Redis.
+type Store struct {
+	path    string
+	file    logFile
+	entries map[string]*entry
+	// stale is the keys expired and dropped from memory but still in the log, they should be deleted in the log
+	// before re-created, or else the replay will merge the new data into the stale entries
+	stale            map[string]struct{}
+	records          int
+	compactThreshold int
+	syncWrites       bool
+	// torn reports the log may end with a partial record which could not be truncated, it will be compacted before
+	// the next write
+	torn bool
+	// now returns the current time, it could be replaced in tests to simulate the expiry
+	now func() time.Time
+	mu  sync.Mutex
+}
+
+// Open opens or creates the store log file, and replays it to restore the data.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:             path,
+		entries:          make(map[string]*entry),
+		stale:            make(map[string]struct{}),
+		compactThreshold: DefaultCompactThreshold,
+		syncWrites:       true,
+		now:              time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	if err = s.replay(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetSyncWrites specifies whether to fsync after each write, disabling it improves the write performance but the
+// latest writes may be lost when the system crashes.
+func (s *Store) SetSyncWrites(sync bool) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncWrites = sync
+	return s
+}
+
+// SetCompactThreshold specifies the minimum number of log records to trigger the automatic compaction.
+func (s *Store) SetCompactThreshold(threshold int) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compactThreshold = threshold
+	return s
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// replay applies the records of the log, an incomplete tail line means the last write was torn by a crash, it will be
+// truncated. The corrupted lines in the middle are skipped, so that the valid records after them are kept, and the log
+// will be compacted to drop them.
+func (s *Store) replay() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	corrupted := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err = s.truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		record, ok := decodeRecord(line)
+		if !ok {
+			corrupted++
+			continue
+		}
+		s.apply(record)
+		s.records++
+	}
+	s.sweep(s.now().UnixMilli())
+	if corrupted > 0 {
+		slog.Warn(fmt.Sprintf("Skipped %d corrupted records of the session log %s", corrupted, s.path))
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *Store) truncate(offset int64) error {
+	if err := s.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := s.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func encodeRecord(record *logRecord) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data)), nil
+}
+
+func decodeRecord(line []byte) (*logRecord, bool) {
+	text := strings.TrimSuffix(string(line), "\n")
+	crc, data, ok := strings.Cut(text, " ")
+	if !ok {
+		return nil, false
+	}
+	sum, err := strconv.ParseUint(crc, 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE([]byte(data)) {
+		return nil, false
+	}
+	var record logRecord
+	if err = json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, false
+	}
+	return &record, true
+}
+
+func (s *Store) apply(record *logRecord) {
+	e := s.entries[record.Key]
+	switch record.Op {
+	case opHSet:
+		if e == nil || e.hash == nil {
+			e = &entry{hash: make(map[string]string)}
+			s.entries[record.Key] = e
+		}
+		for k, v := range record.Fields {
+			e.hash[k] = v
+		}
+	case opHDel:
+		if e != nil {
+			for _, field := range record.Members {
+				delete(e.hash, field)
+			}
+		}
+	case opSAdd:
+		if e == nil || e.set == nil {
+			e = &entry{set: make(map[string]struct{})}
+			s.entries[record.Key] = e
+		}
+		for _, member := range record.Members {
+			e.set[member] = struct{}{}
+		}
+	case opSRem:
+		if e != nil {
+			for _, member := range record.Members {
+				delete(e.set, member)
+			}
+		}
+	case opDel:
+		delete(s.entries, record.Key)
+		delete(s.stale, record.Key)
+	case opExpire:
+		if e != nil {
+			e.expireAt = record.ExpireAt
+		}
+	}
+	if e != nil && record.Op != opDel && len(e.hash) == 0 && len(e.set) == 0 {
+		delete(s.entries, record.Key)
+	}
+}
+
+// write appends the records to the log and applies them, the caller should hold the lock.
+func (s *Store) write(records ...*logRecord) error {
+	var buffer []byte
+	for _, record := range records {
+		line, err := encodeRecord(record)
+		if err != nil {
+			return err
+		}
+		buffer = append(buffer, line...)
+	}
+	if s.torn {
+		if err := s.compact(); err != nil {
+			return err
+		}
+		s.torn = false
+	}
+	offset, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = s.file.Write(buffer); err == nil && s.syncWrites {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// drop the partial bytes, or else the later records will be appended to the torn one
+		if s.truncate(offset) != nil {
+			s.torn = true
+		}
+		return err
+	}
+	for _, record := range records {
+		s.apply(record)
+	}
+	s.records += len(records)
+	if s.records > s.compactThreshold && s.records > 2*len(s.entries) {
+		return s.compact()
+	}
+	return nil
+}
+
+// live returns the entry if exists and not expired, the caller should hold the lock.
+func (s *Store) live(key string) (*entry, bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	} else if e.expired(s.now().UnixMilli()) {
+		delete(s.entries, key)
+		s.stale[key] = struct{}{}
+		return nil, false
+	}
+	return e, true
+}
+
+// create returns the records to create or update the key, a del record will be prepended if the key was expired, so
+// that the expired entry will not be revived by a partial write after replayed, the caller should hold the lock.
+func (s *Store) create(key string, record *logRecord) []*logRecord {
+	if _, ok := s.live(key); !ok {
+		if _, ok = s.stale[key]; ok {
+			return []*logRecord{{Op: opDel, Key: key}, record}
+		}
+	}
+	return []*logRecord{record}
+}
+
+func (s *Store) HSet(key string, fields map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(s.create(key, &logRecord{Op: opHSet, Key: key, Fields: fields})...)
+}
+
+func (s *Store) HGet(key string, field string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.live(key); ok {
+		v, ok := e.hash[field]
+		return v, ok
+	}
+	return "", false
+}
+
+func (s *Store) HGetAll(key string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make(map[string]string)
+	if e, ok := s.live(key); ok {
+		for k, v := range e.hash {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func (s *Store) HDel(key string, fields ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.live(key); !ok {
+		return nil
+	}
+	return s.write(&logRecord{Op: opHDel, Key: key, Members: fields})
+}
+
+func (s *Store) SAdd(key string, members ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(s.create(key, &logRecord{Op: opSAdd, Key: key, Members: members})...)
+}
+
+func (s *Store) SRem(key string, members ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.live(key); !ok {
+		return nil
+	}
+	return s.write(&logRecord{Op: opSRem, Key: key, Members: members})
+}
+
+func (s *Store) SMembers(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var members []string
+	if e, ok := s.live(key); ok {
+		for member := range e.set {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+func (s *Store) Exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.live(key)
+	return ok
+}
+
+func (s *Store) Del(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		return nil
+	}
+	return s.write(&logRecord{Op: opDel, Key: key})
+}
+
+func (s *Store) Expire(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.live(key); !ok {
+		return nil
+	}
+	return s.write(&logRecord{Op: opExpire, Key: key, ExpireAt: s.now().Add(ttl).UnixMilli()})
+}
+
+// TTL returns the remaining time to live of the key, it returns false if the key not exists or has no expiry.
+func (s *Store) TTL(key string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.live(key); ok && e.expireAt > 0 {
+		return time.Duration(e.expireAt-s.now().UnixMilli()) * time.Millisecond, true
+	}
+	return 0, false
+}
+
+// sweep removes the expired entries from memory, they will be dropped from the log at the next compaction.
+func (s *Store) sweep(now int64) int {
+	swept := 0
+	for key, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, key)
+			s.stale[key] = struct{}{}
+			swept++
+		}
+	}
+	return swept
+}
+
+// Sweep removes the expired entries, and compacts the log if there were any expired.
+func (s *Store) Sweep() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sweep(s.now().UnixMilli()) > 0 {
+		return s.compact()
+	}
+	return nil
+}
+
+// StartSweeper sweeps the expired entries periodically until the stop function called.
+func (s *Store) StartSweeper(interval time.Duration) (stop func()) {
+	return session.StartSweeper(interval, func() {
+		if err := s.Sweep(); err != nil {
+			slog.Warn(fmt.Sprintf("Session log sweeping failed: %s", err.Error()))
+		}
+	})
+}
+
+// Compact rewrites the log with a snapshot of the live data.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// compact writes the snapshot into a temporary file and atomically renames it to replace the log, so that the
+// log will keep consistent whenever the process crashes, the caller should hold the lock.
+func (s *Store) compact() error {
+	now := s.now().UnixMilli()
+	s.sweep(now)
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	records := 0
+	for key, e := range s.entries {
+		var snapshot []*logRecord
+		if len(e.hash) > 0 {
+			snapshot = append(snapshot, &logRecord{Op: opHSet, Key: key, Fields: e.hash})
+		} else if len(e.set) > 0 {
+			snapshot = append(snapshot, &logRecord{Op: opSAdd, Key: key, Members: util.MapSeq2From[string, struct{}, string](e.set).Map2(func(member string, _ struct{}) string {
+				return member
+			}).Collect()})
+		}
+		if e.expireAt > 0 {
+			snapshot = append(snapshot, &logRecord{Op: opExpire, Key: key, ExpireAt: e.expireAt})
+		}
+		for _, record := range snapshot {
+			line, err := encodeRecord(record)
+			if err != nil {
+				_ = tmp.Close()
+				return err
+			} else if _, err = writer.Write(line); err != nil {
+				_ = tmp.Close()
+				return err
+			}
+			records++
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	} else if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	} else if err = os.Rename(tmpPath, s.path); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	syncDir(filepath.Dir(s.path))
+	_ = s.file.Close()
+	s.file = tmp
+	s.records = records
+	// the expired entries were dropped from the snapshot
+	clear(s.stale)
+	return nil
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
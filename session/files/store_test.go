@@ -0,0 +1,204 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/session/sessiontest"
+)
+
+func TestStoreReplayAndCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.log")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := NewSession[*session.SimpleUser](store, nil, session.DefaultTtlMinutes)
+	if err = sess.Login(&session.SimpleUser{Id: 1, Nick: "Drunk"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.HSet("temp", map[string]string{"a": "1"})
+	_ = store.Expire("temp", time.Millisecond)
+	_ = store.Close()
+
+	// simulate a torn write
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	_, _ = file.WriteString(`0000 {"o":"hset"`)
+	_ = file.Close()
+
+	time.Sleep(2 * time.Millisecond)
+	if store, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if store.Exists("temp") {
+		t.Fatal("expired key should not be restored")
+	}
+	restored, _ := NewSession[*session.SimpleUser](store, []string{sess.Id()}, 0)
+	if user, ok := restored.User(); !ok || user.Nick != "Drunk" {
+		t.Fatalf("user should be restored after reopen, got %v", user)
+	}
+	if sids, _ := restored.Sids(1); len(sids) != 1 || sids[0] != sess.Id() {
+		t.Fatalf("uid mapping should be restored, got %v", sids)
+	}
+	if err = store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+	if store, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if store.records != len(store.entries)*2 {
+		t.Fatalf("compacted log should only contain the snapshot, got %d records", store.records)
+	}
+	if _, ok := store.HGet(sess.Key(), session.DefaultUserField); !ok {
+		t.Fatal("session data lost after compaction")
+	}
+}
+
+func TestStoreRecreateExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.log")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.HSet("hash", map[string]string{"old": "1"})
+	_ = store.Expire("hash", time.Millisecond)
+	_ = store.SAdd("set", "old")
+	_ = store.Expire("set", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+
+	// re-create the expired keys without expiry
+	_ = store.HSet("hash", map[string]string{"new": "1"})
+	_ = store.SAdd("set", "new")
+	_ = store.Close()
+
+	if store, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if fields := store.HGetAll("hash"); len(fields) != 1 || fields["new"] != "1" {
+		t.Fatalf("re-created hash should survive the replay without the stale fields, got %v", fields)
+	} else if _, ok := store.TTL("hash"); ok {
+		t.Fatal("re-created hash should not inherit the stale expiry")
+	}
+	if members := store.SMembers("set"); len(members) != 1 || members[0] != "new" {
+		t.Fatalf("re-created set should survive the replay without the stale members, got %v", members)
+	}
+}
+
+// faultyFile writes only the half of the bytes once, and fails the truncation if truncateErr set
+type faultyFile struct {
+	logFile
+	short       bool
+	truncateErr error
+}
+
+func (f *faultyFile) Write(bytes []byte) (int, error) {
+	if f.short {
+		f.short = false
+		n, _ := f.logFile.Write(bytes[:len(bytes)/2])
+		return n, io.ErrShortWrite
+	}
+	return f.logFile.Write(bytes)
+}
+
+func (f *faultyFile) Truncate(size int64) error {
+	if f.truncateErr != nil {
+		return f.truncateErr
+	}
+	return f.logFile.Truncate(size)
+}
+
+func TestSessionSetWithExpiry(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "session.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sess, _ := NewSession[*session.SimpleUser](store, nil, session.DefaultTtlMinutes)
+	records := store.records
+	if err = sess.SilentSet("a", "1"); err != nil {
+		t.Fatal(err)
+	} else if ttl, ok := store.TTL(sess.Key()); !ok || ttl <= 0 {
+		t.Fatalf("the new session should expire without touched, got %v %t", ttl, ok)
+	} else if store.records-records != 2 {
+		t.Fatalf("the fields and the expiry should be written together, got %d records", store.records-records)
+	}
+}
+
+func TestStoreShortWrite(t *testing.T) {
+	for name, truncateErr := range map[string]error{"truncated": nil, "compacted": errors.New("truncate failed")} {
+		path := filepath.Join(t.TempDir(), "session.log")
+		store, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = store.HSet("a", map[string]string{"v": "1"})
+		store.file = &faultyFile{logFile: store.file, short: true, truncateErr: truncateErr}
+		if err = store.HSet("b", map[string]string{"v": "1"}); !errors.Is(err, io.ErrShortWrite) {
+			t.Fatalf("%s: expected the short write error, got %v", name, err)
+		}
+		if err = store.HSet("c", map[string]string{"v": "1"}); err != nil {
+			t.Fatalf("%s: expected the later write succeeded, got %v", name, err)
+		}
+		_ = store.Close()
+
+		if store, err = Open(path); err != nil {
+			t.Fatal(err)
+		}
+		if !store.Exists("a") || store.Exists("b") || !store.Exists("c") {
+			t.Fatalf("%s: expected the records around the torn one survived, got %v", name, store.entries)
+		}
+		_ = store.Close()
+	}
+}
+
+func TestStoreReplaySkipsCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.log")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.HSet("a", map[string]string{"v": "1"})
+	_ = store.Close()
+
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	line, _ := encodeRecord(&logRecord{Op: opHSet, Key: "c", Fields: map[string]string{"v": "1"}})
+	_, _ = file.WriteString(`0000 {"o":"hset"` + "\n" + string(line))
+	_ = file.Close()
+
+	if store, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if !store.Exists("a") || !store.Exists("c") {
+		t.Fatalf("expected the valid records after the corrupted one kept, got %v", store.entries)
+	} else if store.records != 2 {
+		t.Fatalf("expected the corrupted record compacted away, got %d records", store.records)
+	}
+}
+
+func TestFileConformance(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "session.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sessiontest.Run(t, sessiontest.Harness{
+		New: func(sidPool []string, ttlMinutes uint16) (sessiontest.Session, error) {
+			return NewSession[*session.SimpleUser](store, sidPool, ttlMinutes)
+		},
+		Advance: func(d time.Duration) {
+			now := store.now
+			store.now = func() time.Time {
+				return now().Add(d)
+			}
+		},
+	})
+}
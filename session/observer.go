@@ -0,0 +1,75 @@
+package session
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Operation is a finished session store operation.
+//
+// Fields:
+//   - Name: The operation name, such as "get", "set", "del", "touch" and "renew".
+//   - Session: The session operated.
+//   - Start: The start time of the operation.
+//   - Duration: The duration of the operation, including the encoding and decoding of the values.
+//   - Err: The error of the operation.
+//   - Context: The context bound to the session via `BindContext`, such as the routed request, nil if not bound.
+type Operation struct {
+	Name     string
+	Session  IfSession
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+	Context  context.Context
+}
+
+// BindContext binds the session to a context, such as the routed request, so that the observers could attribute the
+// operations to it, the session middleware binds the request sessions automatically. The clones inherit it, such as
+// the sessions cloned by the login and renewal.
+func (b *BasicSession) BindContext(ctx context.Context) {
+	b.ctx = ctx
+}
+
+// Context returns the context bound via `BindContext`, or nil if not bound.
+func (b *BasicSession) Context() context.Context {
+	return b.ctx
+}
+
+// Observer observes the session store operations, it is called synchronously after every operation, so it should
+// return quickly.
+type Observer func(op Operation)
+
+var observerMu sync.RWMutex
+var observers []*Observer
+
+// Observe registers an observer of the store operations, such as for the metrics and tracing, the returned function
+// cancels the registration.
+func Observe(observer Observer) (cancel func()) {
+	entry := &observer
+	observerMu.Lock()
+	observers = append(slices.Clone(observers), entry)
+	observerMu.Unlock()
+	return func() {
+		observerMu.Lock()
+		defer observerMu.Unlock()
+		if index := slices.Index(observers, entry); index > -1 {
+			observers = slices.Delete(slices.Clone(observers), index, index+1)
+		}
+	}
+}
+
+// observe dispatches the operation started at the start time, it should be deferred with a pointer to the named error.
+func (b *BasicSession) observe(name string, start time.Time, err *error) {
+	observerMu.RLock()
+	entries := observers
+	observerMu.RUnlock()
+	if len(entries) == 0 {
+		return
+	}
+	op := Operation{Name: name, Session: b.IfSession, Start: start, Duration: time.Since(start), Err: *err, Context: b.ctx}
+	for _, entry := range entries {
+		(*entry)(op)
+	}
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+const DefaultDeviceField = "$device"
+
+// LoginNanoField stores the login time in nanoseconds, it orders the sessions created in the same second on eviction,
+// since the create stamp of the sid is in seconds.
+const LoginNanoField = "$loginNano"
+
+// LoginPolicy limits the concurrent sessions of a user, it is enforced after each login, the evicted sessions will be
+// destroyed and emitted the EventEvicted before that.
+//
+// Fields:
+//   - MaxSessions: The maximum concurrent sessions per uid, the oldest sessions will be evicted if exceeded, 0 means
+//     unlimited.
+//   - SingleDevice: Whether to keep only one session per device type, the device type is stored in the `DeviceField`
+//     of the session, it should be set before login via `SetDevice`, the sessions without device type are ignored.
+type LoginPolicy struct {
+	MaxSessions  int
+	SingleDevice bool
+}
+
+// SetLoginPolicy specifies the concurrent login policy, it should be called by the store factory before login, the
+// clones will inherit it.
+//
+//	sess, _ := redises.NewSession[*session.SimpleUser](rdb, []string{sid}, session.DefaultTtlMinutes)
+//	sess.SetLoginPolicy(session.LoginPolicy{MaxSessions: 5, SingleDevice: true})
+//	_ = sess.SetDevice("mobile")
+//	err := sess.Login(user, 0)
+func (s *UserSession[U]) SetLoginPolicy(policy LoginPolicy) {
+	s.policy = &policy
+}
+
+// SetDevice stores the client device type, such as "web", "mobile" or "desktop", which is used by the SingleDevice
+// login policy.
+func (s *UserSession[U]) SetDevice(device string) error {
+	return s.Set(s.DeviceField, device)
+}
+
+func (s *UserSession[U]) Device() string {
+	return sessionValue[string](s.IfSession, s.DeviceField)
+}
+
+// sessionValue gets the field value of the session silently, the zero value will be returned if not found.
+func sessionValue[T any](sess IfSession, field string) T {
+	var value T
+	if val, err := sess.SilentGet(field); err != nil {
+		return value
+	} else if decoder, ok := sess.(interface{ decode(any, any) error }); ok {
+		_ = decoder.decode(val, &value)
+	} else {
+		value, _ = val.(T)
+	}
+	return value
+}
+
+type policyCandidate struct {
+	sid         string
+	createStamp int64
+	loginNano   int64
+}
+
+// enforcePolicy evicts the other sessions of the logged in user which violate the login policy.
+func (s *UserSession[U]) enforcePolicy(uid uint64) error {
+	if s.policy == nil || (s.policy.MaxSessions < 1 && !s.policy.SingleDevice) {
+		return nil
+	}
+	sids, err := s.Sids(uid)
+	if err != nil {
+		return err
+	}
+	device := s.Device()
+	var candidates []policyCandidate
+	for _, sid := range sids {
+		if sid == s.Id() {
+			continue
+		}
+		cl, err := s.Clone(sid)
+		if err != nil {
+			// the invalid sid could not be a live session, just unmapping it
+			continue
+		}
+		other := cl.(IfSession)
+		if s.policy.SingleDevice && device != "" && sessionValue[string](other, s.DeviceField) == device {
+			if err = s.evict(sid, uid); err != nil {
+				return err
+			}
+			continue
+		}
+		candidates = append(candidates, policyCandidate{sid: sid, createStamp: other.CreateStamp(),
+			loginNano: sessionValue[int64](other, LoginNanoField)})
+	}
+	if s.policy.MaxSessions < 1 || len(candidates) < s.policy.MaxSessions {
+		return nil
+	}
+	// the sessions logged in the same second are ordered by the login nanoseconds, and then the sid for determinacy
+	slices.SortFunc(candidates, func(a, b policyCandidate) int {
+		return cmp.Or(cmp.Compare(a.createStamp, b.createStamp), cmp.Compare(a.loginNano, b.loginNano), strings.Compare(a.sid, b.sid))
+	})
+	// keep the current session, and the newest others
+	for _, c := range candidates[:len(candidates)-s.policy.MaxSessions+1] {
+		if err = s.evict(c.sid, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evict destroys the session of the sid, the client address of the connection bound to it will be attached to the
+// EventEvicted, so that the listeners could close the live connection.
+func (s *UserSession[U]) evict(sid string, uid uint64) error {
+	cl, err := s.IfSession.Clone(sid)
+	if err != nil {
+		return err
+	}
+	evicted := cl.(IfSession)
+	event := Event{Kind: EventEvicted, Sid: sid, Uid: uid, Session: evicted}
+	// the connection info was stored without serialization
+	if val, err := evicted.SilentGet(DefaultClientField); err == nil {
+		event.Client, _ = val.(string)
+	}
+	if hasListener() {
+		Emit(event)
+	}
+	return evicted.Destroy()
+}
+
+// LogoutAll logs out the user everywhere, all the other sessions of the user will be evicted, and the current session
+// will be logged out.
+func (s *UserSession[U]) LogoutAll() error {
+	uid, err := s.Uid()
+	if err != nil {
+		// not logged in
+		return nil
+	}
+	sids, err := s.Sids(uid)
+	if err != nil {
+		return err
+	}
+	for _, sid := range sids {
+		if sid != s.Id() {
+			if err = s.evict(sid, uid); err != nil {
+				return err
+			}
+		}
+	}
+	return s.Logout()
+}
@@ -2,8 +2,8 @@ package redises
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -20,7 +20,8 @@ import (
 // - BasicSession: Manages basic session properties like session ID and TTL.
 // - UserSession: Manages user-specific session data and operations.
 // - ConnectionSession: Manages connection-related session data and operations.
-// - redis: A Redis client used to interact with the Redis database.
+// - redis: A Redis client used to interact with the Redis database, it could be a standalone, cluster or sentinel
+// client.
 // - ctx: A context.Context used for Redis operations.
 //
 // This struct provides methods for session manipulation, including setting, getting, and deleting
@@ -30,11 +31,11 @@ type Session[U session.UidGetter] struct {
 	*session.BasicSession
 	*session.UserSession[U]
 	*session.ConnectionSession
-	redis *redis.Client
+	redis redis.UniversalClient
 	ctx   context.Context
 }
 
-func NewSession[U session.UidGetter](rdb *redis.Client, sidPool []string, ttlMinutes uint16) (*Session[U], error) {
+func NewSession[U session.UidGetter](rdb redis.UniversalClient, sidPool []string, ttlMinutes uint16) (*Session[U], error) {
 	basic, err := session.NewBasicSession(sidPool, ttlMinutes)
 	if err != nil {
 		return nil, err
@@ -52,7 +53,20 @@ func NewSession[U session.UidGetter](rdb *redis.Client, sidPool []string, ttlMin
 	return rs, nil
 }
 
+var hashTag string
+
+// SetHashTag specifies the hash tag of the keys, such as "dce" makes the keys like "dcesid:{dce}:<sid>", so that all the
+// sessions and user indexes are in the same slot, it is required on Redis Cluster, since the atomic scripts access
+// the session keys and the user index together. The sessions could not be sharded across the nodes then, so it is
+// better to use a dedicated cluster for them. It should be specified before any session created.
+func SetHashTag(tag string) {
+	hashTag = tag
+}
+
 func redisGenKey(prefix string, id string) string {
+	if hashTag != "" {
+		return fmt.Sprintf("%s:{%s}:%s", prefix, hashTag, id)
+	}
 	return fmt.Sprintf("%s:%s", prefix, id)
 }
 
@@ -73,10 +87,19 @@ func (r *Session[U]) SilentDel(field string) error {
 }
 
 func (r *Session[U]) Destroy() error {
-	if err := r.Unmapping(); err != nil {
+	_, err := r.redis.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		// the anonymous sessions have no user mapping
+		if userKey, err := r.UserKey(); err == nil {
+			pipe.SRem(r.ctx, userKey, r.BasicSession.Id())
+		}
+		pipe.Del(r.ctx, r.Key())
+		return nil
+	})
+	if err != nil {
 		return err
 	}
-	return r.redis.Del(r.ctx, r.Key()).Err()
+	r.EmitDestroyed()
+	return nil
 }
 
 func (r *Session[U]) Touch() error {
@@ -109,6 +132,19 @@ func (r *Session[U]) TtlPassed() (uint32, error) {
 	return r.TtlSeconds() - uint32(ttl.Seconds()), nil
 }
 
+// CopyTo copies the session data into the new sid atomically, it will be called on renewal.
+func (r *Session[U]) CopyTo(sid string, filters map[string]any) error {
+	args := []any{r.TtlSeconds()}
+	for k, v := range filters {
+		if v == nil {
+			args = append(args, k, "0", "")
+		} else {
+			args = append(args, k, "1", v)
+		}
+	}
+	return copyScript.Run(r.ctx, r.redis, []string{r.Key(), redisGenKey(r.SidName, sid)}, args...).Err()
+}
+
 func (r *Session[U]) Renew(filters map[string]any) error {
 	err := r.UserSession.Renew(filters)
 	if err == nil && r.Request() {
@@ -131,7 +167,7 @@ func (r *Session[U]) Clone(id string) (any, error) {
 }
 
 func redisGenUserKey(userPrefix string, id uint64) string {
-	return fmt.Sprintf("%s:%d", userPrefix, id)
+	return redisGenKey(userPrefix, strconv.FormatUint(id, 10))
 }
 
 func (r *Session[U]) UserKey() (string, error) {
@@ -147,10 +183,11 @@ func (r *Session[U]) Mapping() error {
 	if err != nil {
 		return err
 	}
-	pipe := r.redis.Pipeline()
-	pipe.SAdd(r.ctx, userKey, r.BasicSession.Id())
-	pipe.Expire(r.ctx, userKey, time.Duration(session.MappingTtlSeconds)*time.Second)
-	_, err = pipe.Exec(r.ctx)
+	_, err = r.redis.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(r.ctx, userKey, r.BasicSession.Id())
+		pipe.Expire(r.ctx, userKey, time.Duration(session.MappingTtlSeconds)*time.Second)
+		return nil
+	})
 	return err
 }
 
@@ -163,20 +200,23 @@ func (r *Session[U]) Unmapping() error {
 }
 
 func (r *Session[U]) Sync(user *U) error {
-	userJson, err := json.Marshal(user)
+	userSeq, err := r.Codec().Marshal(*user)
 	if err != nil {
 		return err
 	}
-	sids, err := r.Sids((*user).Uid())
-	if err != nil {
+	userKey := redisGenUserKey(r.KeyPrefix, (*user).Uid())
+	// the sessions mapped after the members read were logged in with the latest user, so they need no sync
+	sids, err := r.redis.SMembers(r.ctx, userKey).Result()
+	if err != nil || len(sids) == 0 {
 		return err
 	}
-	pipe := r.redis.Pipeline()
+	keys := []string{userKey}
+	args := []any{r.UserField, userSeq}
 	for _, sid := range sids {
-		pipe.HSet(r.ctx, redisGenKey(r.SidName, sid), r.UserField, userJson)
+		keys = append(keys, redisGenKey(r.SidName, sid))
+		args = append(args, sid)
 	}
-	_, err = pipe.Exec(r.ctx)
-	return err
+	return syncScript.Run(r.ctx, r.redis, keys, args...).Err()
 }
 
 func (r *Session[U]) AllSid(uid uint64) ([]string, error) {
@@ -184,16 +224,14 @@ func (r *Session[U]) AllSid(uid uint64) ([]string, error) {
 }
 
 func (r *Session[U]) FilterSids(uid uint64, sids []string) ([]string, error) {
-	userKey := redisGenUserKey(r.KeyPrefix, uid)
-	var filtered []string
-	pipe := r.redis.Pipeline()
-	for _, sid := range sids {
-		if r.redis.Exists(r.ctx, redisGenKey(r.SidName, sid)).Val() > 0 {
-			filtered = append(filtered, sid)
-		} else {
-			pipe.SRem(r.ctx, userKey, sid)
-		}
+	if len(sids) == 0 {
+		return nil, nil
+	}
+	keys := []string{redisGenUserKey(r.KeyPrefix, uid)}
+	args := make([]any, len(sids))
+	for i, sid := range sids {
+		keys = append(keys, redisGenKey(r.SidName, sid))
+		args[i] = sid
 	}
-	_, err := pipe.Exec(r.ctx)
-	return filtered, err
+	return filterScript.Run(r.ctx, r.redis, keys, args...).StringSlice()
 }
@@ -0,0 +1,100 @@
+package redises
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/session/sessiontest"
+)
+
+func TestRedisConformance(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	sessiontest.Run(t, sessiontest.Harness{
+		New: func(sidPool []string, ttlMinutes uint16) (sessiontest.Session, error) {
+			return NewSession[*session.SimpleUser](rdb, sidPool, ttlMinutes)
+		},
+		Advance: mr.FastForward,
+	})
+}
+
+func TestRedisHashTaggedConformance(t *testing.T) {
+	SetHashTag("dce")
+	defer SetHashTag("")
+	mr := miniredis.RunT(t)
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{mr.Addr()}})
+	defer rdb.Close()
+	sessiontest.Run(t, sessiontest.Harness{
+		New: func(sidPool []string, ttlMinutes uint16) (sessiontest.Session, error) {
+			return NewSession[*session.SimpleUser](rdb, sidPool, ttlMinutes)
+		},
+		Advance: mr.FastForward,
+	})
+	for _, key := range mr.Keys() {
+		if !strings.Contains(key, ":{dce}:") {
+			t.Fatalf("key %s should be hash tagged", key)
+		}
+	}
+}
+
+// keysHook asserts the session keys accessed by the scripts are declared in KEYS.
+type keysHook struct {
+	t *testing.T
+}
+
+func (h keysHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h keysHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if name := cmd.Name(); name == "evalsha" || name == "eval" {
+			args := cmd.Args()
+			numKeys, _ := args[2].(int)
+			for _, arg := range args[3+numKeys:] {
+				if str := fmt.Sprint(arg); strings.HasPrefix(str, session.DefaultIdName+":") {
+					h.t.Errorf("script accesses the undeclared key %s", str)
+				}
+			}
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h keysHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestSyncDeclaresKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	rdb.AddHook(keysHook{t})
+	user := &session.SimpleUser{Id: 1, Nick: "Drunk"}
+	var sessions []*Session[*session.SimpleUser]
+	for range 2 {
+		sess, _ := NewSession[*session.SimpleUser](rdb, nil, session.DefaultTtlMinutes)
+		if err := sess.Login(user, 0); err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, sess)
+	}
+	mr.Del(sessions[1].Key())
+	user.Nick = "Sober"
+	if err := sessions[0].Sync(&user); err != nil {
+		t.Fatal(err)
+	}
+	if sids, _ := sessions[0].AllSid(1); len(sids) != 1 || sids[0] != sessions[0].Id() {
+		t.Fatalf("the dead session should be unmapped, got %v", sids)
+	}
+	restored, _ := NewSession[*session.SimpleUser](rdb, []string{sessions[0].Id()}, 0)
+	if u, ok := restored.User(); !ok || u.Nick != "Sober" {
+		t.Fatalf("user should be synced, got %v", u)
+	}
+}
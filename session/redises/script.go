@@ -0,0 +1,71 @@
+package redises
+
+import "github.com/redis/go-redis/v9"
+
+// The multistep operations are executed as server-side scripts, so that they are atomic. All the accessed keys are
+// passed via KEYS, the scripts accessing both the user index and the session keys require them in the same slot on
+// Redis Cluster, see `SetHashTag`.
+
+// copyScript copies the session hash into a new key with the filters applied, and expires the new key.
+//
+//	KEYS: old key, new key
+//	ARGV: ttl seconds, [field, "1" to set or "0" to delete, value]...
+var copyScript = redis.NewScript(`
+local data = redis.call('HGETALL', KEYS[1])
+local fields = {}
+for i = 1, #data, 2 do
+	fields[data[i]] = data[i + 1]
+end
+for i = 2, #ARGV, 3 do
+	if ARGV[i + 1] == '1' then
+		fields[ARGV[i]] = ARGV[i + 2]
+	else
+		fields[ARGV[i]] = nil
+	end
+end
+local args = {}
+for k, v in pairs(fields) do
+	args[#args + 1] = k
+	args[#args + 1] = v
+end
+if #args == 0 then
+	return 0
+end
+redis.call('DEL', KEYS[2])
+redis.call('HSET', KEYS[2], unpack(args))
+redis.call('EXPIRE', KEYS[2], ARGV[1])
+return 1
+`)
+
+// filterScript returns the sids whose sessions are alive, and removes the dead ones from the user index.
+//
+//	KEYS: user key, session keys...
+//	ARGV: sids... (in the same order of the session keys)
+var filterScript = redis.NewScript(`
+local alive = {}
+for i = 2, #KEYS do
+	if redis.call('EXISTS', KEYS[i]) == 1 then
+		alive[#alive + 1] = ARGV[i - 1]
+	else
+		redis.call('SREM', KEYS[1], ARGV[i - 1])
+	end
+end
+return alive
+`)
+
+// syncScript sets the user field of the alive sessions in the user index, and removes the dead ones.
+//
+//	KEYS: user key, session keys...
+//	ARGV: user field, user value, sids... (in the same order of the session keys)
+var syncScript = redis.NewScript(`
+local synced = 0
+for i = 2, #KEYS do
+	if redis.call('EXISTS', KEYS[i]) == 1 then
+		redis.call('HSET', KEYS[i], ARGV[1], ARGV[2])
+		synced = synced + 1
+	else
+		redis.call('SREM', KEYS[1], ARGV[i + 1])
+	end
+end
+return synced
+`)
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
@@ -33,7 +34,10 @@ type BasicSession struct {
 	createStamp int64
 	touches     bool
 	newborn     bool
+	created     bool
 	sidPool     []string
+	codec       Codec
+	ctx         context.Context
 }
 
 func NewBasicSession(sidPool []string, ttlMinutes uint16) (*BasicSession, error) {
@@ -65,7 +69,16 @@ func NewBasicSession(sidPool []string, ttlMinutes uint16) (*BasicSession, error)
 	}, nil
 }
 
+// parseSid verifies the sid signature if the signer enabled, and parses the ttl and create stamp from the sid, it will
+// be called before any store lookup, so that the tampered sids will be rejected early.
 func parseSid(sid string) (uint16, int64, error) {
+	if sidSigner != nil {
+		plain, err := sidSigner.Verify(sid)
+		if err != nil {
+			return 0, 0, err
+		}
+		sid = plain
+	}
 	if len(sid) < MinSidLen {
 		return 0, 0, util.Closed0(`invalid sid "%s", less then %d chars`, sid, MinSidLen)
 	}
@@ -99,7 +112,11 @@ func GenSid(ttlMinutes uint16) (sid string, createStamp int64) {
 	now := time.Now()
 	hash := sha256.New()
 	hash.Write([]byte(fmt.Sprintf("%d-%d", now.UnixNano(), rand.Uint())))
-	return fmt.Sprintf("%x%04x%x", hash.Sum(nil), ttlMinutes, now.Unix()), now.Unix()
+	sid = fmt.Sprintf("%x%04x%08x", hash.Sum(nil), ttlMinutes, now.Unix())
+	if sidSigner != nil {
+		sid = sidSigner.Sign(sid)
+	}
+	return sid, now.Unix()
 }
 
 func (b *BasicSession) CloneBasic(cloned IfSession, id string) (*BasicSession, error) {
@@ -134,28 +151,36 @@ func (b *BasicSession) Newborn() bool {
 	return b.newborn
 }
 
+// Touched reports whether the session was touched in current request, a newborn untouched session was not persisted.
+func (b *BasicSession) Touched() bool {
+	return b.touches
+}
+
 func (b *BasicSession) NeedSerial() bool {
 	return true
 }
 
-func (b *BasicSession) Set(field string, value any) error {
-	val, err := TryMarshal(value, b.IfSession.NeedSerial())
+func (b *BasicSession) Set(field string, value any) (err error) {
+	defer b.observe("set", time.Now(), &err)
+	val, err := b.encode(value)
 	if err != nil {
 		return err
 	} else if err := b.SilentSet(field, val); err != nil {
 		return err
 	}
+	b.emit(Event{Kind: EventFieldChanged, Field: field})
 	return b.TryTouch()
 }
 
-func (b *BasicSession) Get(field string, target any) error {
+func (b *BasicSession) Get(field string, target any) (err error) {
+	defer b.observe("get", time.Now(), &err)
 	val, err := b.SilentGet(field)
 	if err != nil {
 		return err
 	} else if err = b.TryTouch(); err != nil {
 		return err
 	}
-	return TryUnmarshal(val, target, b.IfSession.NeedSerial())
+	return b.decode(val, target)
 }
 
 func TryMarshal(val any, needSerial bool) (any, error) {
@@ -165,6 +190,19 @@ func TryMarshal(val any, needSerial bool) (any, error) {
 	return json.Marshal(val)
 }
 
+// TryMarshalString converts the value into the string stored by the text stores, the serialized values are always
+// bytes or strings, and the others are marshaled as json.
+func TryMarshalString(val any) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	bts, err := json.Marshal(val)
+	return string(bts), err
+}
+
 func TryUnmarshal(val any, target any, needSerial bool) error {
 	if !needSerial {
 		rv := reflect.ValueOf(target)
@@ -182,24 +220,35 @@ func TryUnmarshal(val any, target any, needSerial bool) error {
 	return err
 }
 
-func (b *BasicSession) Del(field string) error {
-	err := b.SilentDel(field)
+func (b *BasicSession) Del(field string) (err error) {
+	defer b.observe("del", time.Now(), &err)
+	err = b.SilentDel(field)
 	if err != nil {
 		return err
 	}
+	b.emit(Event{Kind: EventFieldChanged, Field: field})
 	return b.TryTouch()
 }
 
 func (b *BasicSession) TryTouch() error {
 	if !b.touches {
-		if err := b.Touch(); err != nil {
+		if err := b.touch(); err != nil {
 			return err
 		}
 		b.touches = true
+		if b.newborn && !b.created {
+			b.created = true
+			b.emit(Event{Kind: EventCreated})
+		}
 	}
 	return nil
 }
 
+func (b *BasicSession) touch() (err error) {
+	defer b.observe("touch", time.Now(), &err)
+	return b.Touch()
+}
+
 func (b *BasicSession) ReMeta(sid string) error {
 	b.touches = false
 	if len(sid) > 0 {
@@ -218,7 +267,18 @@ func (b *BasicSession) ReMeta(sid string) error {
 	return nil
 }
 
-func (b *BasicSession) Renew(filters map[string]any) error {
+// Copier could be implemented by the stores to copy the session data into a new sid atomically on renewal, the nil
+// filter values mean deleting the fields, and the others are the serialized values to set. The new session should be
+// touched after copied.
+type Copier interface {
+	CopyTo(sid string, filters map[string]any) error
+}
+
+func (b *BasicSession) Renew(filters map[string]any) (err error) {
+	defer b.observe("renew", time.Now(), &err)
+	if copier, ok := b.IfSession.(Copier); ok {
+		return b.renewByCopier(copier, filters)
+	}
 	raw, err := b.Raw()
 	if err != nil {
 		return err
@@ -227,14 +287,17 @@ func (b *BasicSession) Renew(filters map[string]any) error {
 		if v == nil {
 			delete(raw, k)
 		} else {
-			if val, err := TryMarshal(v, b.IfSession.NeedSerial()); err == nil {
+			if val, err := b.encode(v); err == nil {
 				raw[k] = val
 			}
 		}
 	}
+	oldSid := b.Id()
 	if err = b.ReMeta(""); err != nil {
 		return err
-	} else if len(raw) == 0 {
+	}
+	b.emit(Event{Kind: EventRenewed, OldSid: oldSid})
+	if len(raw) == 0 {
 		return nil
 	} else if err = b.Load(raw); err != nil {
 		return err
@@ -242,6 +305,31 @@ func (b *BasicSession) Renew(filters map[string]any) error {
 	return b.TryTouch()
 }
 
+func (b *BasicSession) renewByCopier(copier Copier, filters map[string]any) error {
+	encoded := make(map[string]any, len(filters))
+	for k, v := range filters {
+		if v == nil {
+			encoded[k] = nil
+		} else if val, err := b.encode(v); err == nil {
+			encoded[k] = val
+		}
+	}
+	sid, _, err := generateSid(b.ttlMinutes, &b.sidPool)
+	if err != nil {
+		return err
+	} else if err = copier.CopyTo(sid, encoded); err != nil {
+		return err
+	}
+	oldSid := b.Id()
+	if err = b.ReMeta(sid); err != nil {
+		return err
+	}
+	// the copier has touched the new session
+	b.touches = true
+	b.emit(Event{Kind: EventRenewed, OldSid: oldSid})
+	return nil
+}
+
 func (b *BasicSession) ListBySids(sids []string) ([]any, error) {
 	var sessions []any
 	for _, sid := range sids {
@@ -316,3 +404,22 @@ type IfSession interface {
 	// ListBySids retrieves a list of sessions based on the provided session IDs.
 	ListBySids(sids []string) ([]any, error)
 }
+
+// StartSweeper calls the sweep function periodically in background until the stop function called, it is used by the
+// stores which keep the expired sessions until swept.
+func StartSweeper(interval time.Duration, sweep func()) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				sweep()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,405 @@
+// Package sessiontest provides a conformance suite for the session stores, any store implements both the IfSession
+// and IfUserSession could run it to verify it behaves the same as the built-in stores.
+//
+//	func TestConformance(t *testing.T) {
+//		sessiontest.Run(t, sessiontest.Harness{
+//			New: func(sidPool []string, ttlMinutes uint16) (sessiontest.Session, error) {
+//				return mystore.NewSession[*session.SimpleUser](client, sidPool, ttlMinutes)
+//			},
+//		})
+//	}
+package sessiontest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+)
+
+// Session is the session under test, the user type is fixed as the SimpleUser.
+type Session interface {
+	session.IfSession
+	session.IfUserSession[*session.SimpleUser]
+}
+
+// Harness describes how to run the suite against a store.
+//
+// Fields:
+//   - New: Creates a session with the sid pool and ttl minutes, the same as the store constructors.
+//   - Advance: Moves the store clock forward to expire the sessions, the expiry cases will be skipped if nil.
+type Harness struct {
+	New     func(sidPool []string, ttlMinutes uint16) (Session, error)
+	Advance func(d time.Duration)
+}
+
+// the uids are unique per case, so that the cases would not affect each other even if the store is shared
+var uidSeq = atomic.Uint64{}
+
+func init() {
+	uidSeq.Store(uint64(time.Now().UnixNano()) & 0xffffffffff)
+}
+
+func nextUser(nick string) *session.SimpleUser {
+	return &session.SimpleUser{Id: uidSeq.Add(1), Nick: nick}
+}
+
+// Run runs all the conformance cases as subtests.
+func Run(t *testing.T, h Harness) {
+	t.Run("Fields", h.testFields)
+	t.Run("Login", h.testLogin)
+	t.Run("Logout", h.testLogout)
+	t.Run("Renew", h.testRenew)
+	t.Run("Clone", h.testClone)
+	t.Run("AutoRenew", h.testAutoRenew)
+	t.Run("Sync", h.testSync)
+	t.Run("Mapping", h.testMapping)
+	t.Run("LoginPolicy", h.testLoginPolicy)
+	t.Run("LogoutAll", h.testLogoutAll)
+	t.Run("Expiry", h.testExpiry)
+}
+
+func (h Harness) create(t *testing.T) Session {
+	t.Helper()
+	s, err := h.New(nil, session.DefaultTtlMinutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (h Harness) restore(t *testing.T, sid string) Session {
+	t.Helper()
+	s, err := h.New([]string{sid}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (h Harness) login(t *testing.T, user *session.SimpleUser) Session {
+	t.Helper()
+	s := h.create(t)
+	if err := s.Login(user, 0); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (h Harness) testFields(t *testing.T) {
+	s := h.create(t)
+	if !s.Newborn() {
+		t.Fatal("created session should be newborn")
+	}
+	if err := s.SilentDel("missing"); err != nil {
+		t.Fatalf("deleting from a missing session should be a no-op, got %v", err)
+	}
+	if _, err := s.SilentGet("missing"); err == nil {
+		t.Fatal("getting a missing field should fail")
+	}
+	if err := s.Set("num", 1); err != nil {
+		t.Fatal(err)
+	}
+	restored := h.restore(t, s.Id())
+	if restored.Newborn() {
+		t.Fatal("restored session should not be newborn")
+	}
+	if num, err := session.GetAs[int](restored, "num"); err != nil || num != 1 {
+		t.Fatalf("field should be restored, got %d %v", num, err)
+	}
+	if passed, err := restored.TtlPassed(); err != nil || passed > 1 {
+		t.Fatalf("session should be touched on set, got %d %v", passed, err)
+	}
+	if err := restored.Del("num"); err != nil {
+		t.Fatal(err)
+	} else if _, err = s.SilentGet("num"); err == nil {
+		t.Fatal("deleted field should not be found")
+	}
+	if err := s.SilentDel("missing"); err != nil {
+		t.Fatalf("deleting a missing field should be a no-op, got %v", err)
+	}
+	if err := s.Destroy(); err != nil {
+		t.Fatalf("anonymous session should be destroyable, got %v", err)
+	}
+}
+
+func (h Harness) testLogin(t *testing.T) {
+	s := h.create(t)
+	_ = s.Set("carried", "yes")
+	anonymousSid := s.Id()
+	user := nextUser("Drunk")
+	if err := s.Login(user, 0); err != nil {
+		t.Fatal(err)
+	} else if s.Id() == anonymousSid {
+		t.Fatal("sid should be regenerated on login")
+	}
+	if u, ok := s.User(); !ok || u.Nick != "Drunk" {
+		t.Fatalf("user should be loaded after login, got %v", u)
+	}
+	if _, err := h.restore(t, anonymousSid).SilentGet("carried"); err == nil {
+		t.Fatal("the anonymous session should be destroyed after login")
+	}
+	restored := h.restore(t, s.Id())
+	if u, ok := restored.User(); !ok || u.Id != user.Id {
+		t.Fatalf("user should be restored by sid, got %v", u)
+	}
+	if carried, _ := session.GetAs[string](restored, "carried"); carried != "yes" {
+		t.Fatalf("fields should be carried to the logged in session, got %q", carried)
+	}
+	if sids, err := restored.Sids(user.Id); err != nil || !slices.Equal(sids, []string{s.Id()}) {
+		t.Fatalf("sid should be mapped to the uid, got %v %v", sids, err)
+	}
+}
+
+func (h Harness) testLogout(t *testing.T) {
+	user := nextUser("Drunk")
+	s := h.login(t, user)
+	if err := s.Logout(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := s.User(); ok {
+		t.Fatal("user should be unloaded after logout")
+	}
+	if _, ok := h.restore(t, s.Id()).User(); ok {
+		t.Fatal("user should be removed from the store after logout")
+	}
+	if sids, err := s.Sids(user.Id); err != nil || len(sids) != 0 {
+		t.Fatalf("sid should be unmapped after logout, got %v %v", sids, err)
+	}
+	if err := s.Logout(); err != nil {
+		t.Fatalf("logging out twice should be a no-op, got %v", err)
+	}
+}
+
+func (h Harness) testRenew(t *testing.T) {
+	user := nextUser("Drunk")
+	s := h.login(t, user)
+	_ = s.Set("keep", 1)
+	_ = s.Set("drop", 1)
+	oldSid := s.Id()
+	if err := s.Renew(map[string]any{"drop": nil, "add": 2}); err != nil {
+		t.Fatal(err)
+	} else if s.Id() == oldSid {
+		t.Fatal("sid should be regenerated on renew")
+	}
+	restored := h.restore(t, s.Id())
+	if keep, err := session.GetAs[int](restored, "keep"); err != nil || keep != 1 {
+		t.Fatalf("unfiltered fields should be kept, got %d %v", keep, err)
+	} else if add, err := session.GetAs[int](restored, "add"); err != nil || add != 2 {
+		t.Fatalf("filter values should be added, got %d %v", add, err)
+	} else if _, err = restored.SilentGet("drop"); err == nil {
+		t.Fatal("nil filter values should be removed")
+	}
+	if sids, _ := s.Sids(user.Id); !slices.Contains(sids, s.Id()) {
+		t.Fatalf("renewed sid should be mapped, got %v", sids)
+	}
+}
+
+func (h Harness) testClone(t *testing.T) {
+	s := h.create(t)
+	_ = s.Set("num", 1)
+	cl, err := s.Clone("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	same := cl.(Session)
+	if same.Id() != s.Id() {
+		t.Fatal("clone without id should keep the sid")
+	} else if num, _ := session.GetAs[int](same, "num"); num != 1 {
+		t.Fatalf("clone should share the data, got %d", num)
+	}
+	other := h.create(t)
+	_ = other.Set("num", 2)
+	if cl, err = s.Clone(other.Id()); err != nil {
+		t.Fatal(err)
+	} else if num, _ := session.GetAs[int](cl.(Session), "num"); num != 2 {
+		t.Fatalf("clone with id should load the other session, got %d", num)
+	}
+	if num, _ := session.GetAs[int](s, "num"); num != 1 {
+		t.Fatalf("cloning should not affect the origin, got %d", num)
+	}
+}
+
+// staleSid generates a plain sid created the age ago, so the sid signer should not be enabled while running the suite.
+func staleSid(age time.Duration) string {
+	bts := make([]byte, 32)
+	_, _ = rand.Read(bts)
+	return fmt.Sprintf("%s%04x%08x", hex.EncodeToString(bts), session.DefaultTtlMinutes, time.Now().Add(-age).Unix())
+}
+
+func (h Harness) testAutoRenew(t *testing.T) {
+	if renewed, err := session.NewAutoRenew(h.create(t)).TryRenew(); err != nil || !renewed {
+		t.Fatalf("newborn session should be treated as renewed, got %v %v", renewed, err)
+	}
+	fresh := h.restore(t, staleSid(0))
+	_ = fresh.Set("num", 1)
+	if renewed, err := session.NewAutoRenew(fresh).TryRenew(); err != nil || renewed {
+		t.Fatalf("fresh session should not be renewed, got %v %v", renewed, err)
+	}
+
+	oldSid := staleSid(time.Duration(session.DefaultRenewIntervalSeconds+10) * time.Second)
+	stale := h.restore(t, oldSid)
+	_ = stale.Set("num", 1)
+	if renewed, err := session.NewAutoRenew(stale).TryRenew(); err != nil || !renewed {
+		t.Fatalf("stale session should be renewed, got %v %v", renewed, err)
+	} else if stale.Id() == oldSid {
+		t.Fatal("sid should be regenerated on auto renew")
+	}
+	if num, _ := session.GetAs[int](h.restore(t, stale.Id()), "num"); num != 1 {
+		t.Fatalf("data should be carried to the renewed session, got %d", num)
+	}
+	// the concurrent requests with the old sid within the judgment interval should still work
+	concurrent := h.restore(t, oldSid)
+	if newSid, err := session.GetAs[string](concurrent, session.DefaultNewSidField); err == nil && newSid != stale.Id() {
+		t.Fatalf("old session should point to the renewed sid, got %s", newSid)
+	}
+	if renewed, err := session.NewAutoRenew(concurrent).TryRenew(); err != nil || renewed {
+		t.Fatalf("old session should be kept within the judgment interval, got %v %v", renewed, err)
+	}
+}
+
+func (h Harness) testSync(t *testing.T) {
+	user := nextUser("Drunk")
+	first, second := h.login(t, user), h.login(t, user)
+	user.Nick = "Sober"
+	if err := first.Sync(&user); err != nil {
+		t.Fatal(err)
+	}
+	for _, sid := range []string{first.Id(), second.Id()} {
+		if u, ok := h.restore(t, sid).User(); !ok || u.Nick != "Sober" {
+			t.Fatalf("user should be synced to all sessions, got %v", u)
+		}
+	}
+}
+
+func (h Harness) testMapping(t *testing.T) {
+	user := nextUser("Drunk")
+	first, second := h.login(t, user), h.login(t, user)
+	sids, err := first.Sids(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(sids)
+	expected := []string{first.Id(), second.Id()}
+	slices.Sort(expected)
+	if !slices.Equal(sids, expected) {
+		t.Fatalf("all sessions should be mapped, got %v", sids)
+	}
+	if list, err := first.ListByUid(user.Id); err != nil || len(list) != 2 {
+		t.Fatalf("sessions should be listed by uid, got %d %v", len(list), err)
+	}
+	if err = second.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := first.AllSid(user.Id); err != nil || slices.Contains(all, second.Id()) {
+		t.Fatalf("destroyed session should be unmapped, got %v %v", all, err)
+	}
+	if all, err := first.AllSid(nextUser("").Id); err != nil || len(all) != 0 {
+		t.Fatalf("unknown uid should have no sid, got %v %v", all, err)
+	}
+}
+
+func (h Harness) loginWith(t *testing.T, user *session.SimpleUser, policy session.LoginPolicy, device string) Session {
+	t.Helper()
+	s := h.create(t)
+	s.(interface{ SetLoginPolicy(session.LoginPolicy) }).SetLoginPolicy(policy)
+	if device != "" {
+		_ = s.(interface{ SetDevice(string) error }).SetDevice(device)
+	}
+	if err := s.Login(user, 0); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (h Harness) testLoginPolicy(t *testing.T) {
+	var evicted []string
+	cancel := session.Listen(func(e session.Event) {
+		evicted = append(evicted, e.Sid)
+	}, session.EventEvicted)
+	defer cancel()
+
+	user := nextUser("Drunk")
+	policy := session.LoginPolicy{MaxSessions: 2}
+	oldest := h.loginWith(t, user, policy, "")
+	middle := h.loginWith(t, user, policy, "")
+	newest := h.loginWith(t, user, policy, "")
+	if !slices.Equal(evicted, []string{oldest.Id()}) {
+		t.Fatalf("the oldest session should be evicted, got %v", evicted)
+	}
+	if sids, _ := newest.Sids(user.Id); len(sids) != 2 || !slices.Contains(sids, middle.Id()) || !slices.Contains(sids, newest.Id()) {
+		t.Fatalf("the newest sessions should be kept, got %v", sids)
+	}
+	if _, ok := h.restore(t, oldest.Id()).User(); ok {
+		t.Fatal("evicted session should be destroyed")
+	}
+
+	// the sessions logged in within the same second are evicted by the login order
+	evicted = nil
+	user = nextUser("Drunk")
+	sessions := make([]Session, 4)
+	for i := range sessions {
+		sessions[i] = h.loginWith(t, user, policy, "")
+	}
+	if !slices.Equal(evicted, []string{sessions[0].Id(), sessions[1].Id()}) {
+		t.Fatalf("the earlier logged in sessions should be evicted, got %v", evicted)
+	}
+
+	evicted = nil
+	user = nextUser("Drunk")
+	policy = session.LoginPolicy{SingleDevice: true}
+	web := h.loginWith(t, user, policy, "web")
+	mobile := h.loginWith(t, user, policy, "mobile")
+	anotherWeb := h.loginWith(t, user, policy, "web")
+	if !slices.Equal(evicted, []string{web.Id()}) {
+		t.Fatalf("the session of the same device should be evicted, got %v", evicted)
+	}
+	if sids, _ := anotherWeb.Sids(user.Id); len(sids) != 2 || !slices.Contains(sids, mobile.Id()) {
+		t.Fatalf("the sessions of other devices should be kept, got %v", sids)
+	}
+}
+
+func (h Harness) testLogoutAll(t *testing.T) {
+	user := nextUser("Drunk")
+	first, second := h.login(t, user), h.login(t, user)
+	la, ok := second.(session.LogoutAller)
+	if !ok {
+		t.Skip("the store does not implement the LogoutAller")
+	}
+	if err := la.LogoutAll(); err != nil {
+		t.Fatal(err)
+	}
+	if sids, err := second.Sids(user.Id); err != nil || len(sids) != 0 {
+		t.Fatalf("all sessions should be logged out, got %v %v", sids, err)
+	}
+	if _, ok := h.restore(t, first.Id()).User(); ok {
+		t.Fatal("other sessions should be evicted")
+	} else if _, ok = second.User(); ok {
+		t.Fatal("current session should be logged out")
+	}
+}
+
+func (h Harness) testExpiry(t *testing.T) {
+	if h.Advance == nil {
+		t.Skip("the store clock could not be advanced")
+	}
+	user := nextUser("Drunk")
+	s, err := h.New(nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if err = s.Login(user, 0); err != nil {
+		t.Fatal(err)
+	}
+	h.Advance(2 * time.Minute)
+	restored := h.restore(t, s.Id())
+	if _, ok := restored.User(); ok {
+		t.Fatal("expired session should not be loaded")
+	}
+	if sids, err := restored.Sids(user.Id); err != nil || len(sids) != 0 {
+		t.Fatalf("expired session should be filtered from the mapping, got %v %v", sids, err)
+	}
+}
@@ -1,11 +1,13 @@
 package session
 
 import (
+	"container/list"
 	"fmt"
-	"math/rand/v2"
+	"maps"
 	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.drunkce.com/dce/util"
@@ -14,22 +16,80 @@ import (
 // sessionMapping map[string]*shmMeta
 var sessionMapping = util.NewStruct[sync.Map]()
 
-// userMapping map[string][]string
+// userMapping map[string]*shmUserMeta
 var userMapping = util.NewStruct[sync.Map]()
 
+// userMappingMu serializes the read-modify-write of the user mappings, the reads are lock-free.
+var userMappingMu sync.Mutex
+
 func ShmDumpMapping() {
 	sessionMapping.Range(func(sid, meta any) bool {
-		fmt.Printf("%s\n%v\n", sid, meta)
+		fmt.Printf("%s\n%v\n", sid, meta.(*shmMeta).snapshot())
 		return true
 	})
-	userMapping.Range(func(uid, sids any) bool {
-		fmt.Printf("%s\n%v\n", uid, sids)
+	userMapping.Range(func(uid, meta any) bool {
+		fmt.Printf("%s\n%v\n", uid, meta.(*shmUserMeta).sids)
 		return true
 	})
 }
 
+// shmNow returns the current unix seconds, it could be replaced in tests to simulate the expiry.
+var shmNow = func() int64 {
+	return time.Now().Unix()
+}
+
+// shmMeta holds the data of a shm session, the data is guarded by the per-session lock, so that the concurrent
+// requests of the same sid are safe. The stored values are shared between the requests without copying, they should
+// be replaced instead of modified in place.
 type shmMeta struct {
+	sid         string
+	mu          sync.RWMutex
 	data        map[string]any
+	expireStamp atomic.Int64
+	// userKey is the key of the user mapping which the session mapped to, it is used to unmap on expiry
+	userKey   atomic.Value
+	heapIndex int
+	lru       *list.Element
+}
+
+func (m *shmMeta) get(field string) (any, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.data[field]
+	return v, ok
+}
+
+func (m *shmMeta) set(field string, value any) {
+	m.mu.Lock()
+	m.data[field] = value
+	m.mu.Unlock()
+}
+
+func (m *shmMeta) del(field string) {
+	m.mu.Lock()
+	delete(m.data, field)
+	m.mu.Unlock()
+}
+
+func (m *shmMeta) load(data map[string]any) {
+	data = maps.Clone(data)
+	if data == nil {
+		data = make(map[string]any)
+	}
+	m.mu.Lock()
+	m.data = data
+	m.mu.Unlock()
+}
+
+func (m *shmMeta) snapshot() map[string]any {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return maps.Clone(m.data)
+}
+
+// shmUserMeta is an immutable user mapping, it will be replaced as a whole on update.
+type shmUserMeta struct {
+	sids        []string
 	expireStamp int64
 }
 
@@ -57,28 +117,60 @@ func NewShmSession[U UidGetter](sidPool []string, ttlMinutes uint16) (*ShmSessio
 
 func (s *ShmSession[U]) meta(autoGen bool) (*shmMeta, error) {
 	if m, ok := sessionMapping.Load(s.Key()); ok {
-		return m.(*shmMeta), nil
-	} else if autoGen {
-		sessionMapping.Store(s.Key(), &shmMeta{data: make(map[string]any)})
-		return s.meta(autoGen)
+		meta := m.(*shmMeta)
+		if expired(meta) {
+			if shmStore.remove(meta) {
+				// the expired session may not be swept yet, treat it as missing
+				shmStore.expired.Add(1)
+				shmClear([]*shmMeta{meta}, EventExpired)
+			}
+		} else if shmStore.access(meta) {
+			return meta, nil
+		}
+		// or else it was evicted or destroyed, but not cleared from the mapping yet
+	}
+	if autoGen {
+		meta, stale, evicted := shmStore.create(s.Key())
+		shmClear(stale, EventExpired)
+		shmClear(evicted, EventEvicted)
+		return meta, nil
 	}
 	return nil, util.Closed0(`Sid "%s" could not be found id mapping`, s.Key())
 }
 
+// shmClear deletes the expired or evicted sessions, unmaps them from the users and emits the events.
+func shmClear(metas []*shmMeta, kind EventKind) int {
+	for _, m := range metas {
+		sessionMapping.CompareAndDelete(m.sid, m)
+		if userKey, ok := m.userKey.Load().(string); ok && userKey != "" {
+			shmUnmapSid(userKey, m.sid)
+		}
+		if hasListener() {
+			event := Event{Kind: kind, Sid: m.sid}
+			if kind == EventEvicted {
+				client, _ := m.get(DefaultClientField)
+				event.Client, _ = client.(string)
+			}
+			Emit(event)
+		}
+	}
+	return len(metas)
+}
+
 func (s *ShmSession[U]) NeedSerial() bool {
 	return false
 }
 
 func (s *ShmSession[U]) SilentSet(field string, value any) error {
 	meta, _ := s.meta(true)
-	meta.data[field] = value
+	meta.set(field, value)
 	return nil
 }
 
 func (s *ShmSession[U]) SilentGet(field string) (any, error) {
 	if meta, err := s.meta(false); err != nil {
 		return nil, err
-	} else if v, ok := meta.data[field]; ok {
+	} else if v, ok := meta.get(field); ok {
 		return v, nil
 	}
 	return nil, util.Silent("No session value with key \"%s\"", field)
@@ -86,13 +178,22 @@ func (s *ShmSession[U]) SilentGet(field string) (any, error) {
 
 func (s *ShmSession[U]) SilentDel(field string) error {
 	if meta, err := s.meta(false); err == nil {
-		delete(meta.data, field)
+		meta.del(field)
 	}
 	return nil
 }
 
 func (s *ShmSession[U]) Destroy() error {
-	sessionMapping.Delete(s.Key())
+	// the anonymous sessions have no user mapping
+	if _, ok := s.User(); ok {
+		if err := s.Unmapping(); err != nil {
+			return err
+		}
+	}
+	if m, ok := sessionMapping.LoadAndDelete(s.Key()); ok {
+		shmStore.remove(m.(*shmMeta))
+	}
+	s.EmitDestroyed()
 	return nil
 }
 
@@ -101,20 +202,20 @@ func (s *ShmSession[U]) Touch() error {
 	if err != nil {
 		return err
 	}
-	meta.expireStamp = time.Now().Unix() + int64(s.TtlSeconds())
-	s.tryClear()
+	shmStore.expireAt(meta, shmNow()+int64(s.TtlSeconds()))
+	shmClear(shmStore.popExpired(shmNow(), shmSweepBatch), EventExpired)
 	return nil
 }
 
 func (s *ShmSession[U]) Load(data map[string]any) error {
 	meta, _ := s.meta(true)
-	meta.data = data
+	meta.load(data)
 	return nil
 }
 
 func (s *ShmSession[U]) Raw() (map[string]any, error) {
 	if meta, err := s.meta(false); err == nil {
-		return meta.data, nil
+		return meta.snapshot(), nil
 	}
 	return make(map[string]any), nil
 }
@@ -123,10 +224,10 @@ func (s *ShmSession[U]) TtlPassed() (uint32, error) {
 	meta, err := s.meta(false)
 	if err != nil {
 		return 0, err
-	} else if meta.expireStamp < 1 {
+	} else if meta.expireStamp.Load() < 1 {
 		return 0, util.Closed0("ttl was not initialized yet.")
 	}
-	return uint32(time.Now().Unix() - meta.expireStamp + int64(s.TtlSeconds())), nil
+	return uint32(shmNow() - meta.expireStamp.Load() + int64(s.TtlSeconds())), nil
 }
 
 func (s *ShmSession[U]) Renew(filters map[string]any) error {
@@ -150,36 +251,34 @@ func (s *ShmSession[U]) Clone(id string) (any, error) {
 	return cl, nil
 }
 
-var mu sync.Mutex
-
-func (s *ShmSession[U]) tryClear() {
-	if !mu.TryLock() || rand.UintN(10) > 2 {
-		return
-	}
-	go func() {
-		defer mu.Unlock()
-		now := time.Now().Unix()
-		sessionMapping.Range(func(sid, meta any) bool {
-			m := meta.(*shmMeta)
-			if m.expireStamp > 0 && m.expireStamp <= now {
-				sessionMapping.Delete(sid)
-			}
-			return true
-		})
-	}()
+func expired(m *shmMeta) bool {
+	stamp := m.expireStamp.Load()
+	return stamp > 0 && stamp <= shmNow()
 }
 
 func shmGenUserKey(id uint64) string {
 	return strconv.FormatUint(id, 10)
 }
 
+// loadUserMeta loads the user mapping, the expired mapping will be deleted.
+func loadUserMeta(userKey string) (*shmUserMeta, bool) {
+	if v, ok := userMapping.Load(userKey); ok {
+		if meta := v.(*shmUserMeta); meta.expireStamp > shmNow() {
+			return meta, true
+		}
+		userMapping.CompareAndDelete(userKey, v)
+	}
+	return nil, false
+}
+
 func (s *ShmSession[U]) filterSids(userKey string) []string {
 	sids := make([]string, 0, 1)
-	if v, ok := userMapping.LoadOrStore(userKey, make([]string, 1)); ok {
-		sids = v.([]string)
+	if meta, ok := loadUserMeta(userKey); ok {
+		// clone to prevent modifying the stored slice in place
+		sids = slices.Clone(meta.sids)
 		for i := len(sids) - 1; i >= 0; i-- {
-			// If the session to witch the sid belongs does not exist, remove it
-			if _, ok = sessionMapping.Load(sids[i]); !ok {
+			// If the session to witch the sid belongs does not exist or expired, remove it
+			if m, ok := sessionMapping.Load(sids[i]); !ok || expired(m.(*shmMeta)) {
 				sids = slices.Delete(sids, i, i+1)
 			}
 		}
@@ -187,13 +286,38 @@ func (s *ShmSession[U]) filterSids(userKey string) []string {
 	return sids
 }
 
+func storeUserSids(userKey string, sids []string) {
+	if len(sids) == 0 {
+		userMapping.Delete(userKey)
+		return
+	}
+	userMapping.Store(userKey, &shmUserMeta{sids: sids, expireStamp: shmNow() + MappingTtlSeconds})
+}
+
+func shmUnmapSid(userKey string, sid string) {
+	userMappingMu.Lock()
+	defer userMappingMu.Unlock()
+	if meta, ok := loadUserMeta(userKey); ok {
+		if index := slices.Index(meta.sids, sid); index > -1 {
+			storeUserSids(userKey, slices.Delete(slices.Clone(meta.sids), index, index+1))
+		}
+	}
+}
+
 func (s *ShmSession[U]) Mapping() error {
 	userKey, err := s.UserKey()
 	if err != nil {
 		return err
 	}
-	sids := append(s.filterSids(userKey), s.Id())
-	userMapping.Store(userKey, sids)
+	meta, _ := s.meta(true)
+	meta.userKey.Store(userKey)
+	userMappingMu.Lock()
+	defer userMappingMu.Unlock()
+	if sids := s.filterSids(userKey); !slices.Contains(sids, s.Id()) {
+		storeUserSids(userKey, append(sids, s.Id()))
+	} else {
+		storeUserSids(userKey, sids)
+	}
 	return nil
 }
 
@@ -202,15 +326,16 @@ func (s *ShmSession[U]) Unmapping() error {
 	if err != nil {
 		return err
 	}
+	if meta, err := s.meta(false); err == nil {
+		meta.userKey.Store("")
+	}
+	userMappingMu.Lock()
+	defer userMappingMu.Unlock()
 	sids := s.filterSids(userKey)
 	if index := slices.Index(sids, s.Id()); index > -1 {
 		sids = slices.Delete(sids, index, index+1)
-		if len(sids) == 0 {
-			userMapping.Delete(userKey)
-			return nil
-		}
 	}
-	userMapping.Store(userKey, sids)
+	storeUserSids(userKey, sids)
 	return nil
 }
 
@@ -220,20 +345,18 @@ func (s *ShmSession[U]) Sync(user *U) error {
 		return err
 	}
 	for _, sid := range sids {
-		if meta, ok := sessionMapping.Load(sid); ok {
-			m := meta.(*shmMeta)
-			m.data[s.UserField] = user
+		if meta, ok := sessionMapping.Load(sid); ok && !expired(meta.(*shmMeta)) {
+			meta.(*shmMeta).set(s.UserField, *user)
 		}
 	}
 	return nil
 }
 
 func (s *ShmSession[U]) AllSid(uid uint64) ([]string, error) {
-	userKey := shmGenUserKey(uid)
-	if v, ok := userMapping.Load(userKey); ok {
-		return v.([]string), nil
+	if meta, ok := loadUserMeta(shmGenUserKey(uid)); ok {
+		return meta.sids, nil
 	}
-	return nil, util.Silent("No mapping with key \"%s\"", userKey)
+	return nil, nil
 }
 
 func (s *ShmSession[U]) FilterSids(uid uint64, sids []string) ([]string, error) {
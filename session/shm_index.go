@@ -0,0 +1,202 @@
+package session
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shmIndex indexes the shm sessions by the expire stamp via a min-heap, and by the access order via a LRU list, so
+// that the expired sessions could be swept without ranging over all the sessions, and the least recently used ones
+// could be evicted when the capacity exceeded.
+type shmIndex struct {
+	mu       sync.Mutex
+	expiry   shmHeap
+	lru      *list.List
+	capacity int
+	expired  atomic.Uint64
+	evicted  atomic.Uint64
+}
+
+var shmStore = &shmIndex{lru: list.New()}
+
+type shmHeap []*shmMeta
+
+func (h shmHeap) Len() int {
+	return len(h)
+}
+
+func (h shmHeap) Less(i, j int) bool {
+	return h[i].expireStamp.Load() < h[j].expireStamp.Load()
+}
+
+func (h shmHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex, h[j].heapIndex = i, j
+}
+
+func (h *shmHeap) Push(x any) {
+	m := x.(*shmMeta)
+	m.heapIndex = len(*h)
+	*h = append(*h, m)
+}
+
+func (h *shmHeap) Pop() any {
+	old := *h
+	m := old[len(old)-1]
+	old[len(old)-1] = nil
+	m.heapIndex = -1
+	*h = old[:len(old)-1]
+	return m
+}
+
+// create stores and indexes a new session of the sid, or returns the live one stored by a concurrent request. The
+// stored one will be replaced if it was expired or already removed from the index but not cleared from the mapping
+// yet, the expired ones should be cleared by the caller, along with the least recently used sessions evicted by the
+// capacity. The mapping is updated under the index lock, so that a stored live session is always indexed.
+func (x *shmIndex) create(sid string) (meta *shmMeta, stale []*shmMeta, evicted []*shmMeta) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	meta = &shmMeta{sid: sid, data: make(map[string]any)}
+	for {
+		m, loaded := sessionMapping.LoadOrStore(sid, meta)
+		if !loaded {
+			break
+		}
+		existing := m.(*shmMeta)
+		if existing.lru != nil && !expired(existing) {
+			x.lru.MoveToFront(existing.lru)
+			return existing, nil, nil
+		} else if x.removeLocked(existing) {
+			x.expired.Add(1)
+			stale = append(stale, existing)
+		}
+		// the removed one will be cleared by its remover, the comparison prevents deleting the replacement
+		if sessionMapping.CompareAndSwap(sid, existing, meta) {
+			break
+		}
+	}
+	return meta, stale, x.addLocked(meta)
+}
+
+// addLocked indexes a new session, and returns the least recently used sessions evicted by the capacity, the caller
+// should hold the lock.
+func (x *shmIndex) addLocked(m *shmMeta) []*shmMeta {
+	m.heapIndex = -1
+	m.lru = x.lru.PushFront(m)
+	var evicted []*shmMeta
+	for x.capacity > 0 && x.lru.Len() > x.capacity {
+		oldest := x.lru.Back().Value.(*shmMeta)
+		x.removeLocked(oldest)
+		evicted = append(evicted, oldest)
+	}
+	x.evicted.Add(uint64(len(evicted)))
+	return evicted
+}
+
+// access marks the session as the most recently used, it returns false if the session was already removed.
+func (x *shmIndex) access(m *shmMeta) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if m.lru == nil {
+		return false
+	}
+	x.lru.MoveToFront(m.lru)
+	return true
+}
+
+func (x *shmIndex) expireAt(m *shmMeta, stamp int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	m.expireStamp.Store(stamp)
+	if m.lru == nil {
+		// already removed
+		return
+	} else if m.heapIndex < 0 {
+		heap.Push(&x.expiry, m)
+	} else {
+		heap.Fix(&x.expiry, m.heapIndex)
+	}
+}
+
+func (x *shmIndex) remove(m *shmMeta) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.removeLocked(m)
+}
+
+func (x *shmIndex) removeLocked(m *shmMeta) bool {
+	if m.lru == nil {
+		return false
+	}
+	x.lru.Remove(m.lru)
+	m.lru = nil
+	if m.heapIndex >= 0 {
+		heap.Remove(&x.expiry, m.heapIndex)
+	}
+	return true
+}
+
+// popExpired removes and returns the expired sessions, at most limit ones if the limit is positive.
+func (x *shmIndex) popExpired(now int64, limit int) []*shmMeta {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var expired []*shmMeta
+	for len(x.expiry) > 0 && x.expiry[0].expireStamp.Load() <= now && (limit < 1 || len(expired) < limit) {
+		m := x.expiry[0]
+		x.removeLocked(m)
+		expired = append(expired, m)
+	}
+	x.expired.Add(uint64(len(expired)))
+	return expired
+}
+
+// shmSweepBatch is the maximum number of the expired sessions swept on each touch.
+const shmSweepBatch = 64
+
+// SetShmCapacity limits the number of the shm sessions, the least recently used sessions will be evicted when exceeded,
+// 0 means unlimited.
+func SetShmCapacity(capacity int) {
+	shmStore.mu.Lock()
+	shmStore.capacity = capacity
+	shmStore.mu.Unlock()
+}
+
+// ShmSweep clears all the expired shm sessions and returns the count, it is also called incrementally on each touch,
+// so it is only necessary to call it periodically for the idle servers.
+func ShmSweep() int {
+	return shmClear(shmStore.popExpired(shmNow(), 0), EventExpired)
+}
+
+// StartShmSweeper sweeps the expired shm sessions periodically in background until the stop function called.
+func StartShmSweeper(interval time.Duration) (stop func()) {
+	return StartSweeper(interval, func() { ShmSweep() })
+}
+
+// ShmMetrics is the statistics of the shm sessions.
+//
+// Fields:
+//   - Live: The number of the sessions in memory, including the expired ones not swept yet.
+//   - Users: The number of the users have mapped sessions.
+//   - Expired: The total number of the swept expired sessions.
+//   - Evicted: The total number of the sessions evicted by the capacity.
+type ShmMetrics struct {
+	Live    int
+	Users   int
+	Expired uint64
+	Evicted uint64
+}
+
+func ShmStats() ShmMetrics {
+	shmStore.mu.Lock()
+	live := shmStore.lru.Len()
+	shmStore.mu.Unlock()
+	users := 0
+	userMapping.Range(func(_, _ any) bool {
+		users++
+		return true
+	})
+	return ShmMetrics{Live: live, Users: users, Expired: shmStore.expired.Load(), Evicted: shmStore.evicted.Load()}
+}
@@ -0,0 +1,71 @@
+package session_test
+
+import (
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+)
+
+func TestShmExpiryAndCapacity(t *testing.T) {
+	before := session.ShmStats()
+	session.SetShmCapacity(3)
+	defer session.SetShmCapacity(0)
+	var sessions []*session.ShmSession[*session.SimpleUser]
+	for i := 0; i < 3; i++ {
+		s, _ := session.NewShmSession[*session.SimpleUser](nil, 1)
+		_ = s.Set("i", i)
+		sessions = append(sessions, s)
+	}
+	// access the first one, so that the second one become the least recently used
+	_, _ = sessions[0].SilentGet("i")
+	s, _ := session.NewShmSession[*session.SimpleUser](nil, 1)
+	_ = s.Set("i", 3)
+	if _, err := sessions[1].SilentGet("i"); err == nil {
+		t.Fatal("the least recently used session should be evicted")
+	} else if _, err = sessions[0].SilentGet("i"); err != nil {
+		t.Fatal("the recently used session should be kept")
+	}
+	stats := session.ShmStats()
+	if stats.Evicted-before.Evicted < 1 || stats.Live != 3 {
+		t.Fatalf("unexpected stats %+v, before %+v", stats, before)
+	}
+
+	session.SetShmCapacity(0)
+	user := &session.SimpleUser{Id: uint64(time.Now().UnixNano()), Nick: "Drunk"}
+	_ = s.Login(user, 0)
+	session.ShmAdvance(t, 2*time.Minute)
+	if swept := session.ShmSweep(); swept < 2 {
+		t.Fatalf("the expired sessions should be swept, got %d", swept)
+	}
+	if sids, _ := s.AllSid(user.Id); len(sids) != 0 {
+		t.Fatalf("the user mapping of the expired session should be released, got %v", sids)
+	}
+	if stats = session.ShmStats(); stats.Expired-before.Expired < 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestShmReplaceUnindexed(t *testing.T) {
+	for _, expired := range []bool{true, false} {
+		s, _ := session.NewShmSession[*session.SimpleUser](nil, 1)
+		session.ShmStoreUnindexed(s.Id(), map[string]any{"stale": 1}, expired)
+		before := session.ShmStats()
+		if err := s.Set("fresh", 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.SilentGet("stale"); err == nil {
+			t.Fatalf("the unindexed session should be replaced, expired: %t", expired)
+		} else if _, err = s.SilentGet("fresh"); err != nil {
+			t.Fatalf("the replacement should be stored, expired: %t", expired)
+		} else if stats := session.ShmStats(); stats.Live != before.Live+1 {
+			t.Fatalf("the replacement should be indexed, expired: %t, got %+v, before %+v", expired, stats, before)
+		}
+		session.ShmAdvance(t, 2*time.Minute)
+		if swept := session.ShmSweep(); swept < 1 {
+			t.Fatalf("the replacement should be swept on expiry, expired: %t", expired)
+		} else if _, err := s.SilentGet("fresh"); err == nil {
+			t.Fatalf("the replacement should be expired, expired: %t", expired)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package session_test
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+)
+
+// run with `go test -race` to verify the concurrent accesses
+func TestShmConcurrentSameSid(t *testing.T) {
+	origin, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+	_ = origin.Set("init", 0)
+	user := &session.SimpleUser{Id: uint64(time.Now().UnixNano()), Nick: "Drunk"}
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each request restores its own session object with the same sid
+			s, err := session.NewShmSession[*session.SimpleUser]([]string{origin.Id()}, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			field := fmt.Sprintf("f%d", i)
+			for j := 0; j < 50; j++ {
+				_ = s.Set(field, j)
+				_, _ = s.SilentGet("init")
+				_, _ = s.Raw()
+				if j%10 == 0 {
+					_ = s.Del(field)
+					_ = s.Sync(&user)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	raw, _ := origin.Raw()
+	for i := 0; i < 32; i++ {
+		if v := raw[fmt.Sprintf("f%d", i)]; v != 49 {
+			t.Fatalf("field f%d should be 49, got %v", i, v)
+		}
+	}
+}
+
+func TestShmConcurrentMapping(t *testing.T) {
+	user := &session.SimpleUser{Id: uint64(time.Now().UnixNano()), Nick: "Drunk"}
+	sids := make(chan string, 32)
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+			if err := s.Login(user, 0); err != nil {
+				t.Error(err)
+				return
+			}
+			sids <- s.Id()
+		}()
+	}
+	wg.Wait()
+	close(sids)
+	s, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+	mapped, _ := s.Sids(user.Id)
+	for sid := range sids {
+		if !slices.Contains(mapped, sid) {
+			t.Fatalf("sid %s lost in the concurrent mapping", sid)
+		}
+	}
+	if len(mapped) != 32 {
+		t.Fatalf("expected 32 mapped sids, got %d", len(mapped))
+	}
+}
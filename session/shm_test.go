@@ -0,0 +1,20 @@
+package session_test
+
+import (
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/session/sessiontest"
+)
+
+func TestShmConformance(t *testing.T) {
+	sessiontest.Run(t, sessiontest.Harness{
+		New: func(sidPool []string, ttlMinutes uint16) (sessiontest.Session, error) {
+			return session.NewShmSession[*session.SimpleUser](sidPool, ttlMinutes)
+		},
+		Advance: func(d time.Duration) {
+			session.ShmAdvance(t, d)
+		},
+	})
+}
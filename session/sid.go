@@ -0,0 +1,149 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+
+	"go.drunkce.com/dce/util"
+)
+
+const (
+	// SidVersionPlain is the legacy unsigned sid format: 64 hex chars random hash + 4 hex chars ttl + hex create stamp.
+	SidVersionPlain uint8 = iota + 1
+	// SidVersionSigned appends 2 hex chars key id and 32 hex chars truncated HMAC-SHA256 of the plain part.
+	SidVersionSigned
+)
+
+const (
+	sidPlainLen     = MinSidLen
+	sidKeyIdLen     = 2
+	sidSignatureLen = 32
+	SignedSidLen    = sidPlainLen + sidKeyIdLen + sidSignatureLen
+)
+
+// SidSigner signs the generated sids with HMAC-SHA256 and verifies the received sids in constant time, so that the
+// ttl and create stamp parts of a sid could not be tampered by the client. It supports key rotation with multiple
+// verification keys and one signing key.
+//
+// To migrate from the unsigned sids smoothly, it could be configured to keep generating the plain sids while
+// accepting both formats, then switch to generate the signed sids, and finally reject the unsigned ones:
+//
+//	signer := session.NewSidSigner(1, key).GenVersion(session.SidVersionPlain).AcceptPlain(true)
+//	session.SetSidSigner(signer)                  // step 1, deploy to all nodes
+//	signer.GenVersion(session.SidVersionSigned)   // step 2, start issuing the signed sids
+//	signer.AcceptPlain(false)                     // step 3, after the plain sids expired
+type SidSigner struct {
+	signKeyId   uint8
+	keys        map[uint8][]byte
+	genVersion  uint8
+	acceptPlain bool
+	mu          sync.RWMutex
+}
+
+func NewSidSigner(signKeyId uint8, signKey []byte) *SidSigner {
+	return &SidSigner{
+		signKeyId:  signKeyId,
+		keys:       map[uint8][]byte{signKeyId: signKey},
+		genVersion: SidVersionSigned,
+	}
+}
+
+// AddVerifyKey adds a key to verify the sids signed by it, such as the retired signing key during rotation.
+func (s *SidSigner) AddVerifyKey(keyId uint8, key []byte) *SidSigner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[keyId] = key
+	return s
+}
+
+// RemoveVerifyKey removes a verification key, the sids signed by it will be rejected, the signing key cannot be removed.
+func (s *SidSigner) RemoveVerifyKey(keyId uint8) *SidSigner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if keyId != s.signKeyId {
+		delete(s.keys, keyId)
+	}
+	return s
+}
+
+// Rotate switches the signing key, the previous signing key will be kept as a verification key.
+func (s *SidSigner) Rotate(signKeyId uint8, signKey []byte) *SidSigner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signKeyId = signKeyId
+	s.keys[signKeyId] = signKey
+	return s
+}
+
+// GenVersion specifies the format version of the generated sids.
+func (s *SidSigner) GenVersion(version uint8) *SidSigner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.genVersion = version
+	return s
+}
+
+// AcceptPlain specifies whether to accept the unsigned legacy sids.
+func (s *SidSigner) AcceptPlain(accept bool) *SidSigner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acceptPlain = accept
+	return s
+}
+
+func (s *SidSigner) sign(keyId uint8, key []byte, plain string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte{keyId})
+	mac.Write([]byte(plain))
+	return hex.EncodeToString(mac.Sum(nil))[:sidSignatureLen]
+}
+
+// Sign appends the key id and signature to a plain sid if the signed version configured.
+func (s *SidSigner) Sign(plain string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.genVersion != SidVersionSigned {
+		return plain
+	}
+	return plain + formatKeyId(s.signKeyId) + s.sign(s.signKeyId, s.keys[s.signKeyId], plain)
+}
+
+// Verify checks the signature of the sid and returns the plain part.
+func (s *SidSigner) Verify(sid string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(sid) != SignedSidLen {
+		if s.acceptPlain {
+			// the legacy sids will be validated by the parser
+			return sid, nil
+		}
+		return "", util.Closed0(`invalid sid "%s", should be a signed sid with %d chars`, sid, SignedSidLen)
+	}
+	plain := sid[:sidPlainLen]
+	keyId, err := strconv.ParseUint(sid[sidPlainLen:sidPlainLen+sidKeyIdLen], 16, 8)
+	if err != nil {
+		return "", err
+	}
+	key, ok := s.keys[uint8(keyId)]
+	if !ok {
+		return "", util.Closed0(`sid "%s" was signed by an unknown key`, sid)
+	}
+	if !hmac.Equal([]byte(sid[sidPlainLen+sidKeyIdLen:]), []byte(s.sign(uint8(keyId), key, plain))) {
+		return "", util.Closed0(`sid "%s" signature mismatched`, sid)
+	}
+	return plain, nil
+}
+
+func formatKeyId(keyId uint8) string {
+	return strconv.FormatUint(uint64(keyId)|0x100, 16)[1:]
+}
+
+var sidSigner *SidSigner
+
+// SetSidSigner enables the sid signing, pass nil to disable it.
+func SetSidSigner(signer *SidSigner) {
+	sidSigner = signer
+}
@@ -0,0 +1,43 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSidSigner(t *testing.T) {
+	defer SetSidSigner(nil)
+	plain, _ := GenSid(DefaultTtlMinutes)
+	signer := NewSidSigner(1, []byte("key-1")).AcceptPlain(true)
+	SetSidSigner(signer)
+	sid, stamp := GenSid(DefaultTtlMinutes)
+	if len(sid) != SignedSidLen {
+		t.Fatalf("signed sid length %d, expected %d", len(sid), SignedSidLen)
+	}
+	if ttl, parsedStamp, err := parseSid(sid); err != nil || ttl != DefaultTtlMinutes || parsedStamp != stamp {
+		t.Fatalf("parse signed sid failed: %v", err)
+	}
+	if _, _, err := parseSid(plain); err != nil {
+		t.Fatalf("plain sid should be accepted during migration: %v", err)
+	}
+	// tamper the ttl part
+	tampered := sid[:64] + "ffff" + sid[68:]
+	if _, _, err := parseSid(tampered); err == nil {
+		t.Fatal("tampered sid should be rejected")
+	}
+	// rotate the signing key, the previous sids should still be valid
+	signer.Rotate(2, []byte("key-2")).AcceptPlain(false)
+	if rotated, _ := GenSid(DefaultTtlMinutes); !strings.HasPrefix(rotated[MinSidLen:], "02") {
+		t.Fatalf("rotated sid should be signed by key 2: %s", rotated)
+	}
+	if _, err := NewBasicSession([]string{sid}, 0); err != nil {
+		t.Fatalf("sid signed by the retired key should be verified: %v", err)
+	}
+	if _, err := NewBasicSession([]string{plain}, 0); err == nil {
+		t.Fatal("plain sid should be rejected after migration")
+	}
+	signer.RemoveVerifyKey(1)
+	if _, err := NewBasicSession([]string{sid}, 0); err == nil {
+		t.Fatal("sid signed by the removed key should be rejected")
+	}
+}
@@ -0,0 +1,17 @@
+package sqls
+
+import (
+	"go.drunkce.com/dce/session"
+)
+
+// NewSession creates a session persisted in a SQL database Store, it could be used when the application already
+// depends on a relational database such as Postgres, MySQL or SQLite.
+//
+//	store := sqls.NewStore(db, sqls.Postgres)
+//	if err := store.Migrate(); err != nil {
+//		panic(err)
+//	}
+//	sess, err := sqls.NewSession[*session.SimpleUser](store, []string{ctx.Rp.Sid()}, session.DefaultTtlMinutes)
+func NewSession[U session.UidGetter](store *Store, sidPool []string, ttlMinutes uint16) (*session.StoreSession[U], error) {
+	return session.NewStoreSession[U](store, sidPool, ttlMinutes)
+}
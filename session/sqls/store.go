@@ -0,0 +1,393 @@
+package sqls
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"go.drunkce.com/dce/session"
+)
+
+// Dialect adapts the SQL syntax differences between the databases.
+//
+// Fields:
+//   - Placeholder: Returns the bind parameter placeholder of the n-th (starts from 1) argument.
+//   - Upsert: Returns an insert statement updates the updateColumns on the conflict of the key columns.
+//   - InlineIndex: Whether to declare the indexes in the CREATE TABLE statements, for the databases which do not
+//     support the `CREATE INDEX IF NOT EXISTS`, such as MySQL.
+type Dialect struct {
+	Name        string
+	Placeholder func(n int) string
+	Upsert      func(table string, columns []string, keyColumns []string, updateColumns []string, placeholders []string) string
+	InlineIndex bool
+}
+
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+func onConflictUpsert(table string, columns []string, keyColumns []string, updateColumns []string, placeholders []string) string {
+	updates := make([]string, len(updateColumns))
+	for i, c := range updateColumns {
+		updates[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s", table,
+		strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(keyColumns, ", "), strings.Join(updates, ", "))
+}
+
+var (
+	Sqlite = Dialect{Name: "sqlite", Placeholder: questionPlaceholder, Upsert: onConflictUpsert}
+
+	Postgres = Dialect{Name: "postgres", Placeholder: func(n int) string {
+		return fmt.Sprintf("$%d", n)
+	}, Upsert: onConflictUpsert}
+
+	Mysql = Dialect{Name: "mysql", Placeholder: questionPlaceholder, Upsert: func(table string, columns []string, _ []string, updateColumns []string, placeholders []string) string {
+		updates := make([]string, len(updateColumns))
+		for i, c := range updateColumns {
+			updates[i] = fmt.Sprintf("%s = VALUES(%s)", c, c)
+		}
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s", table,
+			strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+	}, InlineIndex: true}
+)
+
+const DefaultTablePrefix = "dce_session"
+
+// Store persists the sessions in a SQL database via database/sql, the session fields are stored as rows of the data
+// table, the expiry stamps are stored in the meta table, and the user index is stored in the user table.
+//
+//	db, _ := sql.Open("pgx", dsn)
+//	store := sqls.NewStore(db, sqls.Postgres)
+//	if err := store.Migrate(); err != nil {
+//		panic(err)
+//	}
+//	stop := store.StartSweeper(time.Minute)
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+	prefix  string
+	ctx     context.Context
+	// now returns the current time, it could be replaced in tests to simulate the expiry
+	now func() time.Time
+}
+
+func NewStore(db *sql.DB, dialect Dialect) *Store {
+	return &Store{db: db, dialect: dialect, prefix: DefaultTablePrefix, ctx: context.Background(), now: time.Now}
+}
+
+// SetTablePrefix specifies the prefix of the table names, it should be called before the migration.
+func (s *Store) SetTablePrefix(prefix string) *Store {
+	s.prefix = prefix
+	return s
+}
+
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Store) dataTable() string {
+	return s.prefix + "_data"
+}
+
+func (s *Store) metaTable() string {
+	return s.prefix + "_meta"
+}
+
+func (s *Store) userTable() string {
+	return s.prefix + "_user"
+}
+
+func (s *Store) migrationTable() string {
+	return s.prefix + "_migration"
+}
+
+// bind replaces the "?" placeholders with the dialect placeholders.
+func (s *Store) bind(query string) string {
+	var builder strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			builder.WriteString(s.dialect.Placeholder(n))
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+func (s *Store) upsert(table string, columns []string, keyColumns []string, updateColumns []string) string {
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = s.dialect.Placeholder(i + 1)
+	}
+	return s.dialect.Upsert(table, columns, keyColumns, updateColumns, placeholders)
+}
+
+// createTable returns the idempotent statements to create the table and its indexes on the columns, so that a
+// migration interrupted on the databases committing DDL implicitly, such as MySQL, could be re-run.
+func (s *Store) createTable(table string, definition string, indexColumns ...string) []string {
+	var indexes []string
+	for _, column := range indexColumns {
+		name := fmt.Sprintf("%s_%s", table, column)
+		if s.dialect.InlineIndex {
+			definition += fmt.Sprintf(", INDEX %s (%s)", name, column)
+		} else {
+			indexes = append(indexes, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (%s)`, name, table, column))
+		}
+	}
+	return append([]string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (%s)`, table, definition)}, indexes...)
+}
+
+// migrations are the versioned schema changes, new migrations should only be appended, and every statement should be
+// idempotent.
+func (s *Store) migrations() [][]string {
+	return [][]string{
+		slices.Concat(
+			s.createTable(s.dataTable(), `sid VARCHAR(191) NOT NULL, field VARCHAR(191) NOT NULL, value TEXT NOT NULL, PRIMARY KEY (sid, field)`),
+			s.createTable(s.metaTable(), `sid VARCHAR(191) NOT NULL PRIMARY KEY, expire_at BIGINT NOT NULL`, "expire_at"),
+			s.createTable(s.userTable(), `user_key VARCHAR(191) NOT NULL, sid VARCHAR(191) NOT NULL, expire_at BIGINT NOT NULL, PRIMARY KEY (user_key, sid)`, "expire_at"),
+		),
+	}
+}
+
+// Migrate creates or upgrades the tables, the applied migration versions are recorded in the migration table.
+func (s *Store) Migrate() error {
+	if _, err := s.db.ExecContext(s.ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (version INT NOT NULL PRIMARY KEY, applied_at BIGINT NOT NULL)`, s.migrationTable())); err != nil {
+		return err
+	}
+	var current int
+	if err := s.db.QueryRowContext(s.ctx, fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) FROM %s`, s.migrationTable())).Scan(&current); err != nil {
+		return err
+	}
+	for i, migration := range s.migrations() {
+		version := i + 1
+		if version <= current {
+			continue
+		}
+		err := s.tx(func(tx *sql.Tx) error {
+			for _, stmt := range migration {
+				if _, err := tx.ExecContext(s.ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`INSERT INTO %s (version, applied_at) VALUES (?, ?)`, s.migrationTable())), version, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) tx(handler func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = handler(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) nowMilli() int64 {
+	return s.now().UnixMilli()
+}
+
+// liveCondition is the condition to filter out the expired sessions, the data rows without meta row are orphaned, they
+// are treated as expired.
+func (s *Store) liveCondition(alias string) string {
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM %s m WHERE m.sid = %s.sid AND m.expire_at > ?)`, s.metaTable(), alias)
+}
+
+// HSet sets the fields of the session, the ttl is the expiry of the session if it has no live meta row yet. The meta
+// row is written in the same transaction, so that the data rows will not be orphaned.
+func (s *Store) HSet(key string, fields map[string]string, ttl time.Duration) error {
+	return s.tx(func(tx *sql.Tx) error {
+		if err := s.ensureMeta(tx, key, ttl); err != nil {
+			return err
+		}
+		query := s.upsert(s.dataTable(), []string{"sid", "field", "value"}, []string{"sid", "field"}, []string{"value"})
+		for field, value := range fields {
+			if _, err := tx.ExecContext(s.ctx, query, key, field, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ensureMeta creates the meta row with the ttl if the session has no live one, the rows of the expired or orphaned
+// session will be cleared first to prevent reviving the stale fields.
+func (s *Store) ensureMeta(tx *sql.Tx, key string, ttl time.Duration) error {
+	var expireAt int64
+	err := tx.QueryRowContext(s.ctx, s.bind(fmt.Sprintf(`SELECT expire_at FROM %s WHERE sid = ?`, s.metaTable())), key).Scan(&expireAt)
+	if err == nil && expireAt > s.nowMilli() {
+		return nil
+	} else if err != nil && err != sql.ErrNoRows {
+		return err
+	} else if err = s.del(tx, key); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`INSERT INTO %s (sid, expire_at) VALUES (?, ?)`, s.metaTable())), key, s.now().Add(ttl).UnixMilli())
+	return err
+}
+
+func (s *Store) HGet(key string, field string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRowContext(s.ctx, s.bind(fmt.Sprintf(`SELECT d.value FROM %s d WHERE d.sid = ? AND d.field = ? AND %s`,
+		s.dataTable(), s.liveCondition("d"))), key, field, s.nowMilli()).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (s *Store) HGetAll(key string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(s.ctx, s.bind(fmt.Sprintf(`SELECT d.field, d.value FROM %s d WHERE d.sid = ? AND %s`,
+		s.dataTable(), s.liveCondition("d"))), key, s.nowMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[string]string)
+	for rows.Next() {
+		var field, value string
+		if err = rows.Scan(&field, &value); err != nil {
+			return nil, err
+		}
+		result[field] = value
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) HDel(key string, field string) error {
+	_, err := s.db.ExecContext(s.ctx, s.bind(fmt.Sprintf(`DELETE FROM %s WHERE sid = ? AND field = ?`, s.dataTable())), key, field)
+	return err
+}
+
+func (s *Store) Exists(key string) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(s.ctx, s.bind(fmt.Sprintf(`SELECT COUNT(1) FROM %s d WHERE d.sid = ? AND %s`,
+		s.dataTable(), s.liveCondition("d"))), key, s.nowMilli()).Scan(&count)
+	return count > 0, err
+}
+
+func (s *Store) del(tx *sql.Tx, key string) error {
+	if _, err := tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`DELETE FROM %s WHERE sid = ?`, s.dataTable())), key); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`DELETE FROM %s WHERE sid = ?`, s.metaTable())), key)
+	return err
+}
+
+func (s *Store) Del(key string) error {
+	return s.tx(func(tx *sql.Tx) error {
+		return s.del(tx, key)
+	})
+}
+
+// Expire updates the expiry stamp of the session, it takes no effect if the session has no data, the same as Redis.
+func (s *Store) Expire(key string, ttl time.Duration) error {
+	if ok, err := s.Exists(key); err != nil || !ok {
+		return err
+	}
+	_, err := s.db.ExecContext(s.ctx, s.upsert(s.metaTable(), []string{"sid", "expire_at"}, []string{"sid"}, []string{"expire_at"}),
+		key, s.now().Add(ttl).UnixMilli())
+	return err
+}
+
+// TTL returns the remaining time to live of the session, it returns false if the session has no expiry or expired.
+func (s *Store) TTL(key string) (time.Duration, bool, error) {
+	var expireAt int64
+	err := s.db.QueryRowContext(s.ctx, s.bind(fmt.Sprintf(`SELECT expire_at FROM %s WHERE sid = ? AND expire_at > ?`, s.metaTable())), key, s.nowMilli()).Scan(&expireAt)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(expireAt-s.nowMilli()) * time.Millisecond, true, nil
+}
+
+// SAdd adds the sids into the user index, and renews the expiry of the whole user index.
+func (s *Store) SAdd(userKey string, ttl time.Duration, sids ...string) error {
+	expireAt := s.now().Add(ttl).UnixMilli()
+	return s.tx(func(tx *sql.Tx) error {
+		query := s.upsert(s.userTable(), []string{"user_key", "sid", "expire_at"}, []string{"user_key", "sid"}, []string{"expire_at"})
+		for _, sid := range sids {
+			if _, err := tx.ExecContext(s.ctx, query, userKey, sid, expireAt); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`UPDATE %s SET expire_at = ? WHERE user_key = ?`, s.userTable())), expireAt, userKey)
+		return err
+	})
+}
+
+func (s *Store) SRem(userKey string, sids ...string) error {
+	return s.tx(func(tx *sql.Tx) error {
+		for _, sid := range sids {
+			if _, err := tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`DELETE FROM %s WHERE user_key = ? AND sid = ?`, s.userTable())), userKey, sid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) SMembers(userKey string) ([]string, error) {
+	rows, err := s.db.QueryContext(s.ctx, s.bind(fmt.Sprintf(`SELECT sid FROM %s WHERE user_key = ? AND expire_at > ?`, s.userTable())), userKey, s.nowMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sids []string
+	for rows.Next() {
+		var sid string
+		if err = rows.Scan(&sid); err != nil {
+			return nil, err
+		}
+		sids = append(sids, sid)
+	}
+	return sids, rows.Err()
+}
+
+// Sweep deletes the expired session rows, the orphaned data rows and the expired user index rows, it returns the
+// number of the swept sessions.
+func (s *Store) Sweep() (int64, error) {
+	var swept int64
+	err := s.tx(func(tx *sql.Tx) error {
+		now := s.nowMilli()
+		if _, err := tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`DELETE FROM %s WHERE NOT EXISTS (SELECT 1 FROM %s m WHERE m.sid = %s.sid AND m.expire_at > ?)`,
+			s.dataTable(), s.metaTable(), s.dataTable())), now); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`DELETE FROM %s WHERE expire_at <= ?`, s.metaTable())), now)
+		if err != nil {
+			return err
+		}
+		swept, _ = result.RowsAffected()
+		_, err = tx.ExecContext(s.ctx, s.bind(fmt.Sprintf(`DELETE FROM %s WHERE expire_at <= ?`, s.userTable())), now)
+		return err
+	})
+	return swept, err
+}
+
+// StartSweeper sweeps the expired rows periodically in background until the stop function called.
+func (s *Store) StartSweeper(interval time.Duration) (stop func()) {
+	return session.StartSweeper(interval, func() {
+		if _, err := s.Sweep(); err != nil {
+			slog.Warn(fmt.Sprintf("Session rows sweeping failed: %s", err.Error()))
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package sqls
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/session/sessiontest"
+	_ "modernc.org/sqlite"
+)
+
+func openStore(t *testing.T) *Store {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "session.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	store := NewStore(db, Sqlite)
+	if err = store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	// migrating again should be a no-op
+	if err = store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestMigrateInterrupted(t *testing.T) {
+	store := openStore(t)
+	// simulate the tables created but the version not recorded, such as the implicit DDL commits of MySQL
+	if _, err := store.DB().Exec(`DELETE FROM ` + store.migrationTable()); err != nil {
+		t.Fatal(err)
+	} else if err = store.Migrate(); err != nil {
+		t.Fatalf("the interrupted migration should be re-runnable, got %v", err)
+	}
+	for _, stmt := range NewStore(nil, Mysql).migrations()[0] {
+		if !strings.HasPrefix(stmt, "CREATE TABLE IF NOT EXISTS ") {
+			t.Fatalf("expected only the idempotent table creations for MySQL, got %q", stmt)
+		}
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	store := openStore(t)
+	sess, _ := NewSession[*session.SimpleUser](store, nil, session.DefaultTtlMinutes)
+	if err := sess.Login(&session.SimpleUser{Id: 1, Nick: "Drunk"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := NewSession[*session.SimpleUser](store, []string{sess.Id()}, 0)
+	if user, ok := restored.User(); !ok || user.Nick != "Drunk" {
+		t.Fatalf("user should be restored, got %v", user)
+	}
+	if sids, _ := restored.Sids(1); len(sids) != 1 || sids[0] != sess.Id() {
+		t.Fatalf("uid mapping should be stored, got %v", sids)
+	}
+	if passed, err := restored.TtlPassed(); err != nil || passed > 1 {
+		t.Fatalf("ttl should be touched, got %d %v", passed, err)
+	}
+	if err := restored.SilentDel(session.DefaultUserField); err != nil {
+		t.Fatal(err)
+	} else if _, err = restored.SilentGet(session.DefaultUserField); err == nil {
+		t.Fatal("deleted field should not be found")
+	}
+	if err := restored.Destroy(); err != nil {
+		t.Fatal(err)
+	} else if sids, _ := restored.AllSid(1); len(sids) != 0 {
+		t.Fatalf("destroyed session should be unmapped, got %v", sids)
+	}
+}
+
+func TestStoreExpireAndSweep(t *testing.T) {
+	store := openStore(t)
+	_ = store.HSet("live", map[string]string{"a": "1"}, time.Hour)
+	_ = store.HSet("temp", map[string]string{"a": "1"}, time.Millisecond)
+	_ = store.SAdd("user", time.Millisecond, "temp")
+	time.Sleep(5 * time.Millisecond)
+
+	if ok, _ := store.Exists("temp"); ok {
+		t.Fatal("expired session should not exist")
+	} else if _, ok, _ = store.HGet("temp", "a"); ok {
+		t.Fatal("expired field should not be read")
+	} else if sids, _ := store.SMembers("user"); len(sids) != 0 {
+		t.Fatalf("expired user index should be filtered, got %v", sids)
+	}
+	if swept, err := store.Sweep(); err != nil || swept != 1 {
+		t.Fatalf("one session should be swept, got %d %v", swept, err)
+	}
+	var rows int
+	_ = store.DB().QueryRow("SELECT COUNT(1) FROM " + store.dataTable()).Scan(&rows)
+	if rows != 1 {
+		t.Fatalf("only the live row should remain, got %d", rows)
+	}
+	// setting on an expired session should not revive the stale fields
+	_ = store.HSet("stale", map[string]string{"a": "1", "b": "2"}, time.Hour)
+	_ = store.Expire("stale", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_ = store.HSet("stale", map[string]string{"a": "3"}, time.Hour)
+	if fields, _ := store.HGetAll("stale"); len(fields) != 1 || fields["a"] != "3" {
+		t.Fatalf("stale fields should be cleared, got %v", fields)
+	}
+}
+
+func TestStoreOrphanedRows(t *testing.T) {
+	store := openStore(t)
+	// the data row written without the meta row, such as by a crash of the older versions
+	if _, err := store.DB().Exec(`INSERT INTO ` + store.dataTable() + ` (sid, field, value) VALUES ('orphan', 'a', '1')`); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.Exists("orphan"); ok {
+		t.Fatal("the orphaned rows should be treated as expired")
+	} else if _, err := store.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	_ = store.DB().QueryRow("SELECT COUNT(1) FROM " + store.dataTable()).Scan(&rows)
+	if rows != 0 {
+		t.Fatalf("the orphaned rows should be swept, got %d", rows)
+	}
+
+	if err := store.HSet("new", map[string]string{"a": "1"}, time.Minute); err != nil {
+		t.Fatal(err)
+	} else if ttl, ok, _ := store.TTL("new"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("the meta row should be written with the data rows, got %v %t", ttl, ok)
+	}
+}
+
+func TestSqlConformance(t *testing.T) {
+	store := openStore(t)
+	sessiontest.Run(t, sessiontest.Harness{
+		New: func(sidPool []string, ttlMinutes uint16) (sessiontest.Session, error) {
+			return NewSession[*session.SimpleUser](store, sidPool, ttlMinutes)
+		},
+		Advance: func(d time.Duration) {
+			now := store.now
+			store.now = func() time.Time {
+				return now().Add(d)
+			}
+		},
+	})
+}
@@ -0,0 +1,232 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"go.drunkce.com/dce/util"
+)
+
+// KvStore is the hash and set storage of the StoreSession, it is a tiny subset of Redis that the file and SQL stores
+// provide. The session data are stored in the hashes, and the user mappings are stored in the sets.
+type KvStore interface {
+	// HSet sets the fields of the hash, the ttl is the expiry of the hash if it has no live one yet.
+	HSet(key string, fields map[string]string, ttl time.Duration) error
+	HGet(key string, field string) (string, bool, error)
+	HGetAll(key string) (map[string]string, error)
+	HDel(key string, field string) error
+	Del(key string) error
+	Exists(key string) (bool, error)
+	Expire(key string, ttl time.Duration) error
+	// TTL returns the remaining time to live of the key, it returns false if the key not exists or has no expiry.
+	TTL(key string) (time.Duration, bool, error)
+	// SAdd adds the members into the set, and renews the expiry of the whole set.
+	SAdd(key string, ttl time.Duration, members ...string) error
+	SRem(key string, members ...string) error
+	SMembers(key string) ([]string, error)
+}
+
+// StoreSession is a generic struct that represents a session persisted in a KvStore, such as the file and SQL stores.
+// It mirrors the Redis session, combines the BasicSession, UserSession and ConnectionSession, and stores the session
+// data as serialized strings.
+type StoreSession[U UidGetter] struct {
+	*BasicSession
+	*UserSession[U]
+	*ConnectionSession
+	store KvStore
+}
+
+func NewStoreSession[U UidGetter](store KvStore, sidPool []string, ttlMinutes uint16) (*StoreSession[U], error) {
+	basic, err := NewBasicSession(sidPool, ttlMinutes)
+	if err != nil {
+		return nil, err
+	}
+	ss := &StoreSession[U]{
+		BasicSession:      basic,
+		UserSession:       NewUserSession[U](basic),
+		ConnectionSession: NewConnectionSession(basic),
+		store:             store,
+	}
+	ss.BasicSession.IfSession = ss
+	ss.UserSession.IfUserSession = ss
+	ss.ConnectionSession.IfConnection = ss
+	return ss, nil
+}
+
+func storeGenKey(prefix string, id string) string {
+	return fmt.Sprintf("%s:%s", prefix, id)
+}
+
+func (s *StoreSession[U]) Key() string {
+	return storeGenKey(s.SidName, s.BasicSession.Id())
+}
+
+// TextOnly reports the values are stored as text, so the binary codecs should be base64 encoded.
+func (s *StoreSession[U]) TextOnly() bool {
+	return true
+}
+
+func (s *StoreSession[U]) ttl() time.Duration {
+	return time.Duration(s.TtlSeconds()) * time.Second
+}
+
+func (s *StoreSession[U]) SilentSet(field string, value any) error {
+	val, err := TryMarshalString(value)
+	if err != nil {
+		return err
+	}
+	return s.store.HSet(s.Key(), map[string]string{field: val}, s.ttl())
+}
+
+func (s *StoreSession[U]) SilentGet(field string) (any, error) {
+	if v, ok, err := s.store.HGet(s.Key(), field); err != nil {
+		return nil, err
+	} else if ok {
+		return v, nil
+	}
+	return nil, util.Silent("No session value with key \"%s\"", field)
+}
+
+func (s *StoreSession[U]) SilentDel(field string) error {
+	return s.store.HDel(s.Key(), field)
+}
+
+func (s *StoreSession[U]) Destroy() error {
+	// the anonymous sessions have no user mapping
+	if _, ok := s.User(); ok {
+		if err := s.Unmapping(); err != nil {
+			return err
+		}
+	}
+	if err := s.store.Del(s.Key()); err != nil {
+		return err
+	}
+	s.EmitDestroyed()
+	return nil
+}
+
+func (s *StoreSession[U]) Touch() error {
+	return s.store.Expire(s.Key(), s.ttl())
+}
+
+func (s *StoreSession[U]) Load(data map[string]any) error {
+	fields := make(map[string]string, len(data))
+	for k, v := range data {
+		val, err := TryMarshalString(v)
+		if err != nil {
+			return err
+		}
+		fields[k] = val
+	}
+	return s.store.HSet(s.Key(), fields, s.ttl())
+}
+
+func (s *StoreSession[U]) Raw() (map[string]any, error) {
+	fields, err := s.store.HGetAll(s.Key())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]any, len(fields))
+	for k, v := range fields {
+		result[k] = v
+	}
+	return result, nil
+}
+
+func (s *StoreSession[U]) TtlPassed() (uint32, error) {
+	ttl, ok, err := s.store.TTL(s.Key())
+	if err != nil {
+		return 0, err
+	} else if !ok || ttl.Seconds() < 1 {
+		return 0, util.Closed0("ttl was not initialized yet.")
+	}
+	return s.TtlSeconds() - uint32(ttl.Seconds()), nil
+}
+
+func (s *StoreSession[U]) Renew(filters map[string]any) error {
+	err := s.UserSession.Renew(filters)
+	if err == nil && s.Request() {
+		return s.UpdateShadow(s.BasicSession.Id())
+	}
+	return err
+}
+
+func (s *StoreSession[U]) Clone(id string) (any, error) {
+	cloned := *s
+	cl := &cloned
+	basic, err := s.CloneBasic(cl, id)
+	if err != nil {
+		return nil, err
+	}
+	cl.BasicSession = basic
+	cl.UserSession = s.CloneUser(cl, basic)
+	cl.ConnectionSession = s.CloneConnection(cl, basic)
+	return cl, nil
+}
+
+func storeGenUserKey(userPrefix string, id uint64) string {
+	return fmt.Sprintf("%s:%d", userPrefix, id)
+}
+
+func (s *StoreSession[U]) UserKey() (string, error) {
+	uid, err := s.Uid()
+	if err != nil {
+		return "", err
+	}
+	return storeGenUserKey(s.KeyPrefix, uid), nil
+}
+
+func (s *StoreSession[U]) Mapping() error {
+	userKey, err := s.UserKey()
+	if err != nil {
+		return err
+	}
+	return s.store.SAdd(userKey, time.Duration(MappingTtlSeconds)*time.Second, s.BasicSession.Id())
+}
+
+func (s *StoreSession[U]) Unmapping() error {
+	userKey, err := s.UserKey()
+	if err != nil {
+		return err
+	}
+	return s.store.SRem(userKey, s.BasicSession.Id())
+}
+
+func (s *StoreSession[U]) Sync(user *U) error {
+	userSeq, err := s.Codec().Marshal(*user)
+	if err != nil {
+		return err
+	}
+	sids, err := s.Sids((*user).Uid())
+	if err != nil {
+		return err
+	}
+	for _, sid := range sids {
+		if err = s.store.HSet(storeGenKey(s.SidName, sid), map[string]string{s.UserField: string(userSeq)}, s.ttl()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StoreSession[U]) AllSid(uid uint64) ([]string, error) {
+	return s.store.SMembers(storeGenUserKey(s.KeyPrefix, uid))
+}
+
+func (s *StoreSession[U]) FilterSids(uid uint64, sids []string) ([]string, error) {
+	userKey := storeGenUserKey(s.KeyPrefix, uid)
+	var filtered, expired []string
+	for _, sid := range sids {
+		if ok, err := s.store.Exists(storeGenKey(s.SidName, sid)); err != nil {
+			return nil, err
+		} else if ok {
+			filtered = append(filtered, sid)
+		} else {
+			expired = append(expired, sid)
+		}
+	}
+	if len(expired) > 0 {
+		return filtered, s.store.SRem(userKey, expired...)
+	}
+	return filtered, nil
+}
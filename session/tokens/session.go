@@ -0,0 +1,237 @@
+package tokens
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
+	"time"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/util"
+)
+
+// Session is a stateless session carried by a signed token, it is designed for the internal APIs which should not
+// look up a store on every request. The session data (including the user) is serialized into the token claims, and the
+// token is passed through the same channel as the sids, such as the `X-Session-Id` header, the cookie or the `Sid`
+// field of the flex packages, so it works with the session middleware and the `AutoRenew` as the store sessions:
+//
+//	signer := tokens.HS256(key)
+//	sess, err := tokens.NewSession[*session.SimpleUser](signer, []string{ctx.Rp.Sid()}, session.DefaultTtlMinutes)
+//
+// The `Id()` returns the token, and it will be re-signed after the data changed, so the response sid should be updated
+// if it differs from the request one. The token expires at the create stamp plus the ttl, and will be refreshed with a
+// new sid by the renewal. Since there is no store, the user mappings are not supported, the issued tokens could not
+// be revoked before expired, and the login policy could not evict the other sessions.
+type Session[U session.UidGetter] struct {
+	*session.BasicSession
+	*session.UserSession[U]
+	*session.ConnectionSession
+	signer Signer
+	data   map[string]string
+	// token is the signed token of the current data, it will be cleared after changed
+	token    string
+	tokenSid string
+}
+
+func NewSession[U session.UidGetter](signer Signer, sidPool []string, ttlMinutes uint16) (*Session[U], error) {
+	var claims *Claims
+	if len(sidPool) > 0 && IsToken(sidPool[0]) {
+		var err error
+		if claims, err = verify(signer, sidPool[0]); err != nil {
+			return nil, err
+		}
+		sidPool = append([]string{claims.Sid}, sidPool[1:]...)
+	}
+	basic, err := session.NewBasicSession(sidPool, ttlMinutes)
+	if err != nil {
+		return nil, err
+	}
+	ts := &Session[U]{
+		BasicSession:      basic,
+		UserSession:       session.NewUserSession[U](basic),
+		ConnectionSession: session.NewConnectionSession(basic),
+		signer:            signer,
+		data:              make(map[string]string),
+	}
+	ts.BasicSession.IfSession = ts
+	ts.UserSession.IfUserSession = ts
+	ts.ConnectionSession.IfConnection = ts
+	ts.load(claims)
+	return ts, nil
+}
+
+func verify(signer Signer, token string) (*Claims, error) {
+	claims, err := Decode(signer, token)
+	if err != nil {
+		return nil, err
+	} else if claims.Exp <= time.Now().Unix() {
+		return nil, util.Closed0(`token of sid "%s" was expired`, claims.Sid)
+	}
+	return claims, nil
+}
+
+func (s *Session[U]) load(claims *Claims) {
+	if claims == nil {
+		return
+	} else if claims.Data != nil {
+		s.data = claims.Data
+	}
+}
+
+// Id returns the signed token of the session, it returns an empty string and logs the error if the signer could not
+// sign, such as a verify-only EdDSA signer with the data changed.
+func (s *Session[U]) Id() string {
+	if s.token == "" || s.tokenSid != s.BasicSession.Id() {
+		claims := &Claims{
+			Sid:  s.BasicSession.Id(),
+			Iat:  s.CreateStamp(),
+			Exp:  s.CreateStamp() + int64(s.TtlSeconds()),
+			Data: s.data,
+		}
+		if user, ok := s.User(); ok {
+			claims.Sub = strconv.FormatUint(user.Uid(), 10)
+		}
+		token, err := Encode(s.signer, claims)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Session token signing failed: %s", err.Error()))
+			return ""
+		}
+		s.token, s.tokenSid = token, claims.Sid
+	}
+	return s.token
+}
+
+// TextOnly reports the values are stored as text, so the binary codecs should be base64 encoded.
+func (s *Session[U]) TextOnly() bool {
+	return true
+}
+
+func (s *Session[U]) SilentSet(field string, value any) error {
+	val, err := session.TryMarshalString(value)
+	if err != nil {
+		return err
+	}
+	s.data[field] = val
+	s.token = ""
+	return nil
+}
+
+func (s *Session[U]) SilentGet(field string) (any, error) {
+	if v, ok := s.data[field]; ok {
+		return v, nil
+	}
+	return nil, util.Silent("No session value with key \"%s\"", field)
+}
+
+func (s *Session[U]) SilentDel(field string) error {
+	if _, ok := s.data[field]; ok {
+		delete(s.data, field)
+		s.token = ""
+	}
+	return nil
+}
+
+// Destroy clears the session data, the issued tokens are still valid until expired.
+func (s *Session[U]) Destroy() error {
+	s.data = make(map[string]string)
+	s.token = ""
+	s.EmitDestroyed()
+	return nil
+}
+
+// Touch does nothing, the token expires at the create stamp plus the ttl, it could only be extended by the renewal.
+func (s *Session[U]) Touch() error {
+	return nil
+}
+
+func (s *Session[U]) Load(data map[string]any) error {
+	fields := make(map[string]string, len(data))
+	for k, v := range data {
+		val, err := session.TryMarshalString(v)
+		if err != nil {
+			return err
+		}
+		fields[k] = val
+	}
+	s.data = fields
+	s.token = ""
+	return nil
+}
+
+func (s *Session[U]) Raw() (map[string]any, error) {
+	result := make(map[string]any, len(s.data))
+	for k, v := range s.data {
+		result[k] = v
+	}
+	return result, nil
+}
+
+func (s *Session[U]) TtlPassed() (uint32, error) {
+	return uint32(time.Now().Unix() - s.CreateStamp()), nil
+}
+
+func (s *Session[U]) Renew(filters map[string]any) error {
+	err := s.UserSession.Renew(filters)
+	if err == nil && s.Request() {
+		return s.UpdateShadow(s.BasicSession.Id())
+	}
+	return err
+}
+
+// Clone clones the session, the id could be a token or a plain sid, the data will be taken from the token, or be empty
+// for the plain sid since a stateless session could not be looked up.
+func (s *Session[U]) Clone(id string) (any, error) {
+	cloned := *s
+	cl := &cloned
+	cl.data = maps.Clone(s.data)
+	cl.token = ""
+	var claims *Claims
+	if IsToken(id) {
+		var err error
+		if claims, err = verify(s.signer, id); err != nil {
+			return nil, err
+		}
+		id = claims.Sid
+		cl.data = make(map[string]string)
+	} else if id != "" {
+		cl.data = make(map[string]string)
+	}
+	basic, err := s.CloneBasic(cl, id)
+	if err != nil {
+		return nil, err
+	}
+	cl.BasicSession = basic
+	cl.UserSession = s.CloneUser(cl, basic)
+	cl.ConnectionSession = s.CloneConnection(cl, basic)
+	cl.load(claims)
+	return cl, nil
+}
+
+func (s *Session[U]) Mapping() error {
+	return nil
+}
+
+func (s *Session[U]) Unmapping() error {
+	return nil
+}
+
+// Sync updates the user of current session if the uid matched, the other tokens could not be updated.
+func (s *Session[U]) Sync(user *U) error {
+	if uid, err := s.Uid(); err != nil || uid != (*user).Uid() {
+		return nil
+	}
+	userSeq, err := s.Codec().Marshal(*user)
+	if err != nil {
+		return err
+	}
+	return s.SilentSet(s.UserField, userSeq)
+}
+
+func (s *Session[U]) AllSid(uint64) ([]string, error) {
+	return nil, nil
+}
+
+func (s *Session[U]) FilterSids(uint64, []string) ([]string, error) {
+	return nil, nil
+}
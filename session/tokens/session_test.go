@@ -0,0 +1,112 @@
+package tokens_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/session/tokens"
+)
+
+var signer = tokens.HS256([]byte("0123456789abcdef0123456789abcdef"))
+
+func newSession(t *testing.T, sid string) *tokens.Session[*session.SimpleUser] {
+	t.Helper()
+	sess, err := tokens.NewSession[*session.SimpleUser](signer, []string{sid}, session.DefaultTtlMinutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestLoginAndLoad(t *testing.T) {
+	sess := newSession(t, "")
+	if err := sess.Login(&session.SimpleUser{Id: 43, Nick: "Drunk"}, 0); err != nil {
+		t.Fatal(err)
+	} else if err = sess.Set("theme", "dark"); err != nil {
+		t.Fatal(err)
+	}
+	token := sess.Id()
+	if !tokens.IsToken(token) {
+		t.Fatalf("expected a token, got %q", token)
+	}
+
+	loaded := newSession(t, token)
+	if user, ok := loaded.User(); !ok || user.Id != 43 || user.Nick != "Drunk" {
+		t.Fatalf("expected the user loaded from the token, got %v", user)
+	}
+	var theme string
+	if err := loaded.Get("theme", &theme); err != nil || theme != "dark" {
+		t.Fatalf("expected the theme loaded from the token, got %q, %v", theme, err)
+	} else if loaded.Id() != token {
+		t.Fatal("the token should not change if the data not changed")
+	}
+
+	if err := loaded.Logout(); err != nil {
+		t.Fatal(err)
+	} else if loaded.Id() == token {
+		t.Fatal("the token should be re-signed after logout")
+	} else if _, ok := newSession(t, loaded.Id()).User(); ok {
+		t.Fatal("the user should be cleared after logout")
+	}
+
+	tampered := token[:len(token)-2] + "AA"
+	if _, err := tokens.NewSession[*session.SimpleUser](signer, []string{tampered}, session.DefaultTtlMinutes); err == nil {
+		t.Fatal("the tampered token should be rejected")
+	}
+}
+
+// plainSid forges a plain sid created at the stamp, so that the expiry and renewal could be tested.
+func plainSid(ttlMinutes uint16, stamp int64) string {
+	return fmt.Sprintf("%064x%04x%08x", 1, ttlMinutes, stamp)
+}
+
+func TestExpiryAndRenew(t *testing.T) {
+	stamp := time.Now().Add(-20 * time.Minute).Unix()
+	expired, _ := tokens.Encode(signer, &tokens.Claims{Sid: plainSid(10, stamp), Iat: stamp, Exp: stamp + 600})
+	if _, err := tokens.NewSession[*session.SimpleUser](signer, []string{expired}, session.DefaultTtlMinutes); err == nil {
+		t.Fatal("the expired token should be rejected")
+	}
+
+	token, _ := tokens.Encode(signer, &tokens.Claims{Sid: plainSid(60, stamp), Iat: stamp, Exp: stamp + 3600,
+		Data: map[string]string{"theme": `"dark"`}})
+	sess := newSession(t, token)
+	if renewed, err := session.NewAutoRenew(sess).TryRenew(); err != nil || !renewed {
+		t.Fatalf("expected renewed, got %v, %v", renewed, err)
+	}
+	refreshed := newSession(t, sess.Id())
+	var theme string
+	if refreshed.CreateStamp() <= stamp {
+		t.Fatal("the renewed token should have a new create stamp")
+	} else if err := refreshed.Get("theme", &theme); err != nil || theme != "dark" {
+		t.Fatalf("the data should be kept after renewed, got %q, %v", theme, err)
+	}
+}
+
+func TestEdDSA(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	issuer, verifier := tokens.EdDSA(private, nil), tokens.EdDSA(nil, public)
+	sess, _ := tokens.NewSession[*session.SimpleUser](issuer, nil, session.DefaultTtlMinutes)
+	_ = sess.Login(&session.SimpleUser{Id: 1}, 0)
+	loaded, err := tokens.NewSession[*session.SimpleUser](verifier, []string{sess.Id()}, session.DefaultTtlMinutes)
+	if err != nil {
+		t.Fatal(err)
+	} else if user, ok := loaded.User(); !ok || user.Id != 1 {
+		t.Fatal("expected the user verified by the public key")
+	} else if _, err = tokens.NewSession[*session.SimpleUser](signer, []string{sess.Id()}, session.DefaultTtlMinutes); err == nil {
+		t.Fatal("the token of a different alg should be rejected")
+	}
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	_ = loaded.SilentSet("k", "v")
+	if loaded.Id() != "" || !strings.Contains(logs.String(), "no private key") {
+		t.Fatalf("the signing failure of the verifier should be logged, got %q", logs.String())
+	}
+}
@@ -0,0 +1,159 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"go.drunkce.com/dce/util"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Signer signs and verifies the tokens, the built-in signers are HS256 and EdDSA.
+type Signer interface {
+	// Alg returns the "alg" header of the tokens, the tokens with a different alg will be rejected.
+	Alg() string
+
+	// Sign returns the signature of the signing input.
+	Sign(input []byte) ([]byte, error)
+
+	// Verify checks the signature of the signing input.
+	Verify(input []byte, signature []byte) bool
+}
+
+type hs256Signer struct {
+	key []byte
+}
+
+// HS256 creates a HMAC-SHA256 signer, the key should be at least 32 bytes.
+func HS256(key []byte) Signer {
+	return &hs256Signer{key: key}
+}
+
+func (h *hs256Signer) Alg() string {
+	return AlgHS256
+}
+
+func (h *hs256Signer) Sign(input []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(input)
+	return mac.Sum(nil), nil
+}
+
+func (h *hs256Signer) Verify(input []byte, signature []byte) bool {
+	expected, _ := h.Sign(input)
+	return hmac.Equal(expected, signature)
+}
+
+type edDSASigner struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// EdDSA creates an Ed25519 signer, the private key could be nil for the verify-only services, which could not issue or
+// refresh the tokens then.
+func EdDSA(private ed25519.PrivateKey, public ed25519.PublicKey) Signer {
+	if public == nil && private != nil {
+		public = private.Public().(ed25519.PublicKey)
+	}
+	return &edDSASigner{private: private, public: public}
+}
+
+func (e *edDSASigner) Alg() string {
+	return AlgEdDSA
+}
+
+func (e *edDSASigner) Sign(input []byte) ([]byte, error) {
+	if e.private == nil {
+		return nil, util.Closed0("EdDSA signer has no private key, cannot sign tokens")
+	}
+	return ed25519.Sign(e.private, input), nil
+}
+
+func (e *edDSASigner) Verify(input []byte, signature []byte) bool {
+	return len(e.public) == ed25519.PublicKeySize && ed25519.Verify(e.public, input, signature)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// Claims is the payload of the tokens.
+//
+// Fields:
+//   - Sid: The internal session id, it is regenerated on login and renewal, the same as the store sessions.
+//   - Sub: The uid of the logged in user.
+//   - Iat: The create stamp of the sid.
+//   - Exp: The expire stamp, it is the create stamp plus the ttl.
+//   - Data: The serialized session data, including the user.
+type Claims struct {
+	Sid  string            `json:"sid"`
+	Sub  string            `json:"sub,omitempty"`
+	Iat  int64             `json:"iat"`
+	Exp  int64             `json:"exp"`
+	Data map[string]string `json:"data,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// Encode signs the claims into a compact JWT.
+func Encode(signer Signer, claims *Claims) (string, error) {
+	head, err := json.Marshal(header{Alg: signer.Alg(), Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := b64.EncodeToString(head) + "." + b64.EncodeToString(payload)
+	signature, err := signer.Sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64.EncodeToString(signature), nil
+}
+
+// Decode verifies the compact JWT and returns the claims, the expiry is not checked here.
+func Decode(signer Signer, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, util.Closed0(`invalid token "%s"`, token)
+	}
+	var head header
+	if bts, err := b64.DecodeString(parts[0]); err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(bts, &head); err != nil {
+		return nil, err
+	} else if head.Alg != signer.Alg() {
+		return nil, util.Closed0(`token alg "%s" mismatched, "%s" required`, head.Alg, signer.Alg())
+	}
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	} else if !signer.Verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, util.Closed0("token signature mismatched")
+	}
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	if err = json.Unmarshal(payload, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// IsToken reports whether the sid is a token but not a plain sid.
+func IsToken(sid string) bool {
+	return strings.Count(sid, ".") == 2
+}
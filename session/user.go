@@ -2,6 +2,7 @@ package session
 
 import (
 	"strconv"
+	"time"
 
 	"go.drunkce.com/dce/util"
 )
@@ -29,19 +30,23 @@ const (
 //   - IfUserSession[U]: The interface that defines user-specific session operations.
 //   - KeyPrefix: A string prefix used for generating user-specific keys.
 //   - UserField: A string field name used to store user data within the session.
+//   - DeviceField: A string field name used to store the client device type within the session.
 //   - loadState: An int8 value indicating the current state of user data loading.
 //   - user: The user data of type U associated with the session.
 type UserSession[U UidGetter] struct {
 	*BasicSession
 	IfUserSession[U]
-	KeyPrefix string
-	UserField string
-	loadState int8
-	user      U
+	KeyPrefix   string
+	UserField   string
+	DeviceField string
+	loadState   int8
+	user        U
+	policy      *LoginPolicy
 }
 
 func NewUserSession[U UidGetter](basic *BasicSession) *UserSession[U] {
-	return &UserSession[U]{BasicSession: basic, KeyPrefix: DefaultUserPrefix, UserField: DefaultUserField, loadState: notLoaded}
+	return &UserSession[U]{BasicSession: basic, KeyPrefix: DefaultUserPrefix, UserField: DefaultUserField,
+		DeviceField: DefaultDeviceField, loadState: notLoaded}
 }
 
 func (s *UserSession[U]) CloneUser(cloned IfUserSession[U], basic *BasicSession) *UserSession[U] {
@@ -65,7 +70,7 @@ func (s *UserSession[U]) User() (U, bool) {
 	if s.loadState == notLoaded {
 		if val, err := s.SilentGet(s.UserField); err == nil {
 			var user U
-			if err = TryUnmarshal(val, &user, s.IfSession.NeedSerial()); err == nil {
+			if err = s.decode(val, &user); err == nil {
 				s.user = user
 				s.loadState = loadedSome
 				return s.user, true
@@ -100,6 +105,7 @@ func (s *UserSession[U]) doLogin(user *U, ttlMinutes uint16) error {
 	filters := make(map[string]any)
 	if s.loadState == loadedSome {
 		filters[s.UserField] = s.user
+		filters[LoginNanoField] = time.Now().UnixNano()
 	}
 	// should call this via the interface, it will locate from the implementation
 	// for login just directly regenerate a new sid
@@ -107,6 +113,10 @@ func (s *UserSession[U]) doLogin(user *U, ttlMinutes uint16) error {
 		return err
 	}
 	_ = cloned.Destroy()
+	if s.loadState == loadedSome {
+		s.emit(Event{Kind: EventLogin, OldSid: cloned.Id(), Uid: s.user.Uid()})
+		return s.enforcePolicy(s.user.Uid())
+	}
 	return nil
 }
 
@@ -124,9 +134,14 @@ func (s *UserSession[U]) Logout() error {
 	} else if err := s.Unmapping(); err != nil {
 		return err
 	}
+	uid := s.user.Uid()
 	s.user = util.NewStruct[U]()
 	s.loadState = loadedNone
-	return s.SilentDel(s.UserField)
+	if err := s.SilentDel(s.UserField); err != nil {
+		return err
+	}
+	s.emit(Event{Kind: EventLogout, Uid: uid})
+	return nil
 }
 
 func (s *UserSession[U]) Sids(uid uint64) ([]string, error) {
@@ -212,6 +227,19 @@ type IfUserSession[U UidGetter] interface {
 	ListByUid(uid uint64) ([]any, error)
 }
 
+// LogoutAller could be implemented by the user sessions to log out the user everywhere, it is detected via the type
+// assertion, so that the external IfUserSession implementations would not be broken. The built-in stores implement it
+// via the embedded UserSession.
+//
+//	if la, ok := sess.(session.LogoutAller); ok {
+//		err = la.LogoutAll()
+//	}
+type LogoutAller interface {
+	// LogoutAll logs out the user everywhere, the other sessions of the user will be evicted.
+	// It returns an error if any eviction or the logout fails.
+	LogoutAll() error
+}
+
 type UidGetter interface {
 	Uid() uint64
 }
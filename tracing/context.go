@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"go.drunkce.com/dce/util"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+const flagSampled byte = 1
+
+// SpanContext is the W3C trace context of a span, it is propagated across the services via the `traceparent` and the
+// `tracestate` headers.
+type SpanContext struct {
+	TraceId [16]byte
+	SpanId  [8]byte
+	Flags   byte
+	State   string
+}
+
+// Valid reports whether the trace id and the span id are not all zero.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceId != [16]byte{} && sc.SpanId != [8]byte{}
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&flagSampled > 0
+}
+
+func (sc SpanContext) TraceIdHex() string {
+	return hex.EncodeToString(sc.TraceId[:])
+}
+
+func (sc SpanContext) SpanIdHex() string {
+	return hex.EncodeToString(sc.SpanId[:])
+}
+
+// TraceParent formats the context as the `traceparent` header value, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func (sc SpanContext) TraceParent() string {
+	return "00-" + sc.TraceIdHex() + "-" + sc.SpanIdHex() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceParent parses the `traceparent` header value, the future versions are parsed as the version 00.
+func ParseTraceParent(traceParent string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 ||
+		parts[0] == "ff" || (parts[0] == "00" && len(parts) > 4) {
+		return sc, util.Closed0(`Invalid traceparent "%s"`, traceParent)
+	}
+	var version, flags [1]byte
+	if _, err := hex.Decode(version[:], []byte(parts[0])); err != nil {
+		return sc, util.Closed0(`Invalid traceparent version "%s"`, parts[0])
+	} else if _, err = hex.Decode(sc.TraceId[:], []byte(parts[1])); err != nil {
+		return sc, util.Closed0(`Invalid trace id "%s"`, parts[1])
+	} else if _, err = hex.Decode(sc.SpanId[:], []byte(parts[2])); err != nil {
+		return sc, util.Closed0(`Invalid parent id "%s"`, parts[2])
+	} else if _, err = hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, util.Closed0(`Invalid trace flags "%s"`, parts[3])
+	}
+	sc.Flags = flags[0]
+	if !sc.Valid() {
+		return sc, util.Closed0(`Invalid traceparent "%s", the ids should not be all zero`, traceParent)
+	}
+	return sc, nil
+}
+
+// Extract extracts the span context from the header getter, such as `http.Header.Get` or a package headers lookup.
+func Extract(header func(key string) string) (SpanContext, bool) {
+	sc, err := ParseTraceParent(header(HeaderTraceParent))
+	if err != nil {
+		return sc, false
+	}
+	sc.State = header(HeaderTraceState)
+	return sc, true
+}
+
+// Inject sets the span context into the headers map, such as the headers of an outgoing flex, json or pb package.
+//
+//	pkg := flex.NewPackage("order", body, sid, -1)
+//	pkg.Headers = make(map[string]string)
+//	tracing.Inject(pkg.Headers, sc)
+func Inject(headers map[string]string, sc SpanContext) {
+	headers[HeaderTraceParent] = sc.TraceParent()
+	if sc.State != "" {
+		headers[HeaderTraceState] = sc.State
+	}
+}
+
+type contextKey struct{}
+
+// ContextKey is the key of the SpanContext in the request context.
+var ContextKey = contextKey{}
+
+// FromContext returns the span context of the routed request, the ctx could be a `router.Context` or any
+// `context.Context`.
+//
+//	sc, ok := tracing.FromContext(c)
+func FromContext(ctx interface{ Value(key any) any }) (SpanContext, bool) {
+	sc, ok := ctx.Value(ContextKey).(SpanContext)
+	return sc, ok
+}
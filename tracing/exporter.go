@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// JsonExporter writes the spans as the json lines, it works offline and could be collected by the log agents.
+type JsonExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJsonExporter(w io.Writer) *JsonExporter {
+	return &JsonExporter{w: w}
+}
+
+// NewStdoutExporter creates a JsonExporter writing to the stdout.
+func NewStdoutExporter() *JsonExporter {
+	return NewJsonExporter(os.Stdout)
+}
+
+func (j *JsonExporter) Export(span *Span) error {
+	seq, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.w.Write(append(seq, '\n'))
+	return err
+}
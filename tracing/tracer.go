@@ -0,0 +1,177 @@
+// Package tracing propagates the W3C trace context through all the protocols, the context is extracted from the
+// `traceparent` header of HTTP or the headers field of the flex, json and pb packages, and stored in the request
+// context. The spans are created per routed api and per session store operation, and exported via the Exporter.
+//
+//	tracer := tracing.NewTracer(tracing.NewStdoutExporter())
+//	tracing.Instrument(tracer, proto.HttpRouter.Raw(), "http")
+//	tracing.Instrument(tracer, flex.TcpRouter.Router, flex.TcpRouter.Id())
+//	cancel := tracer.WatchSessions()
+//
+//	// in a controller, propagate the context to a downstream flex package
+//	if sc, ok := tracing.FromContext(c); ok {
+//		tracing.Inject(pkg.Headers, sc)
+//	}
+package tracing
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+)
+
+// Span is a timed operation of a trace.
+//
+// Fields:
+//   - TraceId: The hex trace id.
+//   - SpanId: The hex span id.
+//   - ParentId: The hex span id of the parent, it is empty for the root span.
+//   - Name: The span name, such as "http order/{id}" or "session.get".
+//   - Start: The start time.
+//   - End: The end time.
+//   - Attributes: The attributes, such as the api path and the response code.
+//   - Error: The error message if the operation failed.
+type Span struct {
+	TraceId    string            `json:"traceId"`
+	SpanId     string            `json:"spanId"`
+	ParentId   string            `json:"parentId,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	ctx        SpanContext
+	tracer     *Tracer
+	ended      bool
+}
+
+// Context returns the span context to propagate.
+func (s *Span) Context() SpanContext {
+	return s.ctx
+}
+
+func (s *Span) SetAttribute(key string, value string) *Span {
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+	return s
+}
+
+// Finish ends the span and exports it if sampled, it only takes effect at the first time.
+func (s *Span) Finish() {
+	s.FinishAt(time.Now())
+}
+
+// FinishAt ends the span at the time, it is used to record a finished operation.
+func (s *Span) FinishAt(end time.Time) {
+	if s.ended {
+		return
+	}
+	s.ended, s.End = true, end
+	if s.ctx.Sampled() {
+		if err := s.tracer.exporter.Export(s); err != nil {
+			slog.Warn(fmt.Sprintf("Span export failed: %s", err.Error()))
+		}
+	}
+}
+
+// Exporter exports the finished and sampled spans.
+type Exporter interface {
+	Export(span *Span) error
+}
+
+// Tracer creates the spans and exports them.
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter, sampleRatio: 1}
+}
+
+// SetSampleRatio specifies the ratio of the root spans to sample, the child spans follow the sampled flag of their
+// parents, so that a trace is either fully sampled or not.
+func (t *Tracer) SetSampleRatio(ratio float64) *Tracer {
+	t.sampleRatio = ratio
+	return t
+}
+
+// Start starts a span, it starts a new trace if the parent is invalid.
+func (t *Tracer) Start(parent SpanContext, name string) *Span {
+	return t.startAt(parent, name, time.Now())
+}
+
+// StartFrom starts a child span of the span in the context, such as a routed `router.Context`.
+func (t *Tracer) StartFrom(ctx interface{ Value(key any) any }, name string) *Span {
+	parent, _ := FromContext(ctx)
+	return t.Start(parent, name)
+}
+
+func (t *Tracer) startAt(parent SpanContext, name string, start time.Time) *Span {
+	sc := SpanContext{TraceId: parent.TraceId, Flags: parent.Flags, State: parent.State}
+	span := &Span{Name: name, Start: start, tracer: t}
+	if parent.Valid() {
+		span.ParentId = parent.SpanIdHex()
+	} else {
+		for sc.TraceId == [16]byte{} {
+			binary.BigEndian.PutUint64(sc.TraceId[:8], rand.Uint64())
+			binary.BigEndian.PutUint64(sc.TraceId[8:], rand.Uint64())
+		}
+		sc.Flags = 0
+		if t.sampleRatio >= 1 || rand.Float64() < t.sampleRatio {
+			sc.Flags = flagSampled
+		}
+	}
+	for sc.SpanId == [8]byte{} {
+		binary.BigEndian.PutUint64(sc.SpanId[:], rand.Uint64())
+	}
+	span.ctx, span.TraceId, span.SpanId = sc, sc.TraceIdHex(), sc.SpanIdHex()
+	return span
+}
+
+// WatchSessions records the session store operations as the child spans of the requests which own the sessions, until
+// the returned function called. The sessions should be bound to the requests via `BindContext`, such as by the session
+// middleware, the operations of the unbound sessions are not recorded.
+func (t *Tracer) WatchSessions() (cancel func()) {
+	return session.Observe(func(op session.Operation) {
+		if op.Context == nil {
+			return
+		} else if parent, ok := FromContext(op.Context); ok {
+			span := t.startAt(parent, "session."+op.Name, op.Start)
+			if op.Err != nil {
+				span.Error = op.Err.Error()
+			}
+			span.FinishAt(op.Start.Add(op.Duration))
+		}
+	})
+}
+
+// Instrument creates a span for every request of the router, the parent context is extracted from the request headers,
+// and the span context is stored in the request context, which could be got via `FromContext`.
+func Instrument[Rp router.RoutableProtocol](t *Tracer, r *router.Router[Rp], name string) {
+	r.Intercept(func(ctx *router.Context[Rp]) func() {
+		parent, _ := Extract(func(key string) string {
+			return router.RequestHeader(ctx.Rp, key)
+		})
+		span := t.Start(parent, name)
+		router.WithValue(ctx.Rp, ContextKey, span.Context())
+		return func() {
+			api := "-"
+			if ctx.Api != nil {
+				api = ctx.Api.Path
+			}
+			span.Name = name + " " + api
+			span.SetAttribute("router", name).SetAttribute("api", api).SetAttribute("path", ctx.Rp.Path())
+			if err := ctx.Rp.Error(); err != nil {
+				span.Error = err.Error()
+			}
+			span.Finish()
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.drunkce.com/dce/proto"
+	"go.drunkce.com/dce/router"
+	"go.drunkce.com/dce/session"
+	"go.drunkce.com/dce/tracing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := tracing.ParseTraceParent(tp)
+	if err != nil || !sc.Sampled() || sc.TraceParent() != tp {
+		t.Fatalf("expected %s parsed, got %s, %v", tp, sc.TraceParent(), err)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, err = tracing.ParseTraceParent(invalid); err == nil {
+			t.Errorf("expected %q rejected", invalid)
+		}
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	var out bytes.Buffer
+	tracer := tracing.NewTracer(tracing.NewJsonExporter(&out))
+	cancel := tracer.WatchSessions()
+	defer cancel()
+	r := (*proto.WrappedHttpRouter)(router.NewRouter[*proto.HttpProtocol]())
+	var propagated tracing.SpanContext
+	r.Get("order/{id}", func(h *proto.Http) {
+		propagated, _ = tracing.FromContext(h)
+		_ = h.Rp.Session().Set("viewed", h.Param("id"))
+		tracer.StartFrom(h, "load order").Finish()
+	})
+	sessions := router.NewSessionMiddleware[*proto.HttpProtocol](func(sidPool []string, ttlMinutes uint16) (session.IfRequestSession[*session.SimpleUser], error) {
+		return session.NewShmSession[*session.SimpleUser](sidPool, ttlMinutes)
+	})
+	r.Raw().SetBefore("*", sessions.Before).SetAfter("*", sessions.After)
+	tracing.Instrument(tracer, r.Raw(), "http")
+
+	req := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+	req.Header.Set(tracing.HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(tracing.HeaderTraceState, "vendor=1")
+	r.Route(httptest.NewRecorder(), req)
+
+	if propagated.TraceIdHex() != "4bf92f3577b34da6a3ce929d0e0e4736" || propagated.State != "vendor=1" {
+		t.Fatalf("expected the context propagated into the request, got %s", propagated.TraceParent())
+	}
+	spans := map[string]tracing.Span{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var span tracing.Span
+		if err := json.Unmarshal([]byte(line), &span); err != nil {
+			t.Fatal(err)
+		}
+		spans[span.Name] = span
+	}
+	root, ok := spans["http order/{id}"]
+	if !ok || root.ParentId != "00f067aa0ba902b7" || root.SpanId != propagated.SpanIdHex() || root.Attributes["path"] != "order/1" {
+		t.Fatalf("unexpected api span: %+v", spans)
+	}
+	for _, name := range []string{"load order", "session.set", "session.touch"} {
+		if span, ok := spans[name]; !ok || span.ParentId != root.SpanId || span.TraceId != root.TraceId {
+			t.Errorf("expected the %q span under the api span, got %+v", name, span)
+		}
+	}
+}
+
+func TestSampleRatio(t *testing.T) {
+	var out bytes.Buffer
+	tracer := tracing.NewTracer(tracing.NewJsonExporter(&out)).SetSampleRatio(0)
+	root := tracer.Start(tracing.SpanContext{}, "root")
+	tracer.Start(root.Context(), "child").Finish()
+	root.Finish()
+	if out.Len() > 0 || root.Context().Sampled() {
+		t.Fatalf("expected the unsampled trace not exported, got %s", out.String())
+	}
+}
+
+func TestSessionSpansByContext(t *testing.T) {
+	var out bytes.Buffer
+	tracer := tracing.NewTracer(tracing.NewJsonExporter(&out))
+	cancel := tracer.WatchSessions()
+	defer cancel()
+	first, second := tracer.Start(tracing.SpanContext{}, "first"), tracer.Start(tracing.SpanContext{}, "second")
+	sess, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+	sess.BindContext(context.WithValue(context.Background(), tracing.ContextKey, first.Context()))
+	other, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+	other.BindContext(context.WithValue(context.Background(), tracing.ContextKey, second.Context()))
+	unbound, _ := session.NewShmSession[*session.SimpleUser](nil, session.DefaultTtlMinutes)
+
+	// the interleaved operations, and the operations of a clone, should be attributed to the bound requests
+	_ = sess.Set("a", 1)
+	_ = other.Set("a", 1)
+	_ = unbound.Set("a", 1)
+	cloned, _ := sess.Clone("")
+	_ = cloned.(session.IfSession).Del("a")
+
+	parents := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var span tracing.Span
+		if err := json.Unmarshal([]byte(line), &span); err != nil {
+			t.Fatal(err)
+		} else if span.ParentId != first.SpanId && span.ParentId != second.SpanId {
+			t.Fatalf("expected only the bound operations recorded, got %+v", span)
+		}
+		parents[span.Name+" "+span.ParentId] = span.TraceId
+	}
+	for key, traceId := range map[string]string{
+		"session.set " + first.SpanId:  first.TraceId,
+		"session.set " + second.SpanId: second.TraceId,
+		"session.del " + first.SpanId:  first.TraceId,
+	} {
+		if parents[key] != traceId {
+			t.Errorf("expected the span %q in the trace %s, got %v", key, traceId, parents)
+		}
+	}
+}